@@ -0,0 +1,77 @@
+// Package assets holds the default themes and static assets, compiled into the binary so it can
+// serve documentation on its own. Assets directories configured are layered on top of them.
+package assets
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/vfs"
+)
+
+//go:embed static themes
+var embedded embed.FS
+
+// Default returns the default assets: those of the default assets source, when one is configured,
+// or else those compiled in. Those compiled in are returned with the error of a source that cannot
+// be opened.
+func Default() (fs.FS, error) {
+	if src := viper.GetString(config.DefaultAssetsDir); src != "" {
+		fsys, err := vfs.Open(src)
+		if err != nil {
+			return embedded, err
+		}
+
+		return fsys, nil
+	}
+
+	return embedded, nil
+}
+
+// Open opens the theme file name from the first of the assets source, the theme source and the
+// default assets to have it, returning where it was found. The sources are opened with open.
+func Open(open func(location string) (fs.FS, error), name string) (fs.File, string, error) {
+	theme := viper.GetString(config.Theme)
+
+	type source struct {
+		location string
+		dir      string
+	}
+
+	var sources []source
+
+	if src := viper.GetString(config.AssetsDir); src != "" {
+		sources = append(sources, source{src, "."})
+	}
+
+	if src := viper.GetString(config.ThemeDir); src != "" {
+		sources = append(sources, source{src, theme})
+	}
+
+	for _, s := range sources {
+		fsys, err := open(s.location)
+		if err != nil {
+			continue
+		}
+
+		if f, err := fsys.Open(path.Join(s.dir, name)); err == nil {
+			return f, path.Join(s.location, s.dir, name), nil
+		}
+	}
+
+	defaults, _ := Default()
+
+	for _, t := range []string{theme, "default"} {
+		p := path.Join("themes", t, name)
+
+		if f, err := defaults.Open(p); err == nil {
+			return f, p, nil
+		}
+	}
+
+	return nil, "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
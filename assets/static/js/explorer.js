@@ -412,6 +412,11 @@ apiExplorer.go = function( method, url ){
     // Construct request URL bits from the url and extended query
     var constructed_request = _get_url( url, query );
 
+    // Requests proxied by the portal, which may act as the reader, must show they are from the explorer.
+    if( constructed_request.fullhost == window.location.host ) {
+        headers.push( { name: "X-Requested-By", value: "explorer" } );
+    }
+
     // TODO Get protocol from passed in url
     $('#request_url').html( hljs.highlight( 'http', method.toUpperCase() + ' ' + display_url + ' HTTP/1.1\nHost: ' + constructed_request.fullhost + display_content_type + display_headers ).value );
 
@@ -0,0 +1,524 @@
+// Package auth identifies the readers of the documentation, and decides which specifications
+// and guides each of them may see.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/basepath"
+	"github.com/kenjones-cisco/dapperdox/navigation"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+// all authentication providers.
+const (
+	ProviderHtpasswd = "htpasswd"
+	ProviderToken    = "token"
+	ProviderHeader   = "header"
+	ProviderOIDC     = "oidc"
+)
+
+// PathPrefix is the prefix of the sign in and out routes, which are open to everyone.
+const PathPrefix = "/auth"
+
+// LogoutPath signs the reader out, ending their session.
+const LogoutPath = PathPrefix + "/logout"
+
+// User is a signed in reader.
+type User struct {
+	Name   string
+	Groups []string
+	Claims map[string]interface{} // Claims of the ID token, for readers signed in by OIDC
+
+	tokens oauth2.TokenSource // Access tokens, for readers signed in by OIDC
+}
+
+// Rule restricts a specification, or a tree of guides, to the listed users and groups. A rule
+// listing neither allows any signed in reader, and a public rule allows everyone.
+type Rule struct {
+	Spec   string   `mapstructure:"spec"`   // Specification ID
+	Guides string   `mapstructure:"guides"` // Route prefix of a guide tree
+	Users  []string `mapstructure:"users"`
+	Groups []string `mapstructure:"groups"`
+	Public bool     `mapstructure:"public"`
+}
+
+// remembering is implemented by providers that sign a browser in for later requests, by starting
+// a session when a request is authenticated.
+type remembering interface {
+	remember(r *http.Request) bool
+}
+
+// stripping is implemented by providers that take credentials from a request by other means than
+// the Authorization header, so they can be removed before the request is forwarded elsewhere.
+type stripping interface {
+	strip(r *http.Request)
+}
+
+// provider authenticates requests by one method.
+type provider interface {
+	// authenticate returns the reader of the request, or nil when they are not signed in.
+	authenticate(r *http.Request) (*User, error)
+	// challenge asks a reader who is not signed in to sign in.
+	challenge(w http.ResponseWriter, r *http.Request)
+}
+
+// Gate authenticates readers by the provider configured, and holds the rules of what they may see.
+// A gate is created by each build of the portal, sharing the sessions of signed in readers.
+type Gate struct {
+	provider    provider
+	sessions    *sessionStore
+	credentials *credentials // Authorization headers readers were authenticated by
+	required    bool         // Whether readers must sign in to see pages no rule covers
+	rules       []*Rule
+	suite       *spec.Suite
+}
+
+type (
+	gateKey          struct{}
+	userKey          struct{}
+	authorizationKey struct{} // The Authorization header the reader signed in with
+)
+
+// NewUser returns a reader signed in by other means than the providers configured, whose OIDC
+// access tokens, if any, are from the source given.
+func NewUser(name string, groups []string, tokens oauth2.TokenSource) *User {
+	return &User{Name: name, Groups: groups, tokens: tokens}
+}
+
+// NewContext returns a copy of the context of a request of the reader signed in.
+func NewContext(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, userKey{}, u)
+}
+
+// FromContext returns the reader of the request, or nil when they are not signed in.
+func FromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(userKey{}).(*User)
+
+	return u
+}
+
+// AccessToken returns the OIDC access token of the reader, refreshing it when it has expired, or
+// "" when they signed in by another provider.
+func (u *User) AccessToken() (string, error) {
+	if u.tokens == nil {
+		return "", nil
+	}
+
+	tok, err := u.tokens.Token()
+	if err != nil {
+		return "", err
+	}
+
+	return tok.AccessToken, nil
+}
+
+// Claim returns a claim about the reader. Readers signed in by other providers than OIDC have
+// only the sub and groups claims, being their name and groups.
+func (u *User) Claim(name string) (interface{}, bool) {
+	if v, ok := u.Claims[name]; ok {
+		return v, true
+	}
+
+	switch name {
+	case "sub":
+		return u.Name, true
+	case "groups":
+		return u.Groups, len(u.Groups) > 0
+	}
+
+	return nil, false
+}
+
+// Enabled reports whether readers are authenticated, as they are when the request passed a gate.
+func Enabled(r *http.Request) bool {
+	return gateOf(r) != nil
+}
+
+// gateOf returns the gate the request passed, or nil when authentication is not configured.
+func gateOf(r *http.Request) *Gate {
+	if r == nil {
+		return nil
+	}
+
+	g, _ := r.Context().Value(gateKey{}).(*Gate)
+
+	return g
+}
+
+// Register configures the authentication provider and access rules to the specifications of the
+// suite, and creates the routes for signing in and out. It returns nil when no provider is
+// configured, leaving authentication disabled.
+func Register(r *mux.Router, suite *spec.Suite) (*Gate, error) {
+	name := strings.ToLower(viper.GetString(config.AuthProvider))
+	if name == "" {
+		log().Debug("Authentication is not configured")
+
+		return nil, nil
+	}
+
+	log().Infof("Registering %s authentication", name)
+
+	g := &Gate{
+		sessions:    newSessionStore(),
+		credentials: newCredentials(viper.GetDuration(config.AuthSessionTTL)),
+		required:    viper.GetBool(config.AuthRequired),
+		suite:       suite,
+	}
+
+	if err := viper.UnmarshalKey(config.AuthRules, &g.rules); err != nil {
+		return nil, fmt.Errorf("auth rules: %w", err)
+	}
+
+	for i, rule := range g.rules {
+		if (rule.Spec == "") == (rule.Guides == "") {
+			return nil, fmt.Errorf("auth rule %d must name either a spec or a guides route", i)
+		}
+	}
+
+	var err error
+
+	switch name {
+	case ProviderHtpasswd:
+		g.provider, err = newHtpasswd()
+	case ProviderToken:
+		g.provider, err = newToken()
+	case ProviderHeader:
+		g.provider, err = newHeader()
+	case ProviderOIDC:
+		g.provider, err = newOIDC(r, g.sessions)
+	default:
+		err = errors.New("unknown provider " + name)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("auth %s: %w", name, err)
+	}
+
+	r.Path(LogoutPath).HandlerFunc(g.logout)
+
+	return g, nil
+}
+
+// Handler returns middleware that authenticates each request by the gate, and passes it on when
+// the reader may see the page. Readers who are not signed in are asked to, and others are answered
+// by denied, so that pages they may not see cannot be told apart from pages that do not exist.
+// Requests are passed on as they are when the gate is nil.
+func Handler(g *Gate, denied http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if g == nil {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// What the reader may see is filtered by the gate the request passed.
+			r = r.WithContext(context.WithValue(r.Context(), gateKey{}, g))
+
+			if strings.HasPrefix(r.URL.Path, PathPrefix+"/") {
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			u := g.sessions.user(r)
+			if u == nil {
+				a := r.Header.Get("Authorization")
+
+				// Clients that keep no cookies are known by the credential they were authenticated by.
+				if a != "" {
+					u = g.credentials.user(a)
+				}
+
+				if u == nil {
+					var err error
+					if u, err = g.provider.authenticate(r); err != nil {
+						log().Warnf("Authentication failed for %s: %s", r.URL.Path, err)
+					}
+
+					if p, ok := g.provider.(remembering); ok && u != nil && p.remember(r) {
+						g.sessions.create(w, r, u)
+					}
+
+					if u != nil && a != "" {
+						g.credentials.add(a, u)
+					}
+				}
+
+				if u != nil && a != "" {
+					r = r.WithContext(context.WithValue(r.Context(), authorizationKey{}, a))
+				}
+			}
+
+			if g.allowed(u, r.URL.Path) {
+				if u != nil {
+					r = r.WithContext(NewContext(r.Context(), u))
+				}
+
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			if u == nil {
+				g.provider.challenge(w, r)
+
+				return
+			}
+
+			log().Debugf("%s may not see %s", u.Name, r.URL.Path)
+			denied.ServeHTTP(w, r.WithContext(NewContext(r.Context(), u)))
+		})
+	}
+}
+
+// VerifiedSession reports whether the cookie named is the session cookie of a reader signed in by
+// the gate, without authenticating the request.
+func (g *Gate) VerifiedSession(r *http.Request, cookie string) bool {
+	return g != nil && cookie == g.sessions.cookie && g.sessions.user(r) != nil
+}
+
+// VerifiedCredential reports whether the header named is the Authorization header a reader was
+// recently authenticated by, without authenticating the request.
+func (g *Gate) VerifiedCredential(r *http.Request, header string) bool {
+	if g == nil || http.CanonicalHeaderKey(header) != "Authorization" {
+		return false
+	}
+
+	a := r.Header.Get("Authorization")
+
+	return a != "" && g.credentials.user(a) != nil
+}
+
+// PassedGate verifies the credentials of a request by the gate it passed, for handlers served
+// behind Handler.
+var PassedGate passedGate
+
+type passedGate struct{}
+
+func (passedGate) VerifiedSession(r *http.Request, cookie string) bool {
+	return gateOf(r).VerifiedSession(r, cookie)
+}
+
+func (passedGate) VerifiedCredential(r *http.Request, header string) bool {
+	return gateOf(r).VerifiedCredential(r, header)
+}
+
+// StripCredentials removes the reader's credentials for the portal from a request about to be
+// forwarded elsewhere, being their session cookie, any Authorization header they signed in with and
+// any other credential the provider takes, such as a token query parameter.
+func StripCredentials(r *http.Request) {
+	g := gateOf(r)
+	if g == nil {
+		return
+	}
+
+	if a, ok := r.Context().Value(authorizationKey{}).(string); ok && r.Header.Get("Authorization") == a {
+		r.Header.Del("Authorization")
+	}
+
+	if p, ok := g.provider.(stripping); ok {
+		p.strip(r)
+	}
+
+	g.sessions.strip(r)
+}
+
+// Specs returns the specifications the reader of the request may see.
+func Specs(r *http.Request, suite map[string]*spec.APISpecification) map[string]*spec.APISpecification {
+	g := gateOf(r)
+	if g == nil {
+		return suite
+	}
+
+	u := userOf(r)
+	visible := make(map[string]*spec.APISpecification, len(suite))
+
+	for id, s := range suite {
+		if g.check(u, g.matching(func(rule *Rule) bool { return rule.Spec == id })) {
+			visible[id] = s
+		}
+	}
+
+	return visible
+}
+
+// SpecGroups returns the groups of specifications the reader of the request may see.
+func SpecGroups(r *http.Request, groups map[string][]*spec.APISpecification) map[string][]*spec.APISpecification {
+	if gateOf(r) == nil {
+		return groups
+	}
+
+	visible := make(map[string][]*spec.APISpecification, len(groups))
+
+	for name, list := range groups {
+		suite := make(map[string]*spec.APISpecification, len(list))
+		for _, s := range list {
+			suite[s.ID] = s
+		}
+
+		allowed := Specs(r, suite)
+
+		for _, s := range list {
+			if _, ok := allowed[s.ID]; ok {
+				visible[name] = append(visible[name], s)
+			}
+		}
+	}
+
+	return visible
+}
+
+// Guides returns the guide navigation pruned of the guides the reader of the request may not see.
+func Guides(r *http.Request, nodes []*navigation.Node) []*navigation.Node {
+	g := gateOf(r)
+	if g == nil || nodes == nil {
+		return nodes
+	}
+
+	return g.prune(userOf(r), nodes)
+}
+
+func userOf(r *http.Request) *User {
+	if r == nil {
+		return nil
+	}
+
+	return FromContext(r.Context())
+}
+
+func (g *Gate) prune(u *User, nodes []*navigation.Node) []*navigation.Node {
+	visible := make([]*navigation.Node, 0, len(nodes))
+
+	for _, n := range nodes {
+		if n.URI != "" && !g.allowed(u, n.URI) {
+			continue
+		}
+
+		if len(n.Children) > 0 {
+			c := *n
+			c.Children = g.prune(u, n.Children)
+
+			if len(c.Children) == 0 && c.URI == "" {
+				continue
+			}
+
+			n = &c
+		}
+
+		visible = append(visible, n)
+	}
+
+	return visible
+}
+
+// allowed reports whether the reader may see the page at the path. Every rule covering the path
+// must allow the reader.
+func (g *Gate) allowed(u *User, path string) bool {
+	id := g.specOf(path)
+	lower := strings.ToLower(path)
+
+	return g.check(u, g.matching(func(rule *Rule) bool {
+		if rule.Spec != "" {
+			return rule.Spec == id
+		}
+
+		prefix := strings.ToLower(strings.TrimSuffix(rule.Guides, "/"))
+
+		return lower == prefix || strings.HasPrefix(lower, prefix+"/")
+	}))
+}
+
+func (g *Gate) matching(match func(*Rule) bool) []*Rule {
+	var rules []*Rule
+
+	for _, rule := range g.rules {
+		if match(rule) {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+func (g *Gate) check(u *User, rules []*Rule) bool {
+	if len(rules) == 0 {
+		return u != nil || !g.required
+	}
+
+	for _, rule := range rules {
+		if !rule.allows(u) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (g *Gate) logout(w http.ResponseWriter, r *http.Request) {
+	g.sessions.delete(w, r)
+	basepath.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (rule *Rule) allows(u *User) bool {
+	if rule.Public {
+		return true
+	}
+
+	if u == nil {
+		return false
+	}
+
+	if len(rule.Users) == 0 && len(rule.Groups) == 0 {
+		return true
+	}
+
+	for _, name := range rule.Users {
+		if name == u.Name {
+			return true
+		}
+	}
+
+	for _, group := range rule.Groups {
+		for _, g := range u.Groups {
+			if group == g {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// specOf returns the ID of the specification a path belongs to, or "" when it belongs to none.
+// Specification pages, guides and explorer routes start with the ID, mock routes follow a prefix,
+// and specification documents are served at the location they were loaded from.
+func (g *Gate) specOf(path string) string {
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+
+	if _, ok := g.suite.Specs[segments[0]]; ok {
+		return segments[0]
+	}
+
+	if segments[0] == "mock" && len(segments) > 1 {
+		if _, ok := g.suite.Specs[segments[1]]; ok {
+			return segments[1]
+		}
+	}
+
+	for id, s := range g.suite.Specs {
+		if s.URL == path {
+			return id
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/navigation"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+// register configures authentication by the provider given, with the settings given.
+func register(t *testing.T, provider string, settings map[string]interface{}) *Gate {
+	t.Helper()
+
+	config.Restore()
+	viper.Set(config.AuthProvider, provider)
+
+	for k, v := range settings {
+		viper.Set(k, v)
+	}
+
+	g, err := Register(mux.NewRouter(), &spec.Suite{})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	return g
+}
+
+// forwarded passes the request through the authentication middleware and returns it as it would be
+// forwarded to a proxied API.
+func forwarded(t *testing.T, g *Gate, req *http.Request) *http.Request {
+	t.Helper()
+
+	var out *http.Request
+
+	h := Handler(g, http.NotFoundHandler())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out = r.Clone(r.Context())
+		StripCredentials(out)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if out == nil {
+		t.Fatal("request was not passed on")
+	}
+
+	return out
+}
+
+func TestStripCredentials(t *testing.T) {
+	g := register(t, ProviderToken, map[string]interface{}{config.AuthToken: "secret", config.AuthRequired: false})
+
+	tests := []struct {
+		name          string
+		target        string
+		authorization string
+		cookies       []*http.Cookie
+		wantAuth      string
+		wantQuery     string
+		wantCookies   string
+	}{
+		{
+			name:          "bearer token signed in with",
+			target:        "/api/things?a=1",
+			authorization: "Bearer secret",
+			cookies:       []*http.Cookie{{Name: "dapperdox-session", Value: "s"}, {Name: "theme", Value: "dark"}},
+			wantQuery:     "a=1",
+			wantCookies:   "theme=dark",
+		},
+		{
+			name:      "token query parameter signed in with",
+			target:    "/api/things?a=1&token=secret",
+			wantQuery: "a=1",
+		},
+		{
+			name:          "credentials of an anonymous reader for the API",
+			target:        "/api/things?token=upstream",
+			authorization: "Basic dXNlcjpwYXNz",
+			wantAuth:      "Basic dXNlcjpwYXNz",
+			wantQuery:     "token=upstream",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			for _, c := range tt.cookies {
+				req.AddCookie(c)
+			}
+
+			out := forwarded(t, g, req)
+
+			if got := out.Header.Get("Authorization"); got != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", got, tt.wantAuth)
+			}
+
+			if got := out.URL.RawQuery; got != tt.wantQuery {
+				t.Errorf("query = %q, want %q", got, tt.wantQuery)
+			}
+
+			if got := out.Header.Get("Cookie"); got != tt.wantCookies {
+				t.Errorf("Cookie = %q, want %q", got, tt.wantCookies)
+			}
+		})
+	}
+}
+
+func TestHeaderProvider(t *testing.T) {
+	config.Restore()
+	viper.Set(config.AuthProvider, ProviderHeader)
+
+	if _, err := Register(mux.NewRouter(), &spec.Suite{}); err == nil {
+		t.Error("Register() of the header provider without trusted proxies error = nil, want an error")
+	}
+
+	g := register(t, ProviderHeader, map[string]interface{}{config.AuthHeaderTrusted: []string{"10.0.0.0/8"}})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		wantUser   string
+		wantStatus int
+	}{
+		{"trusted proxy", "10.1.2.3:4000", "alice", http.StatusOK},
+		{"untrusted client", "192.0.2.1:4000", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-User", "alice")
+			req.Header.Set("X-Forwarded-Groups", "staff, partners")
+
+			var user *User
+
+			w := httptest.NewRecorder()
+			Handler(g, http.NotFoundHandler())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user = FromContext(r.Context())
+			})).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Handler() answered %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			got := ""
+			if user != nil {
+				got = user.Name
+			}
+
+			if got != tt.wantUser {
+				t.Errorf("user = %q, want %q", got, tt.wantUser)
+			}
+
+			if user != nil && len(user.Groups) != 2 {
+				t.Errorf("user groups = %v, want staff and partners", user.Groups)
+			}
+		})
+	}
+}
+
+func TestSessionsKeptAcrossRegister(t *testing.T) {
+	g := register(t, ProviderToken, map[string]interface{}{config.AuthToken: "secret"})
+
+	w := httptest.NewRecorder()
+	g.sessions.create(w, httptest.NewRequest(http.MethodGet, "/", nil), &User{Name: "alice"})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	// The configuration is reloaded, registering the provider again.
+	g = register(t, ProviderToken, map[string]interface{}{config.AuthToken: "secret"})
+
+	if u := g.sessions.user(req); u == nil || u.Name != "alice" {
+		t.Errorf("user after registering again = %v, want alice still signed in", u)
+	}
+}
+
+func TestVerified(t *testing.T) {
+	g := register(t, ProviderToken, map[string]interface{}{config.AuthToken: "secret", config.AuthRequired: false})
+	cookie := viper.GetString(config.AuthSessionCookie)
+
+	w := httptest.NewRecorder()
+	g.sessions.create(w, httptest.NewRequest(http.MethodGet, "/", nil), &User{Name: "alice"})
+
+	signedIn := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		signedIn.AddCookie(c)
+	}
+
+	forged := httptest.NewRequest(http.MethodGet, "/", nil)
+	forged.AddCookie(&http.Cookie{Name: cookie, Value: "forged"})
+
+	if !g.VerifiedSession(signedIn, cookie) {
+		t.Error("VerifiedSession() of a session = false, want true")
+	}
+
+	if g.VerifiedSession(forged, cookie) || g.VerifiedSession(signedIn, "other") {
+		t.Error("VerifiedSession() of a forged session or other cookie = true, want false")
+	}
+
+	bearer := func(token string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		return req
+	}
+
+	if g.VerifiedCredential(bearer("secret"), "Authorization") {
+		t.Error("VerifiedCredential() before authenticating = true, want false")
+	}
+
+	forwarded(t, g, bearer("secret"))
+	forwarded(t, g, bearer("wrong"))
+
+	if !g.VerifiedCredential(bearer("secret"), "authorization") {
+		t.Error("VerifiedCredential() after authenticating = false, want true")
+	}
+
+	if g.VerifiedCredential(bearer("wrong"), "Authorization") {
+		t.Error("VerifiedCredential() of a rejected credential = true, want false")
+	}
+
+	if (*Gate)(nil).VerifiedSession(signedIn, cookie) || (*Gate)(nil).VerifiedCredential(bearer("secret"), "Authorization") {
+		t.Error("verified by a nil gate, want nothing verified")
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	content := "alice:" + string(hash) + "\nbob:$apr1$salt$Pm0Hn4r6NAsd1L4GdJ2Vt/\n"
+
+	if err := ioutil.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	g := register(t, ProviderHtpasswd, map[string]interface{}{config.AuthHtpasswdFile: file, config.AuthSessionSecure: true})
+	h := Handler(g, http.NotFoundHandler())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	basic := func(user, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(user, password)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := basic("alice", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].Secure {
+		t.Errorf("cookies = %v, want a secure session cookie behind a proxy terminating TLS", cookies)
+	}
+
+	// The password is not checked again, even for clients that keep no cookies.
+	g.provider.(*htpasswd).users["alice"] = "changed"
+
+	if w := basic("alice", "secret"); w.Code != http.StatusOK || len(w.Result().Cookies()) != 0 {
+		t.Errorf("status = %d, cookies %v, want %d from the credential remembered", w.Code, w.Result().Cookies(), http.StatusOK)
+	}
+
+	if w := basic("alice", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if w := basic("bob", "secret"); w.Code != http.StatusUnauthorized {
+		t.Errorf("apr1 hash status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRules(t *testing.T) {
+	config.Restore()
+	viper.Set(config.AuthProvider, ProviderHeader)
+	viper.Set(config.AuthHeaderTrusted, []string{"192.0.2.0/24"})
+	viper.Set(config.AuthRequired, true)
+	viper.Set(config.AuthRules, []map[string]interface{}{
+		{"spec": "petstore", "groups": []string{"devs"}},
+		{"guides": "/guides/internal/", "users": []string{"bob"}},
+		{"guides": "/guides/welcome", "public": true},
+	})
+
+	suite := &spec.Suite{Specs: map[string]*spec.APISpecification{"petstore": {ID: "petstore", URL: "/specs/petstore.json"}}}
+
+	g, err := Register(mux.NewRouter(), suite)
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		user   string
+		groups string
+		path   string
+		want   int
+	}{
+		{name: "spec, not signed in", path: "/petstore/reference/pets", want: http.StatusUnauthorized},
+		{name: "spec, in group", user: "alice", groups: "devs", path: "/petstore/reference/pets", want: http.StatusOK},
+		{name: "spec, not in group", user: "carol", path: "/petstore/reference/pets", want: http.StatusNotFound},
+		{name: "spec mock, in group", user: "alice", groups: "devs", path: "/mock/petstore/pets", want: http.StatusOK},
+		{name: "spec mock, not in group", user: "carol", path: "/mock/petstore/pets", want: http.StatusNotFound},
+		{name: "spec document, not in group", user: "carol", path: "/specs/petstore.json", want: http.StatusNotFound},
+		{name: "guides, listed user", user: "bob", path: "/guides/Internal/setup", want: http.StatusOK},
+		{name: "guides, other user", user: "alice", groups: "devs", path: "/guides/internal", want: http.StatusNotFound},
+		{name: "guides sharing a prefix", user: "alice", path: "/guides/internals", want: http.StatusOK},
+		{name: "public guides, not signed in", path: "/guides/welcome/start", want: http.StatusOK},
+		{name: "uncovered, not signed in", path: "/guides/other", want: http.StatusUnauthorized},
+		{name: "sign in routes, not signed in", path: PathPrefix + "/login", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = "192.0.2.1:4000"
+
+			if tt.user != "" {
+				req.Header.Set("X-Forwarded-User", tt.user)
+				req.Header.Set("X-Forwarded-Groups", tt.groups)
+			}
+
+			var visible map[string]*spec.APISpecification
+
+			w := httptest.NewRecorder()
+			Handler(g, http.NotFoundHandler())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				visible = Specs(r, suite.Specs)
+			})).ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("GET %s as %q answered %d, want %d", tt.path, tt.user, w.Code, tt.want)
+			}
+
+			// The specification is listed only to those who may see its pages.
+			if _, ok := visible["petstore"]; w.Code == http.StatusOK && ok != (tt.groups == "devs") {
+				t.Errorf("Specs() as %q lists petstore %v", tt.user, ok)
+			}
+		})
+	}
+
+	g.required = false
+
+	if !g.allowed(nil, "/guides/other") || g.allowed(nil, "/guides/internal") {
+		t.Error("allowed() when sign in is not required, want only pages no rule covers to be open")
+	}
+}
+
+func TestGuides(t *testing.T) {
+	g := &Gate{
+		rules: []*Rule{{Guides: "/guides/internal", Users: []string{"bob"}}},
+		suite: &spec.Suite{},
+	}
+
+	nav := []*navigation.Node{
+		{Name: "Welcome", URI: "/guides/welcome"},
+		{Name: "Internal", Children: []*navigation.Node{{Name: "Setup", URI: "/guides/internal/setup"}}},
+	}
+
+	for user, want := range map[string]int{"alice": 1, "bob": 2} {
+		if got := g.prune(&User{Name: user}, nav); len(got) != want {
+			t.Errorf("prune() for %s = %d nodes, want %d", user, len(got), want)
+		}
+	}
+}
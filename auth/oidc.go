@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/basepath"
+)
+
+// OIDC sign in routes.
+const (
+	LoginPath    = PathPrefix + "/login"
+	CallbackPath = PathPrefix + "/callback"
+)
+
+// loginTimeout limits how long a reader may take to sign in with the identity provider.
+const loginTimeout = 10 * time.Minute
+
+// maxPending limits the sign ins in progress, as anyone may start one.
+const maxPending = 10000
+
+// openID signs readers in with an OpenID Connect provider, by the authorization code flow,
+// keeping them signed in with a session.
+type openID struct {
+	oauth       oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+	userClaim   string
+	groupsClaim string
+	sessions    *sessionStore
+
+	mu      sync.Mutex
+	pending map[string]*login // Keyed by state
+}
+
+type login struct {
+	nonce    string
+	redirect string
+	expires  time.Time
+}
+
+func newOIDC(r *mux.Router, sessions *sessionStore) (*openID, error) {
+	issuer := viper.GetString(config.AuthOIDCIssuer)
+	if issuer == "" {
+		return nil, errors.New("no issuer given")
+	}
+
+	p, err := oidc.NewProvider(context.Background(), issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	redirect := viper.GetString(config.AuthOIDCRedirectURL)
+	if redirect == "" {
+		redirect = defaultRedirect()
+	}
+
+	o := &openID{
+		oauth: oauth2.Config{
+			ClientID:     viper.GetString(config.AuthOIDCClientID),
+			ClientSecret: viper.GetString(config.AuthOIDCClientSecret),
+			Endpoint:     p.Endpoint(),
+			RedirectURL:  redirect,
+			Scopes:       viper.GetStringSlice(config.AuthOIDCScopes),
+		},
+		verifier:    p.Verifier(&oidc.Config{ClientID: viper.GetString(config.AuthOIDCClientID)}),
+		userClaim:   viper.GetString(config.AuthOIDCUserClaim),
+		groupsClaim: viper.GetString(config.AuthOIDCGroupsClaim),
+		sessions:    sessions,
+		pending:     make(map[string]*login),
+	}
+
+	r.Path(LoginPath).Methods(http.MethodGet).HandlerFunc(o.login)
+	r.Path(CallbackPath).Methods(http.MethodGet).HandlerFunc(o.callback)
+
+	return o, nil
+}
+
+// authenticate signs no one in, as OIDC readers are only known by their session.
+func (o *openID) authenticate(r *http.Request) (*User, error) {
+	return nil, nil
+}
+
+// challenge sends browsers to sign in, returning them to the page afterwards. Other clients,
+// such as the API explorer, are answered with a 401.
+func (o *openID) challenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	basepath.Redirect(w, r, LoginPath+"?rd="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+}
+
+// login sends the reader to the identity provider, remembering the state of the sign in in a cookie,
+// so it can only be completed by the browser that started it.
+func (o *openID) login(w http.ResponseWriter, r *http.Request) {
+	l := &login{
+		nonce:    randomString(),
+		redirect: localRedirect(r.URL.Query().Get("rd")),
+		expires:  time.Now().Add(loginTimeout),
+	}
+	state := randomString()
+
+	o.mu.Lock()
+	o.prune()
+
+	full := len(o.pending) >= maxPending
+	if !full {
+		o.pending[state] = l
+	}
+	o.mu.Unlock()
+
+	if full {
+		log().Warnf("Refused sign in, as %d are in progress", maxPending)
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Too many sign ins in progress, please try again shortly", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	http.SetCookie(w, o.stateCookie(r, state, int(loginTimeout.Seconds())))
+	http.Redirect(w, r, o.oauth.AuthCodeURL(state, oidc.Nonce(l.nonce)), http.StatusFound)
+}
+
+func (o *openID) callback(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+
+	c, err := r.Cookie(o.sessions.cookie + loginSuffix)
+	http.SetCookie(w, o.stateCookie(r, "", -1))
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) != 1 {
+		http.Error(w, "Sign in was not started by this browser, please try again", http.StatusBadRequest)
+
+		return
+	}
+
+	o.mu.Lock()
+	l, ok := o.pending[state]
+	delete(o.pending, state)
+	o.mu.Unlock()
+
+	if !ok || time.Now().After(l.expires) {
+		http.Error(w, "Sign in has expired, please try again", http.StatusBadRequest)
+
+		return
+	}
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		log().Warnf("Sign in refused by identity provider: %s %s", e, r.URL.Query().Get("error_description"))
+		http.Error(w, "Sign in was refused", http.StatusForbidden)
+
+		return
+	}
+
+	u, err := o.exchange(r.Context(), r.URL.Query().Get("code"), l.nonce)
+	if err != nil {
+		log().Warnf("Sign in failed: %s", err)
+		http.Error(w, "Sign in failed", http.StatusForbidden)
+
+		return
+	}
+
+	log().Infof("%s signed in", u.Name)
+
+	o.sessions.create(w, r, u)
+	basepath.Redirect(w, r, l.redirect, http.StatusFound)
+}
+
+// exchange redeems the authorization code, and returns the user named by the verified ID token.
+func (o *openID) exchange(ctx context.Context, code, nonce string) (*User, error) {
+	tok, err := o.oauth.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+
+	idToken, err := o.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	u := &User{Name: idToken.Subject, Claims: claims, tokens: o.oauth.TokenSource(context.Background(), tok)}
+	if name, ok := claims[o.userClaim].(string); ok && name != "" {
+		u.Name = name
+	}
+
+	switch groups := claims[o.groupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				u.Groups = append(u.Groups, s)
+			}
+		}
+	case string:
+		u.Groups = strings.Fields(groups)
+	}
+
+	return u, nil
+}
+
+// defaultRedirect returns the callback URL under the site URL and base path configured, the site
+// URL being that of the host the portal is served from.
+func defaultRedirect() string {
+	site := strings.TrimSuffix(viper.GetString(config.SiteURL), "/")
+	if base := basepath.Configured(); !strings.HasSuffix(site, base) {
+		site += base
+	}
+
+	return site + CallbackPath
+}
+
+// loginSuffix names the cookie holding the state of a sign in, after the session cookie.
+const loginSuffix = "-login"
+
+// stateCookie returns the cookie holding the state of a sign in, for the callback alone. It is sent
+// on the redirect back from the identity provider, being a top level navigation.
+func (o *openID) stateCookie(r *http.Request, state string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     o.sessions.cookie + loginSuffix,
+		Value:    state,
+		Path:     basepath.URL(r, CallbackPath),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   o.sessions.secureCookie(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// prune forgets sign ins that were never completed. The caller holds the lock.
+func (o *openID) prune() {
+	now := time.Now()
+
+	for state, l := range o.pending {
+		if now.After(l.expires) {
+			delete(o.pending, state)
+		}
+	}
+}
+
+// localRedirect only allows returning to a path on this site after signing in. Browsers drop tabs
+// and line breaks from URLs, and read a backslash as a slash, so neither may make the path another
+// site's.
+func localRedirect(rd string) string {
+	if strings.ContainsAny(rd, "\t\r\n") || !strings.HasPrefix(rd, "/") || strings.HasPrefix(rd, "//") || strings.HasPrefix(rd, "/\\") {
+		return "/"
+	}
+
+	return rd
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+func TestLocalRedirect(t *testing.T) {
+	tests := []struct {
+		rd   string
+		want string
+	}{
+		{rd: "", want: "/"},
+		{rd: "/petstore/reference?v=2#pets", want: "/petstore/reference?v=2#pets"},
+		{rd: "guides", want: "/"},
+		{rd: "https://evil.example.com/", want: "/"},
+		{rd: "//evil.example.com/", want: "/"},
+		{rd: "/\\evil.example.com/", want: "/"},
+		{rd: "/\t/evil.example.com/", want: "/"},
+	}
+	for _, tt := range tests {
+		if got := localRedirect(tt.rd); got != tt.want {
+			t.Errorf("localRedirect(%q) = %q, want %q", tt.rd, got, tt.want)
+		}
+	}
+}
+
+// newTestOIDC returns the OIDC provider of an identity provider that is never reached.
+func newTestOIDC() *openID {
+	config.Restore()
+
+	return &openID{
+		oauth:    oauth2.Config{ClientID: "portal", Endpoint: oauth2.Endpoint{AuthURL: "https://idp.example.com/auth"}},
+		sessions: newSessionStore(),
+		pending:  make(map[string]*login),
+	}
+}
+
+func TestDefaultRedirect(t *testing.T) {
+	tests := []struct {
+		site string
+		base string
+		want string
+	}{
+		{site: "https://docs.example.com/", want: "https://docs.example.com/auth/callback"},
+		{site: "https://docs.example.com/", base: "/developer/", want: "https://docs.example.com/developer/auth/callback"},
+		{site: "https://docs.example.com/developer/", base: "/developer", want: "https://docs.example.com/developer/auth/callback"},
+	}
+	for _, tt := range tests {
+		config.Restore()
+		viper.Set(config.SiteURL, tt.site)
+		viper.Set(config.BasePath, tt.base)
+
+		if got := defaultRedirect(); got != tt.want {
+			t.Errorf("defaultRedirect() with site %s and base path %q = %s, want %s", tt.site, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestLoginState(t *testing.T) {
+	o := newTestOIDC()
+
+	w := httptest.NewRecorder()
+	o.login(w, httptest.NewRequest(http.MethodGet, LoginPath+"?rd=/guides", nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	to, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := to.Query().Get("state")
+
+	var cookie *http.Cookie
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == o.sessions.cookie+loginSuffix {
+			cookie = c
+		}
+	}
+
+	if cookie == nil || cookie.Value != state || !cookie.HttpOnly || cookie.Path != CallbackPath {
+		t.Fatalf("state cookie = %v, want the state %s for the callback only", cookie, state)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		want   int
+	}{
+		{name: "another browser", want: http.StatusBadRequest},
+		{name: "another sign in", cookie: "other", want: http.StatusBadRequest},
+		{name: "browser that started it", cookie: state, want: http.StatusForbidden}, // Refused by the identity provider
+		{name: "completed", cookie: state, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, CallbackPath+"?error=access_denied&state="+url.QueryEscape(state), nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: o.sessions.cookie + loginSuffix, Value: tt.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			o.callback(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("callback status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginPendingLimit(t *testing.T) {
+	o := newTestOIDC()
+
+	for i := 0; i < maxPending; i++ {
+		o.pending[strconv.Itoa(i)] = &login{expires: time.Now().Add(time.Minute)}
+	}
+
+	w := httptest.NewRecorder()
+	o.login(w, httptest.NewRequest(http.MethodGet, LoginPath, nil))
+
+	if w.Code != http.StatusServiceUnavailable || len(o.pending) != maxPending {
+		t.Errorf("login with %d pending status = %d, pending %d, want refused", maxPending, w.Code, len(o.pending))
+	}
+
+	// Sign ins never completed make room for others once expired.
+	o.pending["0"].expires = time.Now().Add(-time.Second)
+
+	w = httptest.NewRecorder()
+	o.login(w, httptest.NewRequest(http.MethodGet, LoginPath, nil))
+
+	if w.Code != http.StatusFound {
+		t.Errorf("login after one expired status = %d, want %d", w.Code, http.StatusFound)
+	}
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+// htpasswd authenticates readers by HTTP basic authentication against an htpasswd file, starting a
+// session once they are, so the password is not checked again on every request. Passwords hashed
+// with bcrypt (htpasswd -B) or SHA-1 (htpasswd -s) are supported. Passwords hashed with apr1, the
+// MD5 based default of htpasswd, or crypt are rejected.
+type htpasswd struct {
+	realm string
+	users map[string]string // Password hash, keyed by user name
+}
+
+func newHtpasswd() (*htpasswd, error) {
+	file := viper.GetString(config.AuthHtpasswdFile)
+	if file == "" {
+		return nil, errors.New("no htpasswd file given")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := &htpasswd{realm: viper.GetString(config.AuthHtpasswdRealm), users: make(map[string]string)}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		if !supportedHash(parts[1]) {
+			log().Warnf("Unsupported password hash of %q in %s, rehash it with bcrypt (htpasswd -B)", parts[0], file)
+		}
+
+		h.users[parts[0]] = parts[1]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	log().Debugf("Loaded %d users from %s", len(h.users), file)
+
+	return h, nil
+}
+
+func (h *htpasswd) authenticate(r *http.Request) (*User, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+
+	hash, ok := h.users[name]
+	if !ok || !matchPassword(hash, password) {
+		return nil, fmt.Errorf("invalid password for %q", name)
+	}
+
+	return &User{Name: name}, nil
+}
+
+// remember reports that the browser should be signed in for later requests, as each check of a
+// bcrypt password takes a while.
+func (h *htpasswd) remember(r *http.Request) bool {
+	return true
+}
+
+func (h *htpasswd) challenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", h.realm))
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+func matchPassword(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+
+		return subtle.ConstantTimeCompare([]byte(hash[5:]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	default:
+		return false
+	}
+}
+
+// supportedHash reports whether the password hash is one matchPassword checks.
+func supportedHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2") || strings.HasPrefix(hash, "{SHA}")
+}
+
+// token authenticates readers by a shared token, sent as a bearer token or, to sign a browser in,
+// once as the token query parameter.
+type token struct {
+	value string
+}
+
+func newToken() (*token, error) {
+	v := viper.GetString(config.AuthToken)
+	if v == "" {
+		return nil, errors.New("no token given")
+	}
+
+	return &token{value: v}, nil
+}
+
+func (t *token) authenticate(r *http.Request) (*User, error) {
+	given := ""
+
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		given = strings.TrimPrefix(h, "Bearer ")
+	} else if q := r.URL.Query().Get("token"); q != "" {
+		given = q
+	}
+
+	if given == "" {
+		return nil, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(given), []byte(t.value)) != 1 {
+		return nil, errors.New("invalid token")
+	}
+
+	return &User{Name: ProviderToken}, nil
+}
+
+// remember reports whether the token was given as a query parameter, so the browser should be
+// signed in for later requests.
+func (t *token) remember(r *http.Request) bool {
+	return r.Header.Get("Authorization") == "" && r.URL.Query().Get("token") != ""
+}
+
+// strip removes the token query parameter, when it is the token.
+func (t *token) strip(r *http.Request) {
+	q := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(q.Get("token")), []byte(t.value)) != 1 {
+		return
+	}
+
+	q.Del("token")
+	r.URL.RawQuery = q.Encode()
+}
+
+func (t *token) challenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// header trusts the user and groups named in request headers by an authenticating proxy in front
+// of the portal. The trusted proxies must be configured, and the headers of other clients are
+// ignored, as anyone could otherwise sign in as anyone by sending them.
+type header struct {
+	user      string
+	groups    string
+	separator string
+	trusted   []*net.IPNet
+}
+
+func newHeader() (*header, error) {
+	h := &header{
+		user:      viper.GetString(config.AuthHeaderUser),
+		groups:    viper.GetString(config.AuthHeaderGroups),
+		separator: viper.GetString(config.AuthHeaderSeparator),
+	}
+
+	for _, cidr := range viper.GetStringSlice(config.AuthHeaderTrusted) {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		h.trusted = append(h.trusted, n)
+	}
+
+	if len(h.trusted) == 0 {
+		return nil, fmt.Errorf("no trusted proxies given in %s", config.AuthHeaderTrusted)
+	}
+
+	return h, nil
+}
+
+func (h *header) authenticate(r *http.Request) (*User, error) {
+	name := r.Header.Get(h.user)
+	if name == "" {
+		return nil, nil
+	}
+
+	if !h.fromTrusted(r) {
+		return nil, fmt.Errorf("%s header sent by untrusted client %s", h.user, r.RemoteAddr)
+	}
+
+	u := &User{Name: name}
+
+	for _, g := range strings.Split(r.Header.Get(h.groups), h.separator) {
+		if g = strings.TrimSpace(g); g != "" {
+			u.Groups = append(u.Groups, g)
+		}
+	}
+
+	return u, nil
+}
+
+func (h *header) fromTrusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+
+	for _, n := range h.trusted {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *header) challenge(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+// sessionStore keeps signed in readers in memory, identified by a random session cookie.
+type sessionStore struct {
+	cookie string
+	ttl    time.Duration
+	secure bool // Whether cookies are only sent over HTTPS, even when it is terminated by a proxy
+
+	*sessionTable
+}
+
+// sessionTable holds the sessions of signed in readers.
+type sessionTable struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+type session struct {
+	user    *User
+	expires time.Time
+}
+
+// signedIn holds the sessions of every store, so readers stay signed in when the configuration is
+// reloaded.
+var signedIn = &sessionTable{sessions: make(map[string]*session)}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{
+		cookie:       viper.GetString(config.AuthSessionCookie),
+		ttl:          viper.GetDuration(config.AuthSessionTTL),
+		secure:       viper.GetBool(config.AuthSessionSecure),
+		sessionTable: signedIn,
+	}
+}
+
+// create starts a session for the user, setting its cookie on the response.
+func (s *sessionStore) create(w http.ResponseWriter, r *http.Request, u *User) {
+	id := randomString()
+	expires := time.Now().Add(s.ttl)
+
+	s.mu.Lock()
+	s.prune()
+	s.sessions[id] = &session{user: u, expires: expires}
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   s.secureCookie(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// secureCookie reports whether the cookies set in answer to the request are only to be sent over
+// HTTPS: when so configured, or when the request came over TLS.
+func (s *sessionStore) secureCookie(r *http.Request) bool {
+	return s.secure || r.TLS != nil
+}
+
+// user returns the user of the session of the request, or nil when it has none.
+func (s *sessionStore) user(r *http.Request) *User {
+	c, err := r.Cookie(s.cookie)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[c.Value]
+	if !ok || time.Now().After(sess.expires) {
+		return nil
+	}
+
+	return sess.user
+}
+
+// delete ends the session of the request, clearing its cookie.
+func (s *sessionStore) delete(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(s.cookie); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, c.Value)
+		s.mu.Unlock()
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: s.cookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+// strip removes the session cookie from the request, keeping any others.
+func (s *sessionStore) strip(r *http.Request) {
+	if _, err := r.Cookie(s.cookie); err != nil {
+		return
+	}
+
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+
+	for _, c := range cookies {
+		if c.Name != s.cookie {
+			r.AddCookie(c)
+		}
+	}
+}
+
+// prune forgets expired sessions. The caller holds the lock.
+func (s *sessionStore) prune() {
+	now := time.Now()
+
+	for id, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// maxCredentials caps the credentials remembered, as each request with a valid credential may add one.
+const maxCredentials = 10000
+
+// credentials remembers the Authorization headers readers were recently authenticated by, keyed by
+// their hash, so that their clients can be told apart before the request is authenticated.
+type credentials struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]*session
+}
+
+func newCredentials(ttl time.Duration) *credentials {
+	return &credentials{ttl: ttl, verified: make(map[[sha256.Size]byte]*session)}
+}
+
+// add remembers that the credential authenticates the user, unless too many are remembered.
+func (c *credentials) add(value string, u *User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if len(c.verified) >= maxCredentials {
+		for k, sess := range c.verified {
+			if now.After(sess.expires) {
+				delete(c.verified, k)
+			}
+		}
+
+		if len(c.verified) >= maxCredentials {
+			return
+		}
+	}
+
+	c.verified[sha256.Sum256([]byte(value))] = &session{user: u, expires: now.Add(c.ttl)}
+}
+
+// user returns the user the credential recently authenticated, or nil when it is not remembered.
+func (c *credentials) user(value string) *User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sess, ok := c.verified[sha256.Sum256([]byte(value))]
+	if !ok || time.Now().After(sess.expires) {
+		return nil
+	}
+
+	return sess.user
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
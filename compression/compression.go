@@ -0,0 +1,170 @@
+// Package compression encodes responses with brotli or gzip, as negotiated with the client. Static
+// assets and specifications are compressed once, when they are loaded; pages and the mock API are
+// compressed as they are served.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+// The content codings supported, in order of preference.
+const (
+	Brotli = "br"
+	Gzip   = "gzip"
+)
+
+var encodings = []string{Brotli, Gzip}
+
+// Variants holds the encodings of some content, by content coding. Only the encodings smaller than
+// the content are held.
+type Variants map[string][]byte
+
+// Precompress returns the encodings of content of the media type, compressed as much as they can
+// be, or nil when compression is disabled, or the content is too small or already compressed.
+func Precompress(contentType string, b []byte) Variants {
+	if !viper.GetBool(config.CompressionEnabled) || len(b) < viper.GetInt(config.CompressionMinSize) {
+		return nil
+	}
+
+	if !Compressible(contentType) {
+		return nil
+	}
+
+	v := make(Variants, len(encodings))
+
+	var buf bytes.Buffer
+
+	bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := bw.Write(b); err == nil && bw.Close() == nil && buf.Len() < len(b) {
+		v[Brotli] = append([]byte(nil), buf.Bytes()...)
+	}
+
+	buf.Reset()
+
+	gw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if _, err := gw.Write(b); err == nil && gw.Close() == nil && buf.Len() < len(b) {
+		v[Gzip] = append([]byte(nil), buf.Bytes()...)
+	}
+
+	if len(v) == 0 {
+		return nil
+	}
+
+	return v
+}
+
+// Compressible reports whether content of the media type is worth compressing, being text rather
+// than already compressed images, fonts or archives.
+func Compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		strings.HasSuffix(mt, "json"),
+		strings.HasSuffix(mt, "xml"),
+		strings.HasSuffix(mt, "javascript"),
+		strings.HasSuffix(mt, "yaml"),
+		mt == "image/svg+xml":
+		return true
+	}
+
+	return false
+}
+
+// Negotiate returns the content coding preferred by the client of those offered, or "" when the
+// response should not be encoded.
+func Negotiate(r *http.Request, offered ...string) string {
+	accepted := acceptEncoding(r.Header.Get("Accept-Encoding"))
+
+	best, bestQ := "", 0.0
+
+	for _, enc := range offered {
+		q, ok := accepted[enc]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+// Offered returns the content codings of the variants, in order of preference.
+func (v Variants) Offered() []string {
+	offered := make([]string, 0, len(v))
+
+	for _, enc := range encodings {
+		if _, ok := v[enc]; ok {
+			offered = append(offered, enc)
+		}
+	}
+
+	return offered
+}
+
+// acceptEncoding parses the Accept-Encoding header into the quality of each content coding.
+func acceptEncoding(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+
+		enc := strings.ToLower(strings.TrimSpace(fields[0]))
+		if enc == "" {
+			continue
+		}
+
+		q := 1.0
+
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		accepted[enc] = q
+	}
+
+	return accepted
+}
+
+// TagETag returns the entity tag of the encoding of the content tagged by etag, so the encodings
+// of a representation are told apart.
+func TagETag(etag, enc string) string {
+	if enc == "" || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+
+	return strings.TrimSuffix(etag, `"`) + "-" + enc + `"`
+}
+
+// untagETags adds the entity tags of the unencoded content to those of its encoding in a conditional
+// request header, so they compare with the entity tags of content yet to be compressed, as well as
+// with those of content already compressed.
+func untagETags(header, enc string) string {
+	untagged := strings.ReplaceAll(header, "-"+enc+`"`, `"`)
+	if untagged == header {
+		return header
+	}
+
+	return header + ", " + untagged
+}
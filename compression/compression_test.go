@@ -0,0 +1,64 @@
+package compression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept  string
+		offered []string
+		want    string
+	}{
+		{accept: "", offered: encodings, want: ""},
+		{accept: "gzip, deflate, br", offered: encodings, want: Brotli},
+		{accept: "gzip", offered: encodings, want: Gzip},
+		{accept: "br;q=0.5, gzip;q=0.8", offered: encodings, want: Gzip},
+		{accept: "br;q=0, gzip;q=0", offered: encodings, want: ""},
+		{accept: "*", offered: encodings, want: Brotli},
+		{accept: "*;q=0.1, br;q=0", offered: encodings, want: Gzip},
+		{accept: "GZIP", offered: encodings, want: Gzip},
+		{accept: "br", offered: []string{Gzip}, want: ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+
+		if got := Negotiate(req, tt.offered...); got != tt.want {
+			t.Errorf("Negotiate(%q, %v) = %q, want %q", tt.accept, tt.offered, got, tt.want)
+		}
+	}
+}
+
+func TestETags(t *testing.T) {
+	if got := TagETag(`"abc"`, Gzip); got != `"abc-gzip"` {
+		t.Errorf("TagETag() = %s, want \"abc-gzip\"", got)
+	}
+
+	if got := TagETag(`W/"abc"`, ""); got != `W/"abc"` {
+		t.Errorf("TagETag() without an encoding = %s, want it unchanged", got)
+	}
+
+	if got := untagETags(`"abc-br", "def"`, Brotli); got != `"abc-br", "def", "abc", "def"` {
+		t.Errorf("untagETags() = %s, want the unencoded entity tags added", got)
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"text/html; charset=utf-8": true,
+		"application/json":         true,
+		"application/problem+json": true,
+		"application/javascript":   true,
+		"image/svg+xml":            true,
+		"image/png":                false,
+		"application/zip":          false,
+		"":                         false,
+	} {
+		if got := Compressible(contentType); got != want {
+			t.Errorf("Compressible(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
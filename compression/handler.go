@@ -0,0 +1,239 @@
+package compression
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+// brotliLevel trades compression for speed when compressing responses as they are served.
+const brotliLevel = 4
+
+var (
+	gzipWriters   = sync.Pool{New: func() interface{} { return gzip.NewWriter(ioutil.Discard) }}
+	brotliWriters = sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(ioutil.Discard, brotliLevel) }}
+)
+
+// encoder compresses to a writer, and can be flushed part way through.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// Middleware returns middleware compressing responses as they are served, when the client accepts
+// it. Responses smaller than the configured minimum size, already encoded, partial or of media types
+// not worth compressing are served as they are.
+func Middleware() func(http.Handler) http.Handler {
+	enabled := viper.GetBool(config.CompressionEnabled)
+	minSize := viper.GetInt(config.CompressionMinSize)
+
+	return func(h http.Handler) http.Handler {
+		if !enabled {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			enc := Negotiate(r, encodings...)
+			if enc == "" || r.Method == http.MethodHead {
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			// Conditional requests may be evaluated against the unencoded content.
+			for _, name := range []string{"If-None-Match", "If-Match"} {
+				if v := r.Header.Get(name); v != "" {
+					r.Header.Set(name, untagETags(v, enc))
+				}
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: enc, minSize: minSize}
+			defer cw.close()
+
+			h.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter holds back the start of a response until it can tell whether it is worth
+// compressing, then compresses the rest as it is written.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+
+		return
+	}
+
+	w.status = code
+
+	h := w.Header()
+	if !bodyAllowed(code) || h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		if code == http.StatusNotModified {
+			h.Set("ETag", TagETag(h.Get("ETag"), w.encoding))
+		}
+
+		_ = w.start(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush sends what has been written so far, compressing it when the response is compressible
+// whatever its size, as streamed responses may never reach the minimum.
+func (w *compressWriter) Flush() {
+	if w.status != 0 && !w.decided {
+		_ = w.start(true)
+	}
+
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer, for http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// start writes the header and what has been held back, compressing the response from then on when
+// asked to and it is of a compressible media type.
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+
+	h := w.Header()
+
+	if compress {
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+
+		compress = Compressible(h.Get("Content-Type"))
+	}
+
+	if compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		h.Add("Vary", "Accept-Encoding")
+		h.Set("ETag", TagETag(h.Get("ETag"), w.encoding))
+
+		w.enc = w.encoder()
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	buf := w.buf
+	w.buf = nil
+
+	if w.enc != nil {
+		_, err := w.enc.Write(buf)
+
+		return err
+	}
+
+	_, err := w.ResponseWriter.Write(buf)
+
+	return err
+}
+
+func (w *compressWriter) encoder() encoder {
+	var e encoder
+
+	if w.encoding == Brotli {
+		e = brotliWriters.Get().(*brotli.Writer)
+	} else {
+		e = gzipWriters.Get().(*gzip.Writer)
+	}
+
+	e.Reset(w.ResponseWriter)
+
+	return e
+}
+
+// close writes out a response smaller than the minimum size, or ends the compressed stream.
+func (w *compressWriter) close() {
+	if w.status == 0 {
+		return
+	}
+
+	if !w.decided {
+		if err := w.start(false); err != nil {
+			log().Debugf("Error writing response: %s", err)
+		}
+	}
+
+	if w.enc == nil {
+		return
+	}
+
+	if err := w.enc.Close(); err != nil {
+		log().Debugf("Error compressing response: %s", err)
+	}
+
+	switch e := w.enc.(type) {
+	case *brotli.Writer:
+		e.Reset(ioutil.Discard)
+		brotliWriters.Put(e)
+	case *gzip.Writer:
+		e.Reset(ioutil.Discard)
+		gzipWriters.Put(e)
+	}
+
+	w.enc = nil
+}
+
+// bodyAllowed reports whether a response with the status may have a body.
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
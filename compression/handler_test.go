@@ -0,0 +1,163 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+func TestMiddleware(t *testing.T) {
+	large := strings.Repeat("compress me ", 200)
+
+	tests := []struct {
+		name        string
+		method      string
+		accept      string
+		contentType string
+		encoded     string // Content-Encoding set by the handler
+		status      int
+		body        string
+		wantEnc     string
+	}{
+		{name: "brotli preferred", accept: "gzip, br", contentType: "text/html", body: large, wantEnc: Brotli},
+		{name: "gzip", accept: "gzip", contentType: "application/json", body: large, wantEnc: Gzip},
+		{name: "not accepted", contentType: "text/html", body: large},
+		{name: "below the minimum size", accept: "gzip", contentType: "text/html", body: "small"},
+		{name: "not compressible", accept: "gzip", contentType: "image/png", body: large},
+		{name: "already encoded", accept: "gzip", contentType: "text/html", encoded: "identity", body: large},
+		{name: "head", method: http.MethodHead, accept: "gzip", contentType: "text/html"},
+		{name: "no content", accept: "gzip", status: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Restore()
+
+			h := Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+
+				if tt.encoded != "" {
+					w.Header().Set("Content-Encoding", tt.encoded)
+				}
+
+				w.Header().Set("ETag", `"tag"`)
+
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+
+				_, _ = w.Write([]byte(tt.body))
+			}))
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req := httptest.NewRequest(method, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			wantETag := TagETag(`"tag"`, tt.wantEnc)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEnc && got != tt.encoded {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEnc)
+			}
+
+			if got := w.Header().Get("ETag"); got != wantETag {
+				t.Errorf("ETag = %s, want %s", got, wantETag)
+			}
+
+			if got := decode(t, tt.wantEnc, w.Body.Bytes()); got != tt.body {
+				t.Errorf("body decoded = %d bytes, want %d", len(got), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestMiddlewareNotModified(t *testing.T) {
+	config.Restore()
+
+	h := Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The handler compares with the entity tag of the content it has yet to compress.
+		if strings.Contains(r.Header.Get("If-None-Match"), `"tag"`) {
+			w.Header().Set("ETag", `"tag"`)
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("changed"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", `"tag-gzip"`)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotModified || w.Header().Get("ETag") != `"tag-gzip"` {
+		t.Errorf("status = %d, ETag = %s, want 304 with the entity tag of the encoding", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	config.Restore()
+	viper.Set(config.CompressionEnabled, false)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(bytes.Repeat([]byte("a"), 4096))
+	})).ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q when compression is disabled, want none", got)
+	}
+}
+
+// decode returns the body decoded from the content coding.
+func decode(t *testing.T, enc string, b []byte) string {
+	t.Helper()
+
+	var (
+		out []byte
+		err error
+	)
+
+	switch enc {
+	case Gzip:
+		zr, zerr := gzip.NewReader(bytes.NewReader(b))
+		if zerr != nil {
+			t.Fatal(zerr)
+		}
+
+		out, err = ioutil.ReadAll(zr)
+	case Brotli:
+		out, err = ioutil.ReadAll(brotli.NewReader(bytes.NewReader(b)))
+	default:
+		out = b
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out)
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -11,16 +14,96 @@ import (
 const (
 	cfgDirKey = "config-dir"
 	LogLevel  = "log-level"
+	LogFormat = "log-format"
+	LogFile   = "log-file"
 	Help      = "help"
 	Version   = "version"
 
 	BindAddr           = "bind-addr"
+	MetricsAddr        = "metrics-addr"
 	TLSCert            = "tls-certificate"
 	TLSKey             = "tls-key"
 	SiteURL            = "site-url"
+	BasePath           = "base-path"
+	ForwardedHeaders   = "forwarded-headers"
 	ProxyPath          = "proxy.path"
+	ProxyAuto          = "proxy.auto"
+	ProxyValidate      = "proxy.validate"
+	ProxyValidateMax   = "proxy.validate-max-body"
+	ProxyConformance   = "proxy.conformance"
+	ProxyConformMax    = "proxy.conformance-max-body"
+	ProxyMode          = "proxy.mode"
+	ProxyFixturesDir   = "proxy.fixtures-dir"
+	ProxyReplayMatch   = "proxy.replay.match"
+	ProxyRecordMax     = "proxy.record.max-body"
 	DocumentRewriteURL = "document.rewrite.url"
 	AllowOrigin        = "allow.origin"
+	Environments       = "environments"
+
+	// log file rotation.
+	LogMaxSize    = "log.max-size"
+	LogMaxBackups = "log.max-backups"
+
+	// tracing.
+	TracingEndpoint    = "tracing.endpoint"
+	TracingInsecure    = "tracing.insecure"
+	TracingSampleRatio = "tracing.sample-ratio"
+	TracingServiceName = "tracing.service-name"
+
+	// server.
+	ServerReadTimeout       = "server.read-timeout"
+	ServerReadHeaderTimeout = "server.read-header-timeout"
+	ServerWriteTimeout      = "server.write-timeout"
+	ServerIdleTimeout       = "server.idle-timeout"
+	ServerMaxHeaderBytes    = "server.max-header-bytes"
+	ServerShutdownTimeout   = "server.shutdown-timeout"
+
+	// proxy timeouts.
+	ProxyTimeout               = "proxy.timeout"
+	ProxyDialTimeout           = "proxy.dial-timeout"
+	ProxyResponseHeaderTimeout = "proxy.response-header-timeout"
+	ProxyFlushInterval         = "proxy.flush-interval"
+
+	// compression.
+	CompressionEnabled = "compression.enabled"
+	CompressionMinSize = "compression.min-size"
+	CompressionProxy   = "compression.proxy"
+
+	// render cache.
+	RenderCacheEnabled = "render.cache.enabled"
+	RenderCacheMaxSize = "render.cache.max-size"
+	RenderCacheWarm    = "render.cache.warm"
+
+	// timeout.
+	TimeoutPages = "timeout.pages"
+	TimeoutSpecs = "timeout.specs"
+
+	// ratelimit.
+	RateLimitPages = "ratelimit.pages"
+	RateLimitSpecs = "ratelimit.specs"
+	RateLimitProxy = "ratelimit.proxy"
+
+	// auth.
+	AuthProvider         = "auth.provider"
+	AuthRequired         = "auth.required"
+	AuthRules            = "auth.rules"
+	AuthHtpasswdFile     = "auth.htpasswd.file"
+	AuthHtpasswdRealm    = "auth.htpasswd.realm"
+	AuthToken            = "auth.token.value"
+	AuthHeaderUser       = "auth.header.user"
+	AuthHeaderGroups     = "auth.header.groups"
+	AuthHeaderSeparator  = "auth.header.separator"
+	AuthHeaderTrusted    = "auth.header.trusted-proxies"
+	AuthOIDCIssuer       = "auth.oidc.issuer"
+	AuthOIDCClientID     = "auth.oidc.client-id"
+	AuthOIDCClientSecret = "auth.oidc.client-secret"
+	AuthOIDCRedirectURL  = "auth.oidc.redirect-url"
+	AuthOIDCScopes       = "auth.oidc.scopes"
+	AuthOIDCUserClaim    = "auth.oidc.user-claim"
+	AuthOIDCGroupsClaim  = "auth.oidc.groups-claim"
+	AuthSessionTTL       = "auth.session.ttl"
+	AuthSessionCookie    = "auth.session.cookie"
+	AuthSessionSecure    = "auth.session.secure"
 
 	// assets.
 	DefaultAssetsDir = "default-assets-dir"
@@ -37,6 +120,15 @@ const (
 	SpecDefaultHost = "spec.default.host"
 	SpecRewriteURL  = "spec.rewrite.url"
 	ForceSpecList   = "force-specification-list"
+
+	// git.
+	GitRepository = "git-repository"
+	GitRefs       = "git-refs"
+	GitLatestTag  = "git-latest-tag"
+
+	// mock.
+	MockEnabled  = "mock.enabled"
+	MockFallback = "mock.fallback"
 )
 
 var defaultConfigPaths = []string{
@@ -47,6 +139,10 @@ var defaultConfigPaths = []string{
 // C holds a reference to struct instance for configurations used within template files.
 var C config
 
+// applied is the content of the configuration file in use, restored when a configuration reloaded
+// is not applied.
+var applied []byte
+
 type config struct {
 	ShowAssets bool `mapstructure:"author-show-assets"`
 }
@@ -54,25 +150,34 @@ type config struct {
 func init() {
 	pflag.String(cfgDirKey, "", "Directory of config file")
 	pflag.String(LogLevel, "info", "Logging level ('error', 'warn', 'info', 'debug', 'trace')")
+	pflag.String(LogFormat, "text", "Logging format ('text', 'json')")
+	pflag.String(LogFile, "", "File to write logs to, rotated by size, instead of stderr")
 	pflag.BoolP(Version, "V", false, "Display version")
 
 	pflag.String(BindAddr, "localhost:3123", "Bind address")
+	pflag.String(MetricsAddr, "", "Bind address to serve Prometheus metrics on at /metrics, apart from the documentation. Not served when empty")
 	pflag.String(TLSCert, "", "The fully qualified path to the TLS certificate file. For HTTP over TLS (HTTPS) both a certificate and a key must be provided")
 	pflag.String(TLSKey, "", "The fully qualified path to the TLS private key file. For HTTP over TLS (HTTPS) both a certificate and a key must be provided")
 	pflag.String(SiteURL, "http://localhost:3123/", "Public URL of the documentation service")
+	pflag.String(BasePath, "", "Path prefix to serve the documentation service under, such as /developer")
+	pflag.Bool(ForwardedHeaders, false, "Honor the X-Forwarded-Prefix, X-Forwarded-Host and X-Forwarded-Proto headers. Only enable behind a trusted reverse proxy that sets them, as clients could otherwise forge them")
 
-	pflag.String(DefaultAssetsDir, "assets", "Default assets directory")
-	pflag.String(AssetsDir, "", "Assets to serve. Effectively the document root")
+	pflag.String(DefaultAssetsDir, "", "Directory or zip/tar archive of default assets to use in place of those compiled in")
+	pflag.String(AssetsDir, "", "Assets to serve, from a directory or zip/tar archive. Effectively the document root")
 	pflag.Bool(ShowAssets, false, "Display at the foot of each page the overlay asset paths, in priority order, to check before rendering")
 
 	pflag.String(Theme, "default", "Theme to render documentation")
-	pflag.String(ThemeDir, "", "Directory containing installed themes")
+	pflag.String(ThemeDir, "", "Directory or zip/tar archive containing installed themes")
 
-	pflag.String(SpecDir, "", "OpenAPI specification (swagger) directory")
+	pflag.String(SpecDir, "", "OpenAPI specification (swagger) directory or zip/tar archive")
 	pflag.StringSlice(SpecFilename, []string{}, "The filename of the OpenAPI specification file within the spec-dir. May be multiply defined.")
 	pflag.Bool(ForceSpecList, false,
 		"Force the homepage to be the summary list of available specifications. The default when serving a single OpenAPI specification is to make the homepage the API summary.")
 
+	pflag.String(GitRepository, "", "Local git repository to publish specifications and assets from, the spec-dir and assets-dir being within it")
+	pflag.StringSlice(GitRefs, []string{}, "Ref of the git repository to publish, as ref=version to publish it as a version of the APIs, or ref=section:name to publish it as a section of its own. May be multiply defined.")
+	pflag.Bool(GitLatestTag, false, "Publish the newest tag of the git repository as the latest version, in place of the spec-dir and assets-dir")
+
 	initialize()
 }
 
@@ -89,7 +194,7 @@ func Init() {
 		viper.AddConfigPath(p)
 	}
 
-	if err := viper.ReadInConfig(); err == nil {
+	if err := readConfig(); err == nil {
 		fmt.Printf("Using config: %s\n", viper.ConfigFileUsed())
 	}
 
@@ -98,6 +203,61 @@ func Init() {
 	}
 }
 
+// Reload reads the configuration file again, for a running server to apply. It returns a function
+// restoring the configuration in use before, for when the one reloaded is not applied.
+func Reload() (func(), error) {
+	prev, prevC := applied, C
+
+	restore := func() {
+		// The configuration read is replaced, even by an empty one when there was no file before.
+		_ = viper.ReadConfig(bytes.NewReader(prev))
+		applied, C = prev, prevC
+	}
+
+	if err := readConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			restore()
+
+			return nil, err
+		}
+	}
+
+	if err := viper.Unmarshal(&C); err != nil {
+		restore()
+
+		return nil, err
+	}
+
+	return restore, nil
+}
+
+// readConfig reads the configuration file, found on the config paths the first time, keeping its
+// content to restore.
+func readConfig() error {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		if err := viper.ReadInConfig(); err != nil {
+			return err
+		}
+
+		file = viper.ConfigFileUsed()
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if err := viper.ReadConfig(bytes.NewReader(b)); err != nil {
+		return err
+	}
+
+	applied = b
+
+	return nil
+}
+
 // LoadFixture will load test fixture configuration; for testing only!
 func LoadFixture(dir string) error {
 	viper.SetConfigName("config")
@@ -115,17 +275,109 @@ func Restore() {
 
 func initialize() {
 	viper.SetDefault(AllowOrigin, []string{"*"})
+	viper.SetDefault(ForwardedHeaders, false)
+
+	viper.SetDefault(LogMaxSize, 100)
+	viper.SetDefault(LogMaxBackups, 5)
+
+	viper.SetDefault(TracingSampleRatio, 1.0)
+	viper.SetDefault(TracingServiceName, "dapperdox")
+
+	viper.SetDefault(ServerReadTimeout, "60s")
+	viper.SetDefault(ServerReadHeaderTimeout, "10s")
+	viper.SetDefault(ServerIdleTimeout, "120s")
+	viper.SetDefault(ServerMaxHeaderBytes, 1<<20)
+	viper.SetDefault(ServerShutdownTimeout, "30s")
+
+	viper.SetDefault(CompressionEnabled, true)
+	viper.SetDefault(CompressionMinSize, 1024)
+
+	viper.SetDefault(RenderCacheEnabled, true)
+	viper.SetDefault(RenderCacheMaxSize, "64MB")
+
+	viper.SetDefault(TimeoutPages, "1s")
+	viper.SetDefault(TimeoutSpecs, "10s")
+
+	viper.SetDefault(ProxyValidateMax, "1MB")
+	viper.SetDefault(ProxyConformMax, "1MB")
+	viper.SetDefault(ProxyDialTimeout, "10s")
+	viper.SetDefault(ProxyResponseHeaderTimeout, "30s")
+	viper.SetDefault(ProxyFlushInterval, "100ms")
+	viper.SetDefault(ProxyFixturesDir, "proxy-fixtures")
+	viper.SetDefault(ProxyReplayMatch, []string{"path", "query"})
+	viper.SetDefault(ProxyRecordMax, "1MB")
+
+	viper.SetDefault(AuthRequired, true)
+	viper.SetDefault(AuthHtpasswdRealm, "DapperDox")
+	viper.SetDefault(AuthHeaderUser, "X-Forwarded-User")
+	viper.SetDefault(AuthHeaderGroups, "X-Forwarded-Groups")
+	viper.SetDefault(AuthHeaderSeparator, ",")
+	viper.SetDefault(AuthOIDCScopes, []string{"openid", "profile", "email"})
+	viper.SetDefault(AuthOIDCUserClaim, "preferred_username")
+	viper.SetDefault(AuthOIDCGroupsClaim, "groups")
+	viper.SetDefault(AuthSessionTTL, "8h")
+	viper.SetDefault(AuthSessionCookie, "dapperdox-session")
 
 	viper.SetDefault(SpecFilename, []string{"/swagger.json"})
 	viper.SetDefault(SpecDefaultHost, "127.0.0.1")
 
 	_ = viper.BindEnv(cfgDirKey, "CONFIG_DIR")
 	_ = viper.BindEnv(LogLevel, "LOGLEVEL")
+	_ = viper.BindEnv(LogFormat, "LOG_FORMAT")
+	_ = viper.BindEnv(LogFile, "LOG_FILE")
+	_ = viper.BindEnv(LogMaxSize, "LOG_MAX_SIZE")
+	_ = viper.BindEnv(LogMaxBackups, "LOG_MAX_BACKUPS")
 
 	_ = viper.BindEnv(BindAddr, "BIND_ADDR")
+	_ = viper.BindEnv(MetricsAddr, "METRICS_ADDR")
 	_ = viper.BindEnv(TLSCert, "TLS_CERTIFICATE")
 	_ = viper.BindEnv(TLSKey, "TLS_KEY")
 	_ = viper.BindEnv(SiteURL, "SITE_URL")
+	_ = viper.BindEnv(BasePath, "BASE_PATH")
+	_ = viper.BindEnv(ForwardedHeaders, "FORWARDED_HEADERS")
+	_ = viper.BindEnv(ProxyAuto, "PROXY_AUTO")
+	_ = viper.BindEnv(ProxyValidate, "PROXY_VALIDATE")
+	_ = viper.BindEnv(ProxyValidateMax, "PROXY_VALIDATE_MAX_BODY")
+	_ = viper.BindEnv(ProxyConformance, "PROXY_CONFORMANCE")
+	_ = viper.BindEnv(ProxyConformMax, "PROXY_CONFORMANCE_MAX_BODY")
+	_ = viper.BindEnv(ProxyMode, "PROXY_MODE")
+	_ = viper.BindEnv(ProxyFixturesDir, "PROXY_FIXTURES_DIR")
+	_ = viper.BindEnv(ProxyTimeout, "PROXY_TIMEOUT")
+	_ = viper.BindEnv(ProxyDialTimeout, "PROXY_DIAL_TIMEOUT")
+	_ = viper.BindEnv(ProxyResponseHeaderTimeout, "PROXY_RESPONSE_HEADER_TIMEOUT")
+	_ = viper.BindEnv(ProxyFlushInterval, "PROXY_FLUSH_INTERVAL")
+
+	_ = viper.BindEnv(TracingEndpoint, "TRACING_ENDPOINT")
+	_ = viper.BindEnv(TracingInsecure, "TRACING_INSECURE")
+	_ = viper.BindEnv(TracingSampleRatio, "TRACING_SAMPLE_RATIO")
+
+	_ = viper.BindEnv(ServerReadTimeout, "SERVER_READ_TIMEOUT")
+	_ = viper.BindEnv(ServerReadHeaderTimeout, "SERVER_READ_HEADER_TIMEOUT")
+	_ = viper.BindEnv(ServerWriteTimeout, "SERVER_WRITE_TIMEOUT")
+	_ = viper.BindEnv(ServerIdleTimeout, "SERVER_IDLE_TIMEOUT")
+	_ = viper.BindEnv(ServerMaxHeaderBytes, "SERVER_MAX_HEADER_BYTES")
+	_ = viper.BindEnv(ServerShutdownTimeout, "SERVER_SHUTDOWN_TIMEOUT")
+
+	_ = viper.BindEnv(CompressionEnabled, "COMPRESSION_ENABLED")
+	_ = viper.BindEnv(CompressionMinSize, "COMPRESSION_MIN_SIZE")
+	_ = viper.BindEnv(CompressionProxy, "COMPRESSION_PROXY")
+
+	_ = viper.BindEnv(RenderCacheEnabled, "RENDER_CACHE_ENABLED")
+	_ = viper.BindEnv(RenderCacheMaxSize, "RENDER_CACHE_MAX_SIZE")
+	_ = viper.BindEnv(RenderCacheWarm, "RENDER_CACHE_WARM")
+
+	_ = viper.BindEnv(TimeoutPages, "TIMEOUT_PAGES")
+	_ = viper.BindEnv(TimeoutSpecs, "TIMEOUT_SPECS")
+
+	_ = viper.BindEnv(AuthProvider, "AUTH_PROVIDER")
+	_ = viper.BindEnv(AuthRequired, "AUTH_REQUIRED")
+	_ = viper.BindEnv(AuthHtpasswdFile, "AUTH_HTPASSWD_FILE")
+	_ = viper.BindEnv(AuthToken, "AUTH_TOKEN")
+	_ = viper.BindEnv(AuthOIDCIssuer, "AUTH_OIDC_ISSUER")
+	_ = viper.BindEnv(AuthOIDCClientID, "AUTH_OIDC_CLIENT_ID")
+	_ = viper.BindEnv(AuthOIDCClientSecret, "AUTH_OIDC_CLIENT_SECRET")
+	_ = viper.BindEnv(AuthOIDCRedirectURL, "AUTH_OIDC_REDIRECT_URL")
+	_ = viper.BindEnv(AuthSessionSecure, "AUTH_SESSION_SECURE")
 
 	_ = viper.BindEnv(DefaultAssetsDir, "DEFAULT_ASSETS_DIR")
 	_ = viper.BindEnv(AssetsDir, "ASSETS_DIR")
@@ -138,4 +390,11 @@ func initialize() {
 	_ = viper.BindEnv(SpecFilename, "SPEC_FILENAME")
 	_ = viper.BindEnv(SpecDefaultHost, "SPEC_DEFAULT_HOST")
 	_ = viper.BindEnv(ForceSpecList, "FORCE_SPECIFICATION_LIST")
+
+	_ = viper.BindEnv(GitRepository, "GIT_REPOSITORY")
+	_ = viper.BindEnv(GitRefs, "GIT_REFS")
+	_ = viper.BindEnv(GitLatestTag, "GIT_LATEST_TAG")
+
+	_ = viper.BindEnv(MockEnabled, "MOCK_ENABLED")
+	_ = viper.BindEnv(MockFallback, "MOCK_FALLBACK")
 }
@@ -0,0 +1,201 @@
+// Package gitsource publishes specifications and guides from a local git repository at the refs
+// configured, without checking them out. Each ref is published either as a version of the APIs of
+// the current documentation, or as a section of its own. The newest tag may be published as the
+// current documentation, in place of the spec-dir and assets-dir.
+package gitsource
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/vfs"
+)
+
+// sectionPrefix marks the refs published as a section of their own.
+const sectionPrefix = "section:"
+
+var validSection = regexp.MustCompile(`^[\w.-]+$`)
+
+// Ref is a ref of the git repository published.
+type Ref struct {
+	Name    string // Branch, tag or commit
+	Version string // Version of the APIs it is published as, or ""
+	Section string // Section it is published as, or ""
+	specs   fs.FS
+	assets  fs.FS
+}
+
+// Source is what is published from the git repository: the refs, and the newest tag in place of the
+// spec-dir and assets-dir when configured to. A source is not changed once loaded, so it is loaded
+// afresh when the configuration is reloaded.
+type Source struct {
+	refs   []*Ref
+	mounts map[string]fs.FS // Trees published in place of a source location
+}
+
+// Specs returns the specifications of the ref, which are in the spec-dir of its tree.
+func (r *Ref) Specs() fs.FS {
+	return r.specs
+}
+
+// Assets returns the assets of the ref, which are in the assets-dir of its tree, or nil when no
+// assets-dir is configured.
+func (r *Ref) Assets() fs.FS {
+	return r.assets
+}
+
+// Refs returns the refs published, besides the current documentation.
+func (s *Source) Refs() []*Ref {
+	if s == nil {
+		return nil
+	}
+
+	return s.refs
+}
+
+// Open returns the file system of a source location, which is the tree of the tag published in its
+// place, if any, or else the location opened by vfs.
+func (s *Source) Open(location string) (fs.FS, error) {
+	if s != nil {
+		if fsys, ok := s.mounts[location]; ok {
+			return fsys, nil
+		}
+	}
+
+	return vfs.Open(location)
+}
+
+// Load reads the refs configured from the git repository, and the newest tag in place of the
+// spec-dir and assets-dir when configured to. The trees of refs no longer published are released.
+func Load() (*Source, error) {
+	src := &Source{mounts: map[string]fs.FS{}}
+
+	repository := viper.GetString(config.GitRepository)
+	if repository == "" {
+		vfs.ReleaseTrees()
+
+		return src, nil
+	}
+
+	specDir, assetsDir := viper.GetString(config.SpecDir), viper.GetString(config.AssetsDir)
+	dirs := []string{specDir}
+
+	if assetsDir != "" {
+		dirs = append(dirs, assetsDir)
+	}
+
+	if viper.GetBool(config.GitLatestTag) {
+		tag, err := vfs.LatestTag(repository)
+		if err != nil {
+			return nil, err
+		}
+
+		fsys, err := vfs.Git(repository, tag, dirs...)
+		if err != nil {
+			return nil, err
+		}
+
+		log().Infof("Publishing tag %s of git repository %s as the latest version", tag, repository)
+
+		// The specifications are read from the working directory when no spec-dir is configured.
+		location := specDir
+		if location == "" {
+			location = "."
+		}
+
+		if src.mounts[location], err = sub(fsys, specDir); err != nil {
+			return nil, err
+		}
+
+		if assetsDir != "" {
+			if src.mounts[assetsDir], err = sub(fsys, assetsDir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, entry := range viper.GetStringSlice(config.GitRefs) {
+		ref, err := parseRef(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		fsys, err := vfs.Git(repository, ref.Name, dirs...)
+		if err != nil {
+			return nil, err
+		}
+
+		if ref.specs, err = sub(fsys, specDir); err != nil {
+			return nil, err
+		}
+
+		if assetsDir != "" {
+			if ref.assets, err = sub(fsys, assetsDir); err != nil {
+				return nil, err
+			}
+		}
+
+		if ref.Section != "" {
+			log().Infof("Publishing %s of git repository %s as section %s", ref.Name, repository, ref.Section)
+		} else {
+			log().Infof("Publishing %s of git repository %s as version %s", ref.Name, repository, ref.Version)
+		}
+
+		src.refs = append(src.refs, ref)
+	}
+
+	vfs.ReleaseTrees()
+
+	return src, nil
+}
+
+// parseRef parses a ref configured, as ref, ref=version or ref=section:name. A ref is published as
+// the version it names when no other is given.
+func parseRef(entry string) (*Ref, error) {
+	name, target := strings.TrimSpace(entry), ""
+	if i := strings.Index(name, "="); i >= 0 {
+		name, target = strings.TrimSpace(name[:i]), strings.TrimSpace(name[i+1:])
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("git ref %q names no ref", entry)
+	}
+
+	ref := &Ref{Name: name}
+
+	switch {
+	case strings.HasPrefix(target, sectionPrefix):
+		ref.Section = strings.TrimPrefix(target, sectionPrefix)
+
+		if !validSection.MatchString(ref.Section) {
+			return nil, fmt.Errorf("git ref %q is not published as a valid section name", entry)
+		}
+	case target != "":
+		ref.Version = target
+	default:
+		ref.Version = strings.TrimPrefix(strings.TrimPrefix(name, "refs/heads/"), "refs/tags/")
+	}
+
+	return ref, nil
+}
+
+// sub returns the directory dir of a tree, which is the tree itself when dir is "".
+func sub(fsys fs.FS, dir string) (fs.FS, error) {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	if dir == "" {
+		return fsys, nil
+	}
+
+	s, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("git tree directory %s: %w", dir, err)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,219 @@
+// Package basepath serves the portal under a path prefix, so it can be mounted beside other sites
+// behind an ingress. The prefix is the base path configured, after any prefix a reverse proxy
+// stripped from the request and forwarded in X-Forwarded-Prefix. Routes are registered without the
+// prefix, which is removed before requests are routed, and added back to the links and redirects
+// sent to the reader. The forwarded headers are only honored when enabled, as they are to be set by
+// a trusted reverse proxy rather than the client. The health endpoints are not under the prefix, but
+// at the root, where orchestrators probe the portal directly rather than through the ingress.
+package basepath
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+// The headers reverse proxies forward the original request in.
+const (
+	ForwardedPrefix = "X-Forwarded-Prefix"
+	ForwardedHost   = "X-Forwarded-Host"
+	ForwardedProto  = "X-Forwarded-Proto"
+)
+
+var (
+	validPrefix = regexp.MustCompile(`^(/[\w.~%!$&'()*+,;=:@-]+)+$`)
+	validHost   = regexp.MustCompile(`^([\w.-]+|\[[0-9A-Fa-f:.]+\])(:\d+)?$`)
+)
+
+type (
+	prefixKey struct{}
+	siteKey   struct{}
+)
+
+// served is the public URL of the portal, as the handler serving the request was configured.
+type served struct {
+	site      string
+	forwarded bool // Whether the headers of reverse proxies are honored
+}
+
+// Configured returns the base path configured, cleaned and without a trailing slash, or "" when the
+// portal is served from the root.
+func Configured() string {
+	p := strings.Trim(viper.GetString(config.BasePath), "/")
+	if p == "" {
+		return ""
+	}
+
+	return path.Clean("/" + p)
+}
+
+// Handler removes the prefix from the path of requests before they are routed, answering those
+// outside it as not found, and keeps the prefix for the links of the pages served.
+func Handler(h http.Handler) http.Handler {
+	base := Configured()
+	forwarded := viper.GetBool(config.ForwardedHeaders)
+	public := served{site: viper.GetString(config.SiteURL), forwarded: forwarded}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := base
+
+		if forwarded {
+			// The pages differ with the prefix they are reached at.
+			w.Header().Add("Vary", ForwardedPrefix)
+
+			prefix = forwardedPrefix(r) + base
+		}
+
+		// The root of the portal is the base path with a trailing slash, as for a directory.
+		if base != "" && r.URL.Path == base {
+			u := *r.URL
+			u.Path = prefix + "/"
+			u.RawPath = ""
+			http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+
+			return
+		}
+
+		if base != "" {
+			var ok bool
+			if r, ok = strip(r, base); !ok {
+				http.NotFound(w, r)
+
+				return
+			}
+		}
+
+		ctx := NewContext(r.Context(), prefix)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(ctx, siteKey{}, public)))
+	})
+}
+
+// strip returns a copy of the request with the base path removed from its path, or false when the
+// path is not under the base path: /developerfoo is not under /developer.
+func strip(r *http.Request, base string) (*http.Request, bool) {
+	p, ok := under(r.URL.Path, base)
+	if !ok {
+		return r, false
+	}
+
+	rp, ok := under(r.URL.RawPath, base)
+	if r.URL.RawPath != "" && !ok {
+		return r, false
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = p
+	r2.URL.RawPath = rp
+
+	return r2, true
+}
+
+// under returns the path below the base path, keeping its leading slash.
+func under(p, base string) (string, bool) {
+	if !strings.HasPrefix(p, base+"/") {
+		return "", false
+	}
+
+	return p[len(base):], true
+}
+
+// NewContext returns a copy of the context of a request for a page of the portal served under the
+// prefix given, as requests passed on by the handler are, without a request having been.
+func NewContext(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, prefixKey{}, prefix)
+}
+
+// Prefix returns the path prefix the portal is served under for the request, without a trailing
+// slash, or "" when it is served from the root. Without a request, it is the base path configured.
+func Prefix(r *http.Request) string {
+	if r != nil {
+		if p, ok := r.Context().Value(prefixKey{}).(string); ok {
+			return p
+		}
+	}
+
+	return Configured()
+}
+
+// URL returns the path of a page of the portal, as reached by the request.
+func URL(r *http.Request, p string) string {
+	return Prefix(r) + p
+}
+
+// Redirect redirects the request to a page of the portal.
+func Redirect(w http.ResponseWriter, r *http.Request, p string, code int) {
+	http.Redirect(w, r, URL(r, p), code)
+}
+
+// SiteURL returns the public URL of the portal for the request: the site URL configured, at the
+// host, scheme and prefix a reverse proxy forwarded the request from. Without a request, it is the
+// site URL configured.
+func SiteURL(r *http.Request) string {
+	if r == nil {
+		return viper.GetString(config.SiteURL)
+	}
+
+	public, ok := r.Context().Value(siteKey{}).(served)
+	if !ok {
+		return viper.GetString(config.SiteURL)
+	}
+
+	site := public.site
+	if !public.forwarded {
+		return site
+	}
+
+	host, proto, prefix := forwardedValue(r, ForwardedHost), forwardedValue(r, ForwardedProto), forwardedPrefix(r)
+	if host == "" && proto == "" && prefix == "" {
+		return site
+	}
+
+	u, err := url.Parse(site)
+	if err != nil {
+		return site
+	}
+
+	if validHost.MatchString(host) {
+		u.Host = host
+	}
+
+	if proto == "http" || proto == "https" {
+		u.Scheme = proto
+	}
+
+	u.Path = prefix + u.Path
+
+	return u.String()
+}
+
+// forwardedPrefix returns the prefix a reverse proxy stripped from the request, or "" when it sent
+// none, or one that is not a plain path.
+func forwardedPrefix(r *http.Request) string {
+	p := strings.TrimSuffix(forwardedValue(r, ForwardedPrefix), "/")
+	if !validPrefix.MatchString(p) || path.Clean(p) != p {
+		return ""
+	}
+
+	return p
+}
+
+// forwardedValue returns the value a header was forwarded with by the reverse proxy nearest the
+// client, which is the first of a list.
+func forwardedValue(r *http.Request, header string) string {
+	v := r.Header.Get(header)
+	if i := strings.IndexByte(v, ','); i >= 0 {
+		v = v[:i]
+	}
+
+	return strings.TrimSpace(v)
+}
@@ -0,0 +1,153 @@
+package basepath
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		forwarded bool
+		target    string
+		headers   map[string]string
+		wantCode  int
+		wantPath  string // Path routed
+		wantLink  string // URL of the page /guides
+		wantSite  string
+		wantTo    string // Location redirected to
+	}{
+		{
+			name:     "root",
+			target:   "/reference",
+			wantCode: http.StatusOK,
+			wantPath: "/reference",
+			wantLink: "/guides",
+			wantSite: "https://docs.example.com/",
+		},
+		{
+			name:     "base path stripped",
+			base:     "developer/",
+			target:   "/developer/reference",
+			wantCode: http.StatusOK,
+			wantPath: "/reference",
+			wantLink: "/developer/guides",
+			wantSite: "https://docs.example.com/",
+		},
+		{
+			name:     "outside the base path",
+			base:     "/developer",
+			target:   "/reference",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "path sharing the start of the base path",
+			base:     "/developer",
+			target:   "/developerfoo/bar",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "escaped path stripped",
+			base:     "/developer",
+			target:   "/developer/guides/a%2Fb",
+			wantCode: http.StatusOK,
+			wantPath: "/guides/a/b",
+			wantLink: "/developer/guides",
+			wantSite: "https://docs.example.com/",
+		},
+		{
+			name:     "base path redirected to its root",
+			base:     "/developer",
+			target:   "/developer?v=1",
+			wantCode: http.StatusMovedPermanently,
+			wantTo:   "/developer/?v=1",
+		},
+		{
+			name:     "forwarded headers ignored by default",
+			base:     "/developer",
+			target:   "/developer/reference",
+			headers:  map[string]string{ForwardedPrefix: "/portal", ForwardedHost: "evil.example.com"},
+			wantCode: http.StatusOK,
+			wantPath: "/reference",
+			wantLink: "/developer/guides",
+			wantSite: "https://docs.example.com/",
+		},
+		{
+			name:      "forwarded prefix, host and scheme",
+			base:      "/developer",
+			forwarded: true,
+			target:    "/developer/reference",
+			headers:   map[string]string{ForwardedPrefix: "/portal/, /other", ForwardedHost: "portal.example.com", ForwardedProto: "http"},
+			wantCode:  http.StatusOK,
+			wantPath:  "/reference",
+			wantLink:  "/portal/developer/guides",
+			wantSite:  "http://portal.example.com/portal/",
+		},
+		{
+			name:      "forwarded prefix redirected to",
+			base:      "/developer",
+			forwarded: true,
+			target:    "/developer",
+			headers:   map[string]string{ForwardedPrefix: "/portal"},
+			wantCode:  http.StatusMovedPermanently,
+			wantTo:    "/portal/developer/",
+		},
+		{
+			name:      "invalid forwarded values ignored",
+			forwarded: true,
+			target:    "/reference",
+			headers:   map[string]string{ForwardedPrefix: "/portal/../admin", ForwardedHost: "evil.example.com/path", ForwardedProto: "javascript"},
+			wantCode:  http.StatusOK,
+			wantPath:  "/reference",
+			wantLink:  "/guides",
+			wantSite:  "https://docs.example.com/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Restore()
+			viper.Set(config.SiteURL, "https://docs.example.com/")
+			viper.Set(config.BasePath, tt.base)
+
+			if tt.forwarded {
+				viper.Set(config.ForwardedHeaders, true)
+			}
+
+			var gotPath, gotLink, gotSite string
+
+			h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath, gotLink, gotSite = r.URL.Path, URL(r, "/guides"), SiteURL(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("GET %s status = %d, want %d", tt.target, w.Code, tt.wantCode)
+			}
+
+			if got := w.Header().Get("Location"); got != tt.wantTo {
+				t.Errorf("Location = %q, want %q", got, tt.wantTo)
+			}
+
+			if gotPath != tt.wantPath || gotLink != tt.wantLink || gotSite != tt.wantSite {
+				t.Errorf("routed %q, link %q, site %q, want %q, %q, %q", gotPath, gotLink, gotSite, tt.wantPath, tt.wantLink, tt.wantSite)
+			}
+
+			if vary := w.Header().Get("Vary"); (vary == ForwardedPrefix) != tt.forwarded {
+				t.Errorf("Vary = %q with forwarded headers honored %v", vary, tt.forwarded)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Package cache sets validators on responses and answers conditional requests, so browsers can
+// revalidate pages, specifications and static assets instead of fetching them again.
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/kenjones-cisco/dapperdox/auth"
+	"github.com/kenjones-cisco/dapperdox/compression"
+)
+
+const (
+	// Revalidate has clients check with the server before using what they cached.
+	Revalidate = "no-cache"
+	// Immutable has clients use what they cached, for content at fingerprinted paths.
+	Immutable = "max-age=31536000, immutable"
+)
+
+// ETag returns a strong entity tag derived from the content.
+func ETag(b []byte) string {
+	sum := sha256.Sum256(b)
+
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// ServeContent writes the content with its ETag, Last-Modified and the given Cache-Control
+// directive, answering 304 Not Modified to conditional requests it satisfies, and serving ranges.
+// The Content-Type header should be set beforehand.
+func ServeContent(w http.ResponseWriter, r *http.Request, content []byte, modTime time.Time, directive string) {
+	ServeEncoded(w, r, content, nil, modTime, directive)
+}
+
+// ServeEncoded serves the content as ServeContent does, or the encoding of it preferred by the
+// client, each encoding having an ETag of its own.
+func ServeEncoded(w http.ResponseWriter, r *http.Request, content []byte, variants compression.Variants, modTime time.Time, directive string) {
+	h := w.Header()
+
+	etag := h.Get("ETag")
+	if etag == "" {
+		etag = ETag(content)
+	}
+
+	if len(variants) > 0 {
+		h.Add("Vary", "Accept-Encoding")
+
+		if enc := compression.Negotiate(r, variants.Offered()...); enc != "" {
+			content = variants[enc]
+			etag = compression.TagETag(etag, enc)
+
+			h.Set("Content-Encoding", enc)
+		}
+	}
+
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", scope(r)+", "+directive)
+
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(content))
+}
+
+// scope keeps responses out of shared caches when readers sign in, as what they are shown depends
+// on who they are.
+func scope(r *http.Request) string {
+	if auth.Enabled(r) {
+		return "private"
+	}
+
+	return "public"
+}
+
+// Validate returns middleware that buffers successful GET and HEAD responses without an ETag, and
+// serves them with a content ETag and the given modification time, so they must be revalidated.
+func Validate(modTime time.Time) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			bw := &bufferWriter{ResponseWriter: w}
+
+			h.ServeHTTP(bw, r)
+
+			if bw.passed {
+				return
+			}
+
+			ServeContent(w, r, bw.buf.Bytes(), modTime, Revalidate)
+		})
+	}
+}
+
+// bufferWriter holds back successful responses without an ETag, passing the others straight through.
+type bufferWriter struct {
+	http.ResponseWriter
+	buf    bytes.Buffer
+	status int
+	passed bool
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.status != 0 || w.passed {
+		return
+	}
+
+	if code == http.StatusOK && w.Header().Get("ETag") == "" {
+		w.status = code
+
+		return
+	}
+
+	w.passed = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	if w.status == 0 && !w.passed {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.passed {
+		return w.ResponseWriter.Write(b)
+	}
+
+	return w.buf.Write(b)
+}
+
+// Unwrap returns the original writer, for http.ResponseController.
+func (w *bufferWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
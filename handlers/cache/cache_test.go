@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kenjones-cisco/dapperdox/compression"
+)
+
+var modTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestServeEncoded(t *testing.T) {
+	content := []byte("content")
+	variants := compression.Variants{compression.Gzip: []byte("gzipped")}
+	etag := ETag(content)
+	gzipETag := compression.TagETag(etag, compression.Gzip)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantCode int
+		wantETag string
+		wantBody string
+	}{
+		{name: "unconditional", wantCode: http.StatusOK, wantETag: etag, wantBody: "content"},
+		{name: "matching ETag", headers: map[string]string{"If-None-Match": etag}, wantCode: http.StatusNotModified, wantETag: etag},
+		{name: "other ETag", headers: map[string]string{"If-None-Match": `"other"`}, wantCode: http.StatusOK, wantETag: etag, wantBody: "content"},
+		{
+			name:     "not modified since",
+			headers:  map[string]string{"If-Modified-Since": modTime.Add(time.Hour).Format(http.TimeFormat)},
+			wantCode: http.StatusNotModified,
+			wantETag: etag,
+		},
+		{
+			name:     "encoded",
+			headers:  map[string]string{"Accept-Encoding": "gzip"},
+			wantCode: http.StatusOK,
+			wantETag: gzipETag,
+			wantBody: "gzipped",
+		},
+		{
+			name:     "encoding revalidated",
+			headers:  map[string]string{"Accept-Encoding": "gzip", "If-None-Match": gzipETag},
+			wantCode: http.StatusNotModified,
+			wantETag: gzipETag,
+		},
+		{
+			name:     "ETag of another encoding",
+			headers:  map[string]string{"If-None-Match": gzipETag},
+			wantCode: http.StatusOK,
+			wantETag: etag,
+			wantBody: "content",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			ServeEncoded(w, req, content, variants, modTime, Revalidate)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("ETag = %s, want %s", got, tt.wantETag)
+			}
+
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+
+			if got := w.Header().Get("Cache-Control"); got != "public, no-cache" {
+				t.Errorf("Cache-Control = %q, want public, no-cache", got)
+			}
+
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	h := Validate(modTime)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/tagged":
+			w.Header().Set("ETag", `"own"`)
+			_, _ = w.Write([]byte("tagged"))
+		default:
+			_, _ = w.Write([]byte("page"))
+		}
+	}))
+
+	etag := ETag([]byte("page"))
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		ifNoneMatch string
+		wantCode    int
+		wantETag    string
+	}{
+		{name: "page", method: http.MethodGet, target: "/", wantCode: http.StatusOK, wantETag: etag},
+		{name: "page revalidated", method: http.MethodGet, target: "/", ifNoneMatch: etag, wantCode: http.StatusNotModified, wantETag: etag},
+		{name: "head revalidated", method: http.MethodHead, target: "/", ifNoneMatch: etag, wantCode: http.StatusNotModified, wantETag: etag},
+		{name: "not a GET", method: http.MethodPost, target: "/", ifNoneMatch: etag, wantCode: http.StatusOK},
+		{name: "not found", method: http.MethodGet, target: "/missing", wantCode: http.StatusNotFound},
+		{name: "own ETag", method: http.MethodGet, target: "/tagged", ifNoneMatch: etag, wantCode: http.StatusOK, wantETag: `"own"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.target, w.Code, tt.wantCode)
+			}
+
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("%s %s ETag = %s, want %s", tt.method, tt.target, got, tt.wantETag)
+			}
+		})
+	}
+}
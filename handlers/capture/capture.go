@@ -0,0 +1,70 @@
+// Package capture records the status code and size of responses, for the middleware that logs,
+// counts and traces requests once they have been served.
+package capture
+
+import "net/http"
+
+// Writer records the status code and size of the response written through it.
+type Writer struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+// Wrap returns a writer recording the response written to w. When w records the response already, it
+// is returned as it is, so the middleware of a request share one.
+func Wrap(w http.ResponseWriter) *Writer {
+	if cw, ok := w.(*Writer); ok {
+		return cw
+	}
+
+	return &Writer{ResponseWriter: w}
+}
+
+// Status returns the status code written, which is 200 when none was, as the server answers then.
+func (w *Writer) Status() int {
+	if !w.wroteHeader {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+// Bytes returns the size of the body written.
+func (w *Writer) Bytes() int {
+	return w.bytes
+}
+
+func (w *Writer) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+		w.wroteHeader = true
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+
+	return n, err
+}
+
+// Flush passes on flushes, so streamed responses are not held back.
+func (w *Writer) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer, for http.ResponseController.
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
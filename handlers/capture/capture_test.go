@@ -0,0 +1,61 @@
+package capture
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name       string
+		write      func(w http.ResponseWriter)
+		wantStatus int
+		wantBytes  int
+	}{
+		{name: "nothing written", write: func(w http.ResponseWriter) {}, wantStatus: http.StatusOK},
+		{name: "body only", write: func(w http.ResponseWriter) { _, _ = w.Write([]byte("page")) }, wantStatus: http.StatusOK, wantBytes: 4},
+		{
+			name: "status and body",
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte("missing"))
+			},
+			wantStatus: http.StatusNotFound,
+			wantBytes:  7,
+		},
+		{
+			name: "status written twice",
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusCreated)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := Wrap(httptest.NewRecorder())
+			tt.write(w)
+
+			if w.Status() != tt.wantStatus || w.Bytes() != tt.wantBytes {
+				t.Errorf("Status(), Bytes() = %d, %d, want %d, %d", w.Status(), w.Bytes(), tt.wantStatus, tt.wantBytes)
+			}
+		})
+	}
+}
+
+func TestWrapShared(t *testing.T) {
+	rec := httptest.NewRecorder()
+	outer := Wrap(rec)
+
+	if inner := Wrap(outer); inner != outer {
+		t.Error("Wrap() of a writer recording the response already wrapped it again")
+	}
+
+	outer.Flush()
+
+	if !rec.Flushed {
+		t.Error("Flush() not passed on")
+	}
+}
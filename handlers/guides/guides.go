@@ -27,6 +27,7 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/kenjones-cisco/dapperdox/handlers/basepath"
 	"github.com/kenjones-cisco/dapperdox/navigation"
 	"github.com/kenjones-cisco/dapperdox/render"
 	"github.com/kenjones-cisco/dapperdox/render/asset"
@@ -35,22 +36,23 @@ import (
 
 const maxNavLevels = 2
 
-// Register routes for guide pages.
-func Register(r *mux.Router) {
+// Register routes for guide pages, of the specifications of the suite and the top level, rendered
+// by the renderer given.
+func Register(r *mux.Router, suite *spec.Suite, rnd *render.Renderer) {
 	log().Info("Registering guides")
 
 	// specification specific guides
-	for _, specification := range spec.APISuite {
+	for _, specification := range suite.Specs {
 		log().Debugf("- Specification guides for %q", specification.APIInfo.Title)
-		register(r, "assets/templates", specification)
+		register(r, rnd, "assets/templates", specification)
 	}
 
 	// Top level guides
 	log().Debug("- Root guides")
-	register(r, "assets/templates", nil)
+	register(r, rnd, "assets/templates", nil)
 }
 
-func register(r *mux.Router, base string, specification *spec.APISpecification) {
+func register(r *mux.Router, rnd *render.Renderer, base string, specification *spec.APISpecification) {
 	rootNode := "/guides"
 	routeBase := "/guides"
 
@@ -68,7 +70,7 @@ func register(r *mux.Router, base string, specification *spec.APISpecification)
 
 	log().Tracef("  - Walk compiled asset tree %s", pathBase)
 
-	for _, path := range asset.Names() {
+	for _, path := range rnd.Assets().Names() {
 		if !strings.HasPrefix(path, pathBase) { // Only keep assets we want
 			continue
 		}
@@ -86,7 +88,7 @@ func register(r *mux.Router, base string, specification *spec.APISpecification)
 
 			log().Tracef("      = URL  %s", route)
 
-			buildNavigation(guidesNavigation, path, pathBase, route, ext)
+			buildNavigation(rnd.Assets(), guidesNavigation, path, pathBase, route, ext)
 
 			r.Path(route).Methods(http.MethodGet).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 				sid := "TOP LEVEL"
@@ -95,7 +97,7 @@ func register(r *mux.Router, base string, specification *spec.APISpecification)
 				}
 
 				log().Tracef("Fetching guide from %q for spec ID %s", resource, sid)
-				render.HTML(w, http.StatusOK, resource, render.DefaultVars(req, specification, render.Vars{"Guide": resource}))
+				rnd.HTML(w, http.StatusOK, resource, rnd.DefaultVars(req, specification, render.Vars{"Guide": resource}))
 			})
 		}
 	}
@@ -106,11 +108,11 @@ func register(r *mux.Router, base string, specification *spec.APISpecification)
 	r.Path(routeBase).Methods(http.MethodGet).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		uri := findFirstGuideURI(guidesNavigation)
 		log().Infof("Redirect to %s", uri)
-		http.Redirect(w, req, uri, http.StatusFound)
+		basepath.Redirect(w, req, uri, http.StatusFound)
 	})
 
 	// Register the guides navigation with the renderer
-	render.SetGuidesNavigation(specification, guidesNavigation.Children)
+	rnd.SetGuidesNavigation(specification, guidesNavigation.Children)
 }
 
 func findFirstGuideURI(tree *navigation.Node) string {
@@ -151,12 +153,12 @@ func stripBasepathAndExtension(name, basepath string) string {
 	return strings.TrimSuffix(strings.TrimPrefix(name, basepath), filepath.Ext(name))
 }
 
-func buildNavigation(nav *navigation.Node, path, pathBase, route, ext string) {
+func buildNavigation(assets *asset.Store, nav *navigation.Node, path, pathBase, route, ext string) {
 	log().Tracef("      - Look for metadata asset %s", path)
 
 	// See if guide has been marked up with navigation metadata...
-	hierarchy := asset.MetaData(path, "Navigation")
-	sortOrder := asset.MetaData(path, "SortOrder")
+	hierarchy := assets.MetaData(path, "Navigation")
+	sortOrder := assets.MetaData(path, "SortOrder")
 
 	if len(hierarchy) > 0 {
 		log().Tracef("      * Got navigation metadata %s for file %s", hierarchy, path)
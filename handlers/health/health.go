@@ -0,0 +1,65 @@
+// Package health serves the liveness and readiness endpoints, for orchestrators. They are served
+// ahead of the router, so no authentication, rate limit or timeout applies to them, and they answer
+// while the documentation is still loading.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// all endpoint paths.
+const (
+	LivePath  = "/healthz"
+	ReadyPath = "/readyz"
+)
+
+var state = struct {
+	sync.RWMutex
+	ready  bool
+	reason string
+}{reason: "loading"}
+
+// SetReady records whether the specifications and assets have been loaded, and the reason when not.
+func SetReady(ready bool, reason string) {
+	state.Lock()
+	defer state.Unlock()
+
+	if ready != state.ready {
+		log().Infof("Ready: %t %s", ready, reason)
+	}
+
+	state.ready = ready
+	state.reason = reason
+}
+
+// Handler serves the endpoints, passing other requests to h.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case LivePath:
+			writeStatus(w, http.StatusOK, "ok")
+		case ReadyPath:
+			state.RLock()
+			ready, reason := state.ready, state.reason
+			state.RUnlock()
+
+			if ready {
+				writeStatus(w, http.StatusOK, "ready")
+			} else {
+				writeStatus(w, http.StatusServiceUnavailable, reason)
+			}
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+func writeStatus(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": msg})
+}
@@ -0,0 +1,42 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("page"))
+	}))
+
+	tests := []struct {
+		name     string
+		ready    bool
+		reason   string
+		path     string
+		wantCode int
+		want     string
+	}{
+		{name: "live while loading", reason: "loading", path: LivePath, wantCode: http.StatusOK, want: `{"status":"ok"}`},
+		{name: "loading", reason: "loading", path: ReadyPath, wantCode: http.StatusServiceUnavailable, want: `{"status":"loading"}`},
+		{name: "failed", reason: "no specifications", path: ReadyPath, wantCode: http.StatusServiceUnavailable, want: `{"status":"no specifications"}`},
+		{name: "ready", ready: true, path: ReadyPath, wantCode: http.StatusOK, want: `{"status":"ready"}`},
+		{name: "page", ready: true, path: "/docs", wantCode: http.StatusOK, want: "page"},
+		{name: "metrics on their own listener", ready: true, path: "/metrics", wantCode: http.StatusOK, want: "page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetReady(tt.ready, tt.reason)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if got := strings.TrimSpace(w.Body.String()); w.Code != tt.wantCode || got != tt.want {
+				t.Errorf("%s = %d %s, want %d %s", tt.path, w.Code, got, tt.wantCode, tt.want)
+			}
+		})
+	}
+}
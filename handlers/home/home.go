@@ -26,47 +26,50 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/basepath"
 	"github.com/kenjones-cisco/dapperdox/render"
 	"github.com/kenjones-cisco/dapperdox/spec"
 )
 
-// Register creates routes for each home handler.
-func Register(r *mux.Router) {
+// Register creates routes for each home handler, of the specifications of the suite.
+func Register(r *mux.Router, suite *spec.Suite, rnd *render.Renderer) {
 	log().Debug("registering handlers for home page")
 
 	// Homepages for each loaded specification
 	var specification *spec.APISpecification // Ends up being populated with the last spec processed
 
-	for _, specification = range spec.APISuite {
+	for _, specification = range suite.Specs {
 		log().Tracef("Build homepage route for specification %q", specification.ID)
 
-		r.Path("/" + specification.ID + "/reference").Methods(http.MethodGet).HandlerFunc(specificationSummaryHandler(specification))
+		r.Path("/" + specification.ID + "/reference").Methods(http.MethodGet).HandlerFunc(specificationSummaryHandler(rnd, specification))
 
 		// If missingh trailing slash, redirect to add it
 		r.Path("/" + specification.ID).Methods(http.MethodGet).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			http.Redirect(w, req, "/"+specification.ID+"/", http.StatusFound)
+			basepath.Redirect(w, req, "/"+specification.ID+"/", http.StatusFound)
 		})
 	}
 
-	if len(spec.APISuite) == 1 && !viper.GetBool(config.ForceSpecList) {
+	if len(suite.Specs) == 1 && !viper.GetBool(config.ForceSpecList) {
 		// If there is only one specification loaded, then hotwire '/' to redirect to the
 		// specification summary page unless DapperDox is configured to show the specification list page.
 		r.Path("/").Methods(http.MethodGet).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			http.Redirect(w, req, "/"+specification.ID+"/reference", http.StatusFound)
+			basepath.Redirect(w, req, "/"+specification.ID+"/reference", http.StatusFound)
 		})
 	} else {
-		r.Path("/").Methods(http.MethodGet).HandlerFunc(specificationListHandler)
+		r.Path("/").Methods(http.MethodGet).HandlerFunc(specificationListHandler(rnd))
 	}
 }
 
-func specificationListHandler(w http.ResponseWriter, req *http.Request) {
-	log().Trace("Render HTML for top level index page")
+func specificationListHandler(rnd *render.Renderer) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		log().Trace("Render HTML for top level index page")
 
-	render.HTML(w, http.StatusOK, "specification_list",
-		render.DefaultVars(req, nil, render.Vars{"Title": "Specifications list", "SpecificationList": true}))
+		rnd.HTML(w, http.StatusOK, "specification_list",
+			rnd.DefaultVars(req, nil, render.Vars{"Title": "Specifications list", "SpecificationList": true}))
+	}
 }
 
-func specificationSummaryHandler(s *spec.APISpecification) func(w http.ResponseWriter, req *http.Request) {
+func specificationSummaryHandler(rnd *render.Renderer, s *spec.APISpecification) func(w http.ResponseWriter, req *http.Request) {
 	// The default "theme" level reference index page.
 	tmpl := "specification_summary"
 
@@ -74,12 +77,12 @@ func specificationSummaryHandler(s *spec.APISpecification) func(w http.ResponseW
 
 	log().Tracef("+ Test for template %q", customTmpl)
 
-	if render.TemplateLookup(customTmpl) != nil {
+	if rnd.TemplateLookup(customTmpl) != nil {
 		tmpl = customTmpl
 	}
 
 	return func(w http.ResponseWriter, req *http.Request) {
-		render.HTML(w, http.StatusOK, tmpl,
-			render.DefaultVars(req, s, render.Vars{"Title": "Specification summary", "SpecificationSummary": true}))
+		rnd.HTML(w, http.StatusOK, tmpl,
+			rnd.DefaultVars(req, s, render.Vars{"Title": "Specification summary", "SpecificationSummary": true}))
 	}
 }
@@ -0,0 +1,247 @@
+// Package mock provides handler for serving mock API responses generated from the specifications.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/requestlog"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+// PathPrefix is the route prefix under which the mock API of each specification is served.
+const PathPrefix = "/mock"
+
+const defaultMime = "application/json"
+
+// Register creates the mock routes for each specification of the suite.
+func Register(r *mux.Router, suite *spec.Suite) {
+	if !viper.GetBool(config.MockEnabled) {
+		log().Debug("Mock responses are disabled")
+
+		return
+	}
+
+	log().Info("Registering mock responses")
+
+	for _, specification := range suite.Specs {
+		prefix := PathPrefix + "/" + specification.ID
+
+		log().Debugf("+ %s/ -> %q", prefix, specification.APIInfo.Title)
+
+		r.PathPrefix(prefix + "/").HandlerFunc(specificationHandler(specification, prefix))
+	}
+
+	// Paths under the prefix that name no specification are mocked by whichever documents them, after
+	// the routes of the specifications, so those are matched first.
+	if viper.GetBool(config.MockFallback) {
+		log().Debugf("+ %s/ -> documented operations of any specification", PathPrefix)
+
+		r.PathPrefix(PathPrefix + "/").HandlerFunc(fallbackHandler(suite))
+	}
+}
+
+func fallbackHandler(suite *spec.Suite) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		path := strings.TrimPrefix(req.URL.Path, PathPrefix)
+
+		specification, method, _ := suite.MatchMethod(req.Method, path)
+		if method == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no operation documented for %s %s", req.Method, path))
+
+			return
+		}
+
+		requestlog.SetSpec(req.Context(), specification.ID)
+
+		serve(w, req, method)
+	}
+}
+
+func specificationHandler(specification *spec.APISpecification, prefix string) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		path := strings.TrimPrefix(req.URL.Path, prefix)
+
+		requestlog.SetSpec(req.Context(), specification.ID)
+
+		method, _ := specification.MatchMethod(req.Method, path)
+		if method == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no operation documented for %s %s", req.Method, path))
+
+			return
+		}
+
+		serve(w, req, method)
+	}
+}
+
+func serve(w http.ResponseWriter, req *http.Request, method *spec.Method) {
+	requestlog.SetOperation(req.Context(), method.ID)
+
+	status, response, preferred := selectResponse(method, req.Header.Get("Prefer"))
+	if response == nil {
+		if preferred != 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("response code %d is not documented for operation %s", preferred, method.ID))
+
+			return
+		}
+
+		// Nothing documented for the operation, so there is nothing to say.
+		w.WriteHeader(status)
+
+		return
+	}
+
+	log().Debugf("MOCK %s %s -> %s (%d)", req.Method, req.URL.Path, method.ID, status)
+
+	for _, h := range response.Headers {
+		w.Header().Set(h.Name, headerValue(h))
+	}
+
+	if preferred != 0 {
+		w.Header().Set("Preference-Applied", "code="+strconv.Itoa(preferred))
+	}
+
+	mime, body := responseBody(response, method.Produces, req.Header.Get("Accept"))
+	if body == nil {
+		w.WriteHeader(status)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", mime)
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// selectResponse picks the documented response to mock. A code requested through the
+// Prefer header (Prefer: code=404) wins, otherwise the lowest documented success code,
+// falling back to the lowest documented code and then the default response.
+func selectResponse(method *spec.Method, prefer string) (int, *spec.Response, int) {
+	if code := preferredCode(prefer); code != 0 {
+		if r, ok := method.Responses[code]; ok {
+			return code, &r, code
+		}
+
+		return code, method.DefaultResponse, code
+	}
+
+	codes := make([]int, 0, len(method.Responses))
+	for code := range method.Responses {
+		codes = append(codes, code)
+	}
+
+	sort.Ints(codes)
+
+	for _, code := range codes {
+		if code >= 200 && code < 300 {
+			r := method.Responses[code]
+
+			return code, &r, 0
+		}
+	}
+
+	if len(codes) > 0 {
+		r := method.Responses[codes[0]]
+
+		return codes[0], &r, 0
+	}
+
+	return http.StatusOK, method.DefaultResponse, 0
+}
+
+func preferredCode(prefer string) int {
+	for _, pref := range strings.Split(prefer, ",") {
+		for _, token := range strings.Split(pref, ";") {
+			kv := strings.SplitN(strings.TrimSpace(token), "=", 2)
+			if len(kv) != 2 || !strings.EqualFold(kv[0], "code") {
+				continue
+			}
+
+			if code, err := strconv.Atoi(strings.Trim(kv[1], `"`)); err == nil {
+				return code
+			}
+		}
+	}
+
+	return 0
+}
+
+// responseBody returns the documented example for the negotiated MIME type, or a body
+// generated from the response resource schema.
+func responseBody(response *spec.Response, produces []string, accept string) (string, []byte) {
+	mime := negotiate(produces, accept)
+
+	if example, ok := response.Examples[mime]; ok {
+		return mime, []byte(example)
+	}
+
+	if response.Resource == nil {
+		return "", nil
+	}
+
+	if !strings.Contains(mime, "json") {
+		// Only JSON can be generated from the schema.
+		mime = defaultMime
+	}
+
+	b, err := json.MarshalIndent(Sample(response.Resource, response.IsArray), "", "    ")
+	if err != nil {
+		log().Errorf("Error generating mock response for %s: %s", response.Resource.ID, err)
+
+		return "", nil
+	}
+
+	return mime, b
+}
+
+func negotiate(produces []string, accept string) string {
+	for _, a := range strings.Split(accept, ",") {
+		a = strings.TrimSpace(strings.SplitN(a, ";", 2)[0])
+
+		for _, p := range produces {
+			if strings.EqualFold(a, p) {
+				return p
+			}
+		}
+	}
+
+	if len(produces) > 0 {
+		return produces[0]
+	}
+
+	return defaultMime
+}
+
+func headerValue(h spec.Header) string {
+	if h.Default != "" {
+		return h.Default
+	}
+
+	if len(h.Enum) > 0 {
+		return h.Enum[0]
+	}
+
+	// A header need not document its type, in which case it is mocked as a string.
+	if len(h.Type) == 0 {
+		return fmt.Sprintf("%v", primitive("string"))
+	}
+
+	return fmt.Sprintf("%v", primitive(h.Type[len(h.Type)-1]))
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	log().Debugf("MOCK error: %s", msg)
+
+	w.Header().Set("Content-Type", defaultMime)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": msg, "code": status})
+}
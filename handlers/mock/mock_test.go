@@ -0,0 +1,71 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+func TestHeaderValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		header spec.Header
+		want   string
+	}{
+		{"default", spec.Header{Type: []string{"integer"}, Default: "5"}, "5"},
+		{"enum", spec.Header{Type: []string{"string"}, Enum: []string{"a", "b"}}, "a"},
+		{"typed", spec.Header{Type: []string{"integer"}}, "0"},
+		{"array", spec.Header{Type: []string{"array", "boolean"}}, "true"},
+		{"untyped", spec.Header{Name: "X-Trace"}, "string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := headerValue(tt.header); got != tt.want {
+				t.Errorf("headerValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterFallback(t *testing.T) {
+	config.Restore()
+	viper.Set(config.MockEnabled, true)
+	viper.Set(config.MockFallback, true)
+
+	pets := &spec.Method{ID: "listPets", Method: "get", Path: "/pets", Responses: map[int]spec.Response{200: {}}}
+	suite := &spec.Suite{Specs: map[string]*spec.APISpecification{
+		"petstore": {ID: "petstore", APIs: spec.APISet{{Methods: []*spec.Method{pets}}}},
+	}}
+
+	r := mux.NewRouter()
+	Register(r, suite)
+
+	tests := []struct {
+		target   string
+		wantCode int
+	}{
+		{target: "/mock/petstore/pets", wantCode: http.StatusOK},
+		{target: "/mock/pets", wantCode: http.StatusOK},
+		{target: "/mock/owners", wantCode: http.StatusNotFound},
+		{target: "/pets", wantCode: http.StatusNotFound}, // Only paths under the prefix are mocked.
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+		if w.Code != tt.wantCode {
+			t.Errorf("GET %s status = %d, want %d", tt.target, w.Code, tt.wantCode)
+		}
+	}
+
+	if r.NotFoundHandler != nil {
+		t.Error("NotFoundHandler of the router replaced")
+	}
+}
@@ -0,0 +1,111 @@
+package mock
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+// maxSampleDepth guards against runaway nesting of resource properties.
+const maxSampleDepth = 16
+
+// Sample generates an example value for a resource from its schema, preferring any
+// example and enumerated values declared for the resource and its properties. isArray
+// says whether an array of the resource is wanted, as resources are shared between
+// single and array bodies.
+func Sample(r *spec.Resource, isArray bool) interface{} {
+	if r == nil {
+		return nil
+	}
+
+	if len(r.Properties) > 0 {
+		if isArray {
+			return []interface{}{object(r, 0)}
+		}
+
+		return object(r, 0)
+	}
+
+	return sample(r, 0)
+}
+
+func sample(r *spec.Resource, depth int) interface{} {
+	if r == nil || depth > maxSampleDepth {
+		return nil
+	}
+
+	if r.Example != "" {
+		var v interface{}
+		if err := json.Unmarshal([]byte(r.Example), &v); err == nil {
+			return v
+		}
+	}
+
+	if len(r.Enum) > 0 {
+		return r.Enum[0]
+	}
+
+	if len(r.Type) == 0 {
+		return object(r, depth)
+	}
+
+	switch strings.ToLower(r.Type[0]) {
+	case "array":
+		if len(r.Properties) > 0 || len(r.Type) < 2 {
+			return []interface{}{object(r, depth)}
+		}
+
+		return []interface{}{primitive(r.Type[1])}
+	case "map":
+		// A map is the additionalProperties member of its parent object, so this is
+		// the value held against each key.
+		if len(r.Type) > 1 && !strings.EqualFold(r.Type[1], "object") {
+			return primitive(r.Type[1])
+		}
+
+		return object(r, depth)
+	case "object":
+		return object(r, depth)
+	default:
+		return primitive(r.Type[0])
+	}
+}
+
+func object(r *spec.Resource, depth int) map[string]interface{} {
+	obj := make(map[string]interface{}, len(r.Properties))
+
+	for name, p := range r.Properties {
+		if name == spec.MapKey {
+			name = "key"
+		}
+
+		obj[name] = sample(p, depth+1)
+	}
+
+	return obj
+}
+
+// primitive returns an example value for a primitive type or format.
+func primitive(t string) interface{} {
+	switch strings.ToLower(t) {
+	case "integer", "int32", "int64":
+		return 0
+	case "number", "float", "double":
+		return 0.0
+	case "boolean":
+		return true
+	case "date":
+		return "2006-01-02"
+	case "date-time":
+		return "2006-01-02T15:04:05Z"
+	case "uuid":
+		return "00000000-0000-0000-0000-000000000000"
+	case "email":
+		return "user@example.com"
+	case "byte":
+		return "c3RyaW5n"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,486 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kenjones-cisco/dapperdox/validator"
+)
+
+// all balancing policies.
+const (
+	roundRobin       = "round-robin"
+	leastConnections = "least-connections"
+)
+
+const (
+	defaultMaxFails       = 3
+	defaultFailTimeout    = 30 * time.Second
+	defaultCheckInterval  = 10 * time.Second
+	defaultCheckTimeout   = 2 * time.Second
+	maxRetryBodyBytes     = 10 << 20 // Request bodies held in memory so they can be sent again.
+	healthCheckStatusFrom = http.StatusInternalServerError
+)
+
+var errNoUpstream = errors.New("no upstream target available")
+
+// healthCheck configures the active health checks of the upstreams of a target.
+type healthCheck struct {
+	Path     string        `mapstructure:"path"`
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// upstream is one of the instances a proxied route is balanced across.
+type upstream struct {
+	url    *url.URL
+	active int64 // Requests in flight, including responses still being read
+
+	mu        sync.Mutex
+	fails     int       // Consecutive failed requests
+	downUntil time.Time // Set by passive checks, once fails reaches the limit
+	checked   bool      // Whether an active check has run
+	healthy   bool      // Result of the last active check
+	lastError string
+	lastCheck time.Time
+}
+
+// UpstreamStatus describes the health of an upstream, for the status page.
+type UpstreamStatus struct {
+	Route     string
+	URL       string
+	Healthy   bool
+	Active    int64
+	Fails     int
+	DownUntil time.Time
+	LastError string
+	LastCheck time.Time
+}
+
+func (u *upstream) available(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return (!u.checked || u.healthy) && !now.Before(u.downUntil)
+}
+
+// balancer is the round tripper of a proxied route. Each request is sent to one of the route's
+// upstreams, and requests with idempotent methods are retried on another upstream when one fails.
+type balancer struct {
+	route       string
+	policy      string
+	upstreams   []*upstream
+	transport   http.RoundTripper
+	maxFails    int
+	failTimeout time.Duration
+	check       *healthCheck
+	rules       *rules
+
+	next uint32
+	done chan struct{}
+}
+
+func newBalancer(t *target, transport http.RoundTripper) (*balancer, error) {
+	b := &balancer{
+		route:       t.label(),
+		policy:      strings.ToLower(t.Balance),
+		transport:   transport,
+		maxFails:    t.MaxFails,
+		failTimeout: t.FailTimeout,
+		check:       t.HealthCheck,
+		rules:       &t.rules,
+		done:        make(chan struct{}),
+	}
+
+	switch b.policy {
+	case "":
+		b.policy = roundRobin
+	case roundRobin, leastConnections:
+	default:
+		return nil, errors.New("unknown balancing policy " + t.Balance)
+	}
+
+	if b.maxFails <= 0 {
+		b.maxFails = defaultMaxFails
+	}
+
+	if b.failTimeout <= 0 {
+		b.failTimeout = defaultFailTimeout
+	}
+
+	for _, raw := range t.upstreams() {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.New("upstream target " + raw + " must be an absolute URL")
+		}
+
+		b.upstreams = append(b.upstreams, &upstream{url: u})
+	}
+
+	if b.check != nil && b.check.Path != "" {
+		if b.check.Interval <= 0 {
+			b.check.Interval = defaultCheckInterval
+		}
+
+		if b.check.Timeout <= 0 {
+			b.check.Timeout = defaultCheckTimeout
+		}
+
+		go b.healthChecks()
+	}
+
+	return b, nil
+}
+
+// stop ends the active health checks of the balancer.
+func (b *balancer) stop() {
+	close(b.done)
+}
+
+// RoundTrip sends the request to an upstream, failing over to the others for idempotent methods.
+func (b *balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if idempotent(req.Method) {
+		attempts = len(b.upstreams)
+	}
+
+	if attempts > 1 && req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		buffered, err := bufferBody(req)
+		if err != nil {
+			return nil, err
+		}
+
+		// A body too large to hold in memory can only be sent once.
+		if !buffered {
+			log().Debugf("Not retrying %s %s, as the request body is too large", req.Method, req.URL.Path)
+
+			attempts = 1
+		}
+	}
+
+	tried := make(map[*upstream]bool, attempts)
+	lastErr := errNoUpstream
+
+	for i := 0; i < attempts; i++ {
+		u := b.pick(tried)
+		if u == nil {
+			break
+		}
+
+		tried[u] = true
+
+		out, err := b.rewrite(req, u)
+		if err != nil {
+			return nil, err
+		}
+
+		log().Debugf("Proxy request to: %s", out.URL)
+
+		atomic.AddInt64(&u.active, 1)
+
+		resp, err := b.transport.RoundTrip(out)
+		if err != nil {
+			atomic.AddInt64(&u.active, -1)
+
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+
+			b.failed(u, err.Error())
+			lastErr = err
+
+			continue
+		}
+
+		if isGatewayFailure(resp.StatusCode) && i < attempts-1 && len(tried) < len(b.upstreams) {
+			b.failed(u, resp.Status)
+			_ = resp.Body.Close()
+			atomic.AddInt64(&u.active, -1)
+
+			continue
+		}
+
+		b.succeeded(u)
+		resp.Body = &activeBody{ReadCloser: resp.Body, u: u}
+
+		return resp, nil
+	}
+
+	return nil, lastErr
+}
+
+// pick chooses the next upstream not yet tried, preferring those that are available.
+func (b *balancer) pick(tried map[*upstream]bool) *upstream {
+	now := time.Now()
+	n := len(b.upstreams)
+	start := int(atomic.AddUint32(&b.next, 1)-1) % n
+
+	var fallback, best *upstream
+
+	for i := 0; i < n; i++ {
+		u := b.upstreams[(start+i)%n]
+		if tried[u] {
+			continue
+		}
+
+		if !u.available(now) {
+			if fallback == nil {
+				fallback = u
+			}
+
+			continue
+		}
+
+		if b.policy == roundRobin {
+			return u
+		}
+
+		if best == nil || atomic.LoadInt64(&u.active) < atomic.LoadInt64(&best.active) {
+			best = u
+		}
+	}
+
+	if best != nil {
+		return best
+	}
+
+	// When every upstream is down, trying one is better than failing outright.
+	return fallback
+}
+
+func (b *balancer) rewrite(req *http.Request, u *upstream) (*http.Request, error) {
+	out := req.Clone(req.Context())
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		out.Body = body
+	}
+
+	out.URL.Scheme = u.url.Scheme
+	out.URL.Host = u.url.Host
+	out.URL.Path, out.URL.RawPath = joinURLPath(u.url, req.URL)
+	out.Host = u.url.Host
+
+	if u.url.RawQuery != "" {
+		if out.URL.RawQuery == "" {
+			out.URL.RawQuery = u.url.RawQuery
+		} else {
+			out.URL.RawQuery = u.url.RawQuery + "&" + out.URL.RawQuery
+		}
+	}
+
+	return out, nil
+}
+
+func (b *balancer) failed(u *upstream, reason string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.fails++
+	u.lastError = reason
+
+	if u.fails >= b.maxFails {
+		log().Warnf("Upstream %s of %s is down for %v: %s", u.url, b.route, b.failTimeout, reason)
+
+		u.downUntil = time.Now().Add(b.failTimeout)
+		u.fails = 0
+	}
+}
+
+func (b *balancer) succeeded(u *upstream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.fails = 0
+}
+
+func (b *balancer) healthChecks() {
+	ticker := time.NewTicker(b.check.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, u := range b.upstreams {
+			b.checkHealth(u)
+		}
+
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *balancer) checkHealth(u *upstream) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.check.Timeout)
+	defer cancel()
+
+	ref := &url.URL{Path: b.check.Path}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url.ResolveReference(ref).String(), nil)
+	if err != nil {
+		log().Errorf("Error creating health check of %s: %s", u.url, err)
+
+		return
+	}
+
+	b.rules.apply(req)
+
+	reason := ""
+
+	resp, err := b.transport.RoundTrip(req)
+	if err != nil {
+		reason = err.Error()
+	} else {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		if resp.StatusCode >= healthCheckStatusFrom {
+			reason = "health check returned " + resp.Status
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	switch {
+	case u.checked && !u.healthy && reason == "":
+		log().Infof("Upstream %s of %s passed its health check", u.url, b.route)
+	case (!u.checked || u.healthy) && reason != "":
+		log().Warnf("Upstream %s of %s failed its health check: %s", u.url, b.route, reason)
+	}
+
+	u.checked = true
+	u.healthy = reason == ""
+	u.lastCheck = time.Now()
+
+	if reason != "" {
+		u.lastError = reason
+	}
+}
+
+func (b *balancer) status() []UpstreamStatus {
+	now := time.Now()
+	list := make([]UpstreamStatus, 0, len(b.upstreams))
+
+	for _, u := range b.upstreams {
+		healthy := u.available(now)
+
+		u.mu.Lock()
+		list = append(list, UpstreamStatus{
+			Route:     b.route,
+			URL:       u.url.String(),
+			Healthy:   healthy,
+			Active:    atomic.LoadInt64(&u.active),
+			Fails:     u.fails,
+			DownUntil: u.downUntil,
+			LastError: u.lastError,
+			LastCheck: u.lastCheck,
+		})
+		u.mu.Unlock()
+	}
+
+	return list
+}
+
+// activeBody counts the upstream as busy until its response has been read.
+type activeBody struct {
+	io.ReadCloser
+	u    *upstream
+	once sync.Once
+}
+
+func (a *activeBody) Close() error {
+	a.once.Do(func() { atomic.AddInt64(&a.u.active, -1) })
+
+	return a.ReadCloser.Close()
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+func isGatewayFailure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// bufferBody holds the request body in memory, so it can be sent again, reporting whether it did. A
+// body larger than maxRetryBodyBytes is left to be sent once, the bytes read being put back in front
+// of the rest.
+func bufferBody(req *http.Request) (bool, error) {
+	if req.ContentLength > maxRetryBodyBytes {
+		return false, nil
+	}
+
+	body, rest, err := validator.ReadLimited(req.Body, maxRetryBodyBytes)
+	req.Body = rest
+
+	if err != nil || body == nil {
+		return false, err
+	}
+
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+
+	return true, nil
+}
+
+// joinURLPath joins the upstream base path and the request path, as httputil.NewSingleHostReverseProxy does.
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+
+	apath := a.EscapedPath()
+	bpath := b.EscapedPath()
+
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+
+	return a + b
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upstreamStub answers requests by host name: "down" fails to connect, "busy" answers 502 and any
+// other host 200. It keeps the host and body of each request.
+type upstreamStub struct {
+	hosts  []string
+	bodies []string
+}
+
+func (s *upstreamStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.hosts = append(s.hosts, req.URL.Host)
+
+	if req.Body != nil {
+		b, _ := ioutil.ReadAll(req.Body)
+		s.bodies = append(s.bodies, string(b))
+	}
+
+	switch req.URL.Hostname() {
+	case "down":
+		return nil, errors.New("connection refused")
+	case "busy":
+		return &http.Response{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway", Body: http.NoBody}, nil
+	}
+
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func newTestBalancer(t *testing.T, stub *upstreamStub, upstreams ...string) *balancer {
+	t.Helper()
+
+	tg := newTarget("/api/")
+	tg.Targets = upstreams
+	tg.MaxFails = 2
+	tg.FailTimeout = time.Minute
+
+	b, err := newBalancer(tg, stub)
+	if err != nil {
+		t.Fatalf("newBalancer() error = %v", err)
+	}
+
+	return b
+}
+
+func TestBalancerFailover(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		body      string
+		upstreams []string
+		wantHosts []string
+		wantErr   bool
+	}{
+		{"idempotent fails over", http.MethodGet, "", []string{"http://down", "http://up"}, []string{"down", "up"}, false},
+		{"gateway failure retried", http.MethodGet, "", []string{"http://busy", "http://up"}, []string{"busy", "up"}, false},
+		{"body sent again", http.MethodPut, "data", []string{"http://down", "http://up"}, []string{"down", "up"}, false},
+		{"not idempotent", http.MethodPost, "data", []string{"http://down", "http://up"}, []string{"down"}, true},
+		{"all down", http.MethodGet, "", []string{"http://down", "http://down:81"}, []string{"down", "down:81"}, true},
+		{
+			"body too large to retry", http.MethodPut, strings.Repeat("x", maxRetryBodyBytes+1),
+			[]string{"http://down", "http://up"}, []string{"down"}, true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &upstreamStub{}
+			b := newTestBalancer(t, stub, tt.upstreams...)
+			defer b.stop()
+
+			req := httptest.NewRequest(tt.method, "/api/things", strings.NewReader(tt.body))
+
+			resp, err := b.RoundTrip(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RoundTrip() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+
+			if strings.Join(stub.hosts, ",") != strings.Join(tt.wantHosts, ",") {
+				t.Errorf("RoundTrip() tried %v, want %v", stub.hosts, tt.wantHosts)
+			}
+
+			for i, body := range stub.bodies {
+				if body != tt.body {
+					t.Errorf("attempt %d sent a body of %d bytes, want %d", i, len(body), len(tt.body))
+				}
+			}
+		})
+	}
+}
+
+func TestBalancerMarksUpstreamDown(t *testing.T) {
+	stub := &upstreamStub{}
+	b := newTestBalancer(t, stub, "http://down", "http://up")
+	defer b.stop()
+
+	for i := 0; i < 4; i++ {
+		resp, err := b.RoundTrip(httptest.NewRequest(http.MethodGet, "/api/things", nil))
+		if err != nil {
+			t.Fatalf("RoundTrip() error = %v", err)
+		}
+
+		_ = resp.Body.Close()
+	}
+
+	// Each request starts on the next upstream, so down is tried by the first and third, and then
+	// left alone once it has failed twice.
+	stub.hosts = nil
+
+	for i := 0; i < 2; i++ {
+		resp, err := b.RoundTrip(httptest.NewRequest(http.MethodGet, "/api/things", nil))
+		if err != nil {
+			t.Fatalf("RoundTrip() error = %v", err)
+		}
+
+		_ = resp.Body.Close()
+	}
+
+	if strings.Join(stub.hosts, ",") != "up,up" {
+		t.Errorf("RoundTrip() tried %v once down had failed, want only up", stub.hosts)
+	}
+
+	for _, s := range b.status() {
+		if want := s.URL != "http://down"; s.Healthy != want {
+			t.Errorf("status() of %s healthy = %t, want %t", s.URL, s.Healthy, want)
+		}
+	}
+}
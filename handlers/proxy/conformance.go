@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kenjones-cisco/dapperdox/render"
+	"github.com/kenjones-cisco/dapperdox/spec"
+	"github.com/kenjones-cisco/dapperdox/validator"
+)
+
+// ConformancePath is the author-mode page reporting upstream responses that depart from the specification.
+const ConformancePath = "/author/conformance"
+
+type (
+	methodKey struct{}
+	specKey   struct{}
+)
+
+// Report counts the conformance checks of the responses to one documented operation.
+type Report struct {
+	SpecID      string
+	OperationID string
+	Method      string
+	Path        string
+	Checked     int
+	Failed      int
+	LastStatus  int
+	LastFailure time.Time
+	Violations  []validator.Violation // From the last failed check
+}
+
+var conformance = struct {
+	sync.Mutex
+	reports map[string]*Report // Key is specification ID, method and path
+}{reports: make(map[string]*Report)}
+
+func withMethod(ctx context.Context, method *spec.Method) context.Context {
+	return context.WithValue(ctx, methodKey{}, method)
+}
+
+func methodFrom(ctx context.Context) *spec.Method {
+	method, _ := ctx.Value(methodKey{}).(*spec.Method)
+
+	return method
+}
+
+// withSpec records the specification documenting the method of the request.
+func withSpec(ctx context.Context, specification *spec.APISpecification) context.Context {
+	return context.WithValue(ctx, specKey{}, specification)
+}
+
+// specIDFrom returns the ID of the specification documenting the method of the request, or "".
+func specIDFrom(ctx context.Context) string {
+	if specification, ok := ctx.Value(specKey{}).(*spec.APISpecification); ok && specification != nil {
+		return specification.ID
+	}
+
+	return ""
+}
+
+// checkConformance returns a response modifier validating the upstream response against the
+// documented method of the request. Only a JSON body is read and checked, up to maxBody, so chunked
+// JSON is checked too; a larger body, or any other, such as a download or a stream, is passed on as
+// it arrives, and only the status and headers are checked. Drift is logged and counted, but the
+// response is always passed on.
+func checkConformance(maxBody int64) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		method := methodFrom(resp.Request.Context())
+		if method == nil {
+			return nil
+		}
+
+		var body []byte
+
+		if validator.IsJSON(resp.Header.Get("Content-Type")) && resp.ContentLength <= maxBody {
+			var err error
+			if body, resp.Body, err = validator.ReadLimited(resp.Body, maxBody); err != nil {
+				return err
+			}
+		}
+
+		if body == nil {
+			log().Tracef("Not checking the body of the response from %s", method.ID)
+		}
+
+		violations := validator.Response(method, resp, body)
+
+		recordConformance(specIDFrom(resp.Request.Context()), method, resp.StatusCode, violations)
+
+		if len(violations) > 0 {
+			log().WithField("operation", method.ID).Warnf("Response %d to %s %s does not conform to the specification: %v",
+				resp.StatusCode, strings.ToUpper(method.Method), resp.Request.URL.Path, violations)
+		}
+
+		return nil
+	}
+}
+
+// recordConformance counts a check of a response, by the specification too, as specifications may
+// document the same method and path.
+func recordConformance(specID string, method *spec.Method, status int, violations []validator.Violation) {
+	key := specID + " " + method.Method + " " + method.Path
+
+	conformance.Lock()
+	defer conformance.Unlock()
+
+	report, ok := conformance.reports[key]
+	if !ok {
+		report = &Report{SpecID: specID, OperationID: method.ID, Method: strings.ToUpper(method.Method), Path: method.Path}
+		conformance.reports[key] = report
+	}
+
+	report.Checked++
+	report.LastStatus = status
+
+	if len(violations) > 0 {
+		report.Failed++
+		report.LastFailure = time.Now()
+		report.Violations = violations
+	}
+}
+
+// Reports returns a copy of the conformance reports, most failures first.
+func Reports() []Report {
+	conformance.Lock()
+	defer conformance.Unlock()
+
+	reports := make([]Report, 0, len(conformance.reports))
+	for _, r := range conformance.reports {
+		reports = append(reports, *r)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Failed != reports[j].Failed {
+			return reports[i].Failed > reports[j].Failed
+		}
+
+		if reports[i].SpecID != reports[j].SpecID {
+			return reports[i].SpecID < reports[j].SpecID
+		}
+
+		return reports[i].OperationID < reports[j].OperationID
+	})
+
+	return reports
+}
+
+func conformanceHandler(rnd *render.Renderer) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		rnd.HTML(w, http.StatusOK, "conformance",
+			rnd.DefaultVars(req, nil, render.Vars{"Title": "Specification conformance", "Reports": Reports()}))
+	}
+}
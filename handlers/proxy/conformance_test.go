@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+func TestCheckConformanceBuffering(t *testing.T) {
+	// The bodies are not JSON, so are reported when checked.
+	method := &spec.Method{ID: "getThing", Method: "get", Path: "/things", Responses: map[int]spec.Response{200: {Resource: &spec.Resource{}}}}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		length      int64
+		wantChecked bool
+	}{
+		{"small json", "application/json", `{"a": 1,}`, 9, true},
+		{"large json", "application/json", `{"a": "a long string",}`, 23, false},
+		{"chunked json", "application/json", `{"a": 1,}`, -1, true},
+		{"large chunked json", "application/json", `{"a": "a long string",}`, -1, false},
+		{"no content type", "", `{"a": 1,}`, 9, false},
+		{"download", "application/octet-stream", "12345678", 8, false},
+		{"event stream", "text/event-stream", "data: x\n\n", -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conformance.Lock()
+			conformance.reports = make(map[string]*Report)
+			conformance.Unlock()
+
+			req := httptest.NewRequest(http.MethodGet, "/things", nil)
+			resp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {tt.contentType}},
+				Body:          ioutil.NopCloser(strings.NewReader(tt.body)),
+				ContentLength: tt.length,
+				Request:       req.WithContext(withMethod(req.Context(), method)),
+			}
+
+			if err := checkConformance(16)(resp); err != nil {
+				t.Fatalf("checkConformance() error = %v", err)
+			}
+
+			if checked := Reports()[0].Failed > 0; checked != tt.wantChecked {
+				t.Errorf("checkConformance() checked the body %t, want %t", checked, tt.wantChecked)
+			}
+
+			if b, err := ioutil.ReadAll(resp.Body); err != nil || string(b) != tt.body {
+				t.Errorf("body passed on = %q, %v, want %q", b, err, tt.body)
+			}
+		})
+	}
+}
+
+func TestReportsBySpecification(t *testing.T) {
+	conformance.Lock()
+	conformance.reports = make(map[string]*Report)
+	conformance.Unlock()
+
+	method := &spec.Method{ID: "getThing", Method: "get", Path: "/things"}
+
+	recordConformance("v1", method, http.StatusOK, nil)
+	recordConformance("v2", method, http.StatusOK, nil)
+	recordConformance("v2", method, http.StatusOK, nil)
+
+	reports := Reports()
+	if len(reports) != 2 {
+		t.Fatalf("Reports() = %v, want one per specification", reports)
+	}
+
+	for i, want := range []struct {
+		specID  string
+		checked int
+	}{{"v1", 1}, {"v2", 2}} {
+		if reports[i].SpecID != want.specID || reports[i].Checked != want.checked {
+			t.Errorf("report %d = %s checked %d times, want %s checked %d times", i, reports[i].SpecID, reports[i].Checked, want.specID, want.checked)
+		}
+	}
+}
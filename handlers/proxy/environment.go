@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/render"
+)
+
+// defaultEnvironment names the environment of the host documented by a specification.
+const defaultEnvironment = "default"
+
+// environments returns the configured environments of each specification, keyed by specification ID.
+// An environment is a target with a name, and is configured the same way as a proxy path.
+func environments() (map[string][]*target, error) {
+	envs := make(map[string][]*target)
+
+	for id, v := range viper.GetStringMap(config.Environments) {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("environments of %s must be a list", id)
+		}
+
+		for i, e := range list {
+			t := newTarget("")
+
+			if err := t.decode(e); err != nil {
+				return nil, fmt.Errorf("environment %d of %s: %w", i, id, err)
+			}
+
+			if t.Name == "" {
+				return nil, fmt.Errorf("environment %d of %s has no name", i, id)
+			}
+
+			envs[id] = append(envs[id], t)
+		}
+	}
+
+	return envs, nil
+}
+
+// registerEnvironments routes the requests of the explorer of each specification to the environment
+// selected by cookie, or the first environment when none is.
+func registerEnvironments(rtr *mux.Router, envs map[string][]*target, reg *registration, rnd *render.Renderer) {
+	ids := make([]string, 0, len(envs))
+	for id := range envs {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		s, ok := reg.suite.Specs[id]
+		if !ok {
+			log().Warnf("Environments configured for unknown specification %s", id)
+
+			continue
+		}
+
+		prefix := "/" + id + TryPath
+		handlers := make(map[string]http.Handler, len(envs[id]))
+		names := make([]string, 0, len(envs[id]))
+
+		for _, t := range envs[id] {
+			t.Route = prefix + "/"
+			t.StripPrefix = prefix
+			t.spec = s
+
+			log().Tracef("+ %s -> %s", t.label(), t.URL)
+
+			h, err := newHandler(t, reg)
+			if err != nil {
+				log().Errorf("Error configuring proxy for %s: %s", t.label(), err)
+
+				continue
+			}
+
+			handlers[t.Name] = h
+			names = append(names, t.Name)
+		}
+
+		if len(names) == 0 {
+			continue
+		}
+
+		rnd.SetExplorerURL(s, prefix)
+		rnd.SetEnvironments(s, names)
+
+		rtr.PathPrefix(prefix + "/").Handler(selectEnvironment(handlers, names[0]))
+	}
+}
+
+func selectEnvironment(handlers map[string]http.Handler, fallback string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := fallback
+
+		if c, err := r.Cookie(render.EnvironmentCookie); err == nil {
+			if _, ok := handlers[c.Value]; ok {
+				name = c.Value
+			}
+		}
+
+		log().Tracef("Environment %s selected for %s", name, r.URL.Path)
+
+		handlers[name].ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/render"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+func TestEnvironments(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    []string // Names of the environments of the pets specification
+		wantErr string
+	}{
+		{
+			name: "named",
+			value: map[string]interface{}{"pets": []interface{}{
+				map[string]interface{}{"name": "staging", "target": "https://staging.example.com"},
+				map[string]interface{}{"name": "production", "target": "https://example.com", "timeout": "5s"},
+			}},
+			want: []string{"staging", "production"},
+		},
+		{name: "not a list", value: map[string]interface{}{"pets": "https://example.com"}, wantErr: "must be a list"},
+		{name: "without a name", value: map[string]interface{}{"pets": []interface{}{"https://example.com"}}, wantErr: "has no name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Restore()
+			viper.Set(config.Environments, tt.value)
+
+			envs, err := environments()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("environments() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("environments() error = %v", err)
+			}
+
+			var got []string
+			for _, e := range envs["pets"] {
+				got = append(got, e.Name)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("environments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterEnvironments(t *testing.T) {
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name + " " + r.URL.Path))
+		}))
+	}
+
+	staging, production := upstream("staging"), upstream("production")
+	defer staging.Close()
+	defer production.Close()
+
+	config.Restore()
+
+	suite := &spec.Suite{Specs: map[string]*spec.APISpecification{"pets": {ID: "pets"}}}
+	envs := map[string][]*target{
+		"pets": {
+			{Name: "staging", URL: staging.URL},
+			{Name: "production", URL: production.URL},
+		},
+		"unknown": {{Name: "staging", URL: staging.URL}},
+	}
+
+	reg := newRegistration(suite)
+	defer reg.balancers.stop()
+
+	rtr := mux.NewRouter()
+	registerEnvironments(rtr, envs, reg, render.New(suite, nil))
+
+	tests := []struct {
+		name   string
+		cookie string
+		path   string
+		want   string
+	}{
+		{name: "first by default", path: "/pets/try/pets", want: "staging /pets"},
+		{name: "selected", cookie: "production", path: "/pets/try/pets", want: "production /pets"},
+		{name: "unknown selection", cookie: "qa", path: "/pets/try/pets", want: "staging /pets"},
+		{name: "unknown specification", path: "/unknown/try/pets", want: "404 page not found\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: render.EnvironmentCookie, Value: tt.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			rtr.ServeHTTP(w, req)
+
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("response = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"github.com/kenjones-cisco/dapperdox/auth"
+)
+
+// all identity types.
+const (
+	identityAccessToken = "access-token"
+	identityJWT         = "jwt"
+	identityAPIKey      = "api-key"
+)
+
+const defaultJWTTTL = 5 * time.Minute
+
+var (
+	errNotSignedIn = errors.New("sign in to call this API")
+	errNoAPIKey    = errors.New("you have no API key for this API")
+	errNotExplorer = errors.New("only the API explorer may call this API as you")
+)
+
+// identity forwards the signed in reader to the upstream, so the API explorer acts as them: by
+// their OIDC access token, a short-lived JWT minted for the upstream, or their own API key.
+type identity struct {
+	Type     string   `mapstructure:"type"`     // access-token, jwt or api-key
+	Header   string   `mapstructure:"header"`   // Header carrying the identity, Authorization by default
+	Scheme   string   `mapstructure:"scheme"`   // Authorization scheme, Bearer by default for tokens
+	Required bool     `mapstructure:"required"` // Whether readers must sign in to call the API
+	JWT      *minter  `mapstructure:"jwt"`
+	APIKeys  *apiKeys `mapstructure:"api-keys"`
+}
+
+// minter signs JWTs for the reader, carrying the selected claims.
+type minter struct {
+	Issuer    string        `mapstructure:"issuer"`
+	Audience  []string      `mapstructure:"audience"`
+	TTL       time.Duration `mapstructure:"ttl"`
+	Claims    []string      `mapstructure:"claims"`    // Claims of the reader copied into the JWT
+	Algorithm string        `mapstructure:"algorithm"` // HS256 by default, or RS256 or ES256 with a PEM key
+	Key       secret        `mapstructure:"key"`
+
+	signer jose.Signer
+}
+
+// apiKeys looks up the API key of the reader, in a file of user:key lines read when the proxy is
+// registered.
+type apiKeys struct {
+	File string `mapstructure:"file"`
+
+	keys map[string]string // Keyed by user name
+}
+
+type identityKey struct{}
+
+// resolve prepares the identity to be forwarded, reading keys.
+func (id *identity) resolve() error {
+	if id.Header == "" {
+		id.Header = "Authorization"
+	}
+
+	switch strings.ToLower(id.Type) {
+	case identityAccessToken:
+	case identityJWT:
+		if id.JWT == nil {
+			return errors.New("no jwt settings given")
+		}
+
+		if err := id.JWT.resolve(); err != nil {
+			return fmt.Errorf("jwt: %w", err)
+		}
+	case identityAPIKey:
+		if id.APIKeys == nil {
+			return errors.New("no api-keys settings given")
+		}
+
+		if err := id.APIKeys.resolve(); err != nil {
+			return fmt.Errorf("api-keys: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", id.Type)
+	}
+
+	if id.Scheme == "" && id.Header == "Authorization" && !strings.EqualFold(id.Type, identityAPIKey) {
+		id.Scheme = "Bearer"
+	}
+
+	return nil
+}
+
+// value returns the header value identifying the reader of the request, or "" for anonymous readers
+// when the identity is not required.
+func (id *identity) value(r *http.Request) (string, error) {
+	u := auth.FromContext(r.Context())
+	if u == nil {
+		if id.Required {
+			return "", errNotSignedIn
+		}
+
+		return "", nil
+	}
+
+	if r.Header.Get(ExplorerHeader) == "" {
+		return "", errNotExplorer
+	}
+
+	var (
+		v   string
+		err error
+	)
+
+	switch strings.ToLower(id.Type) {
+	case identityAccessToken:
+		v, err = u.AccessToken()
+	case identityJWT:
+		v, err = id.JWT.mint(u)
+	case identityAPIKey:
+		v = id.APIKeys.keys[u.Name]
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if v == "" {
+		if strings.EqualFold(id.Type, identityAPIKey) {
+			return "", errNoAPIKey
+		}
+
+		return "", fmt.Errorf("%s has no %s", u.Name, id.Type)
+	}
+
+	if id.Scheme != "" {
+		v = id.Scheme + " " + v
+	}
+
+	return v, nil
+}
+
+// forward identifies the reader of the request to the upstream, answering the client itself and
+// returning false when the reader cannot be identified, or the request was not sent by the explorer.
+func (id *identity) forward(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	v, err := id.value(r)
+
+	switch {
+	case errors.Is(err, errNotSignedIn):
+		writeError(w, http.StatusUnauthorized, err.Error())
+
+		return r, false
+	case errors.Is(err, errNoAPIKey), errors.Is(err, errNotExplorer):
+		writeError(w, http.StatusForbidden, err.Error())
+
+		return r, false
+	case err != nil:
+		log().Errorf("Error identifying reader to %s: %s", r.URL.Path, err)
+		writeError(w, http.StatusBadGateway, "unable to identify you to this API")
+
+		return r, false
+	case v == "":
+		return r, true
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, v)), true
+}
+
+// apply sets the identity of the reader on the outgoing request.
+func (id *identity) apply(r *http.Request) {
+	r.Header.Del(ExplorerHeader)
+
+	if v, ok := r.Context().Value(identityKey{}).(string); ok {
+		r.Header.Set(id.Header, v)
+	}
+}
+
+func (m *minter) resolve() error {
+	if m.TTL <= 0 {
+		m.TTL = defaultJWTTTL
+	}
+
+	k, err := m.Key.resolve()
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+
+	if k == "" {
+		return errors.New("no key given")
+	}
+
+	alg := jose.SignatureAlgorithm(strings.ToUpper(m.Algorithm))
+	if alg == "" {
+		alg = jose.HS256
+	}
+
+	var key interface{}
+
+	switch alg {
+	case jose.HS256, jose.HS384, jose.HS512:
+		key = []byte(k)
+	case jose.RS256, jose.RS384, jose.RS512, jose.ES256, jose.ES384, jose.ES512:
+		if key, err = privateKey([]byte(k)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+
+	m.signer, err = jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, (&jose.SignerOptions{}).WithType("JWT"))
+
+	return err
+}
+
+// mint returns a signed JWT for the reader, valid for the configured time to live.
+func (m *minter) mint(u *auth.User) (string, error) {
+	now := time.Now()
+
+	claims := map[string]interface{}{}
+	for _, name := range m.Claims {
+		if v, ok := u.Claim(name); ok {
+			claims[name] = v
+		}
+	}
+
+	std := jwt.Claims{
+		Issuer:   m.Issuer,
+		Subject:  u.Name,
+		Audience: m.Audience,
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(m.TTL)),
+	}
+
+	return jwt.Signed(m.signer).Claims(claims).Claims(std).CompactSerialize()
+}
+
+func privateKey(b []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("key is not PEM encoded")
+	}
+
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if s, ok := k.(crypto.Signer); ok {
+			return s, nil
+		}
+	}
+
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+
+	if k, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+
+	return nil, errors.New("unsupported private key")
+}
+
+func (a *apiKeys) resolve() error {
+	if a.File == "" {
+		return errors.New("no file given")
+	}
+
+	return a.read()
+}
+
+// read loads the API keys file, skipping blank lines and comments.
+func (a *apiKeys) read() error {
+	f, err := os.Open(a.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	a.keys = make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		a.keys[parts[0]] = strings.TrimSpace(parts[1])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	log().Debugf("Loaded %d API keys from %s", len(a.keys), a.File)
+
+	return nil
+}
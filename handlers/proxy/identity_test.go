@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"github.com/kenjones-cisco/dapperdox/auth"
+)
+
+func TestIdentityForward(t *testing.T) {
+	keys := filepath.Join(t.TempDir(), "keys")
+	if err := ioutil.WriteFile(keys, []byte("# readers\nalice: alice-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &auth.User{Name: "alice"}
+	oidc := auth.NewUser("alice", nil, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+
+	tests := []struct {
+		name       string
+		id         identity
+		user       *auth.User
+		notSent    bool // Whether the request is not sent by the explorer
+		wantCode   int  // 0 when the request is forwarded
+		wantHeader string
+		want       string
+	}{
+		{
+			name:       "access token",
+			id:         identity{Type: identityAccessToken},
+			user:       oidc,
+			wantHeader: "Authorization",
+			want:       "Bearer token",
+		},
+		{
+			name:     "not sent by the explorer",
+			id:       identity{Type: identityAccessToken},
+			user:     oidc,
+			notSent:  true,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "access token of a reader signed in otherwise",
+			id:       identity{Type: identityAccessToken},
+			user:     alice,
+			wantCode: http.StatusBadGateway,
+		},
+		{
+			name:       "api key",
+			id:         identity{Type: identityAPIKey, Header: "X-API-Key", APIKeys: &apiKeys{File: keys}},
+			user:       alice,
+			wantHeader: "X-API-Key",
+			want:       "alice-key",
+		},
+		{
+			name:     "reader without an api key",
+			id:       identity{Type: identityAPIKey, Header: "X-API-Key", APIKeys: &apiKeys{File: keys}},
+			user:     &auth.User{Name: "bob"},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "anonymous reader required to sign in",
+			id:       identity{Type: identityAPIKey, Required: true, APIKeys: &apiKeys{File: keys}},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "anonymous reader",
+			id:         identity{Type: identityAPIKey, APIKeys: &apiKeys{File: keys}},
+			wantHeader: "Authorization",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.id.resolve(); err != nil {
+				t.Fatalf("resolve() error = %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/pets", nil)
+			if !tt.notSent {
+				req.Header.Set(ExplorerHeader, "explorer")
+			}
+
+			if tt.user != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), tt.user))
+			}
+
+			w := httptest.NewRecorder()
+
+			req, ok := tt.id.forward(w, req)
+			if ok != (tt.wantCode == 0) {
+				t.Fatalf("forward() = %v, status %d, want status %d", ok, w.Code, tt.wantCode)
+			}
+
+			if !ok {
+				if w.Code != tt.wantCode {
+					t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+				}
+
+				return
+			}
+
+			tt.id.apply(req)
+
+			if req.Header.Get(ExplorerHeader) != "" {
+				t.Errorf("%s forwarded upstream", ExplorerHeader)
+			}
+
+			if got := req.Header.Get(tt.wantHeader); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.wantHeader, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMint(t *testing.T) {
+	m := &minter{
+		Issuer:   "portal",
+		Audience: []string{"pets"},
+		Claims:   []string{"email", "groups", "missing"},
+		Key:      secret{Value: "0123456789abcdef0123456789abcdef"},
+	}
+	if err := m.resolve(); err != nil {
+		t.Fatalf("resolve() error = %v", err)
+	}
+
+	u := &auth.User{Name: "alice", Groups: []string{"admins"}, Claims: map[string]interface{}{"email": "alice@example.com"}}
+
+	raw, err := m.mint(u)
+	if err != nil {
+		t.Fatalf("mint() error = %v", err)
+	}
+
+	tok, err := jwt.ParseSigned(raw)
+	if err != nil {
+		t.Fatalf("ParseSigned() error = %v", err)
+	}
+
+	var (
+		std    jwt.Claims
+		claims map[string]interface{}
+	)
+
+	if err := tok.Claims([]byte(m.Key.Value), &std, &claims); err != nil {
+		t.Fatalf("Claims() error = %v", err)
+	}
+
+	if err := std.Validate(jwt.Expected{Issuer: "portal", Subject: "alice", Audience: jwt.Audience{"pets"}}); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	if ttl := std.Expiry.Time().Sub(std.IssuedAt.Time()); ttl != defaultJWTTTL {
+		t.Errorf("time to live = %s, want %s", ttl, defaultJWTTTL)
+	}
+
+	if claims["email"] != "alice@example.com" {
+		t.Errorf("email = %v, want alice@example.com", claims["email"])
+	}
+
+	if groups, _ := claims["groups"].([]interface{}); len(groups) != 1 || groups[0] != "admins" {
+		t.Errorf("groups = %v, want [admins]", claims["groups"])
+	}
+
+	if _, ok := claims["missing"]; ok {
+		t.Error("claim the reader does not have minted")
+	}
+
+	if err := std.ValidateWithLeeway(jwt.Expected{Time: time.Now().Add(defaultJWTTTL + time.Minute)}, 0); err == nil {
+		t.Error("minted token valid past its time to live")
+	}
+}
+
+func TestIdentityResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      identity
+		wantErr string
+	}{
+		{name: "unknown type", id: identity{Type: "password"}, wantErr: "unknown type"},
+		{name: "jwt without settings", id: identity{Type: identityJWT}, wantErr: "no jwt settings"},
+		{name: "jwt without key", id: identity{Type: identityJWT, JWT: &minter{}}, wantErr: "no key given"},
+		{name: "jwt of unknown algorithm", id: identity{Type: identityJWT, JWT: &minter{Algorithm: "none", Key: secret{Value: "k"}}}, wantErr: "unsupported algorithm"},
+		{name: "api keys without a file", id: identity{Type: identityAPIKey, APIKeys: &apiKeys{}}, wantErr: "no file given"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.id.resolve()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolve() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -20,68 +20,289 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package proxy
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/capture"
+	"github.com/kenjones-cisco/dapperdox/handlers/requestlog"
+	"github.com/kenjones-cisco/dapperdox/metrics"
+	"github.com/kenjones-cisco/dapperdox/render"
+	"github.com/kenjones-cisco/dapperdox/spec"
+	"github.com/kenjones-cisco/dapperdox/tracing"
 )
 
-type responseCapture struct {
-	http.ResponseWriter
-	statusCode int
+// TryPath follows the specification ID in the routes proxied automatically to the hosts of the specifications.
+const TryPath = "/try"
+
+// ExplorerHeader is set by the API explorer on the requests it sends to the portal. Browsers only
+// let other sites set it after a CORS preflight, so requests forwarding the identity of the reader
+// must carry it, as they are exempt from the CSRF token pages are submitted with.
+const ExplorerHeader = "X-Requested-By"
+
+// registration holds what the proxied routes registered for a build of the portal share.
+type registration struct {
+	suite       *spec.Suite
+	rec         *recorder
+	balancers   *balancers
+	validateMax int64 // Largest request body validated
+	conformMax  int64 // Largest response body checked for conformance
 }
 
-func (r *responseCapture) WriteHeader(status int) {
-	r.statusCode = status
-	r.ResponseWriter.WriteHeader(status)
+func newRegistration(suite *spec.Suite) *registration {
+	return &registration{
+		suite:       suite,
+		rec:         newRecorder(),
+		balancers:   &balancers{},
+		validateMax: int64(viper.GetSizeInBytes(config.ProxyValidateMax)),
+		conformMax:  int64(viper.GetSizeInBytes(config.ProxyConformMax)),
+	}
 }
 
-// Register handles registering paths to proxy.
-func Register(r *mux.Router) {
+// Register handles registering paths to proxy, and those the explorer of the specifications of the
+// suite sends requests to. It returns a function stopping the health checks of the upstream targets,
+// for when the routes are no longer served.
+func Register(r *mux.Router, suite *spec.Suite, rnd *render.Renderer) func() {
 	log().Debug("Registering proxied paths:")
 
-	for k, v := range viper.GetStringMapString(config.ProxyPath) {
-		register(r, k, v)
+	reg := newRegistration(suite)
+
+	list, err := targets()
+	if err != nil {
+		log().Errorf("Error reading proxy paths: %s", err)
+
+		return reg.balancers.stop
+	}
+
+	envs, err := environments()
+	if err != nil {
+		log().Errorf("Error reading environments: %s", err)
+
+		return reg.balancers.stop
+	}
+
+	if viper.GetBool(config.ProxyAuto) {
+		for _, t := range specTargets(suite, list) {
+			if _, ok := envs[t.spec.ID]; ok {
+				// The documented host is offered alongside the configured environments.
+				t.Name = defaultEnvironment
+				envs[t.spec.ID] = append([]*target{t}, envs[t.spec.ID]...)
+
+				continue
+			}
+
+			rnd.SetExplorerURL(t.spec, t.StripPrefix)
+
+			list = append(list, t)
+		}
+	}
+
+	registerEnvironments(r, envs, reg, rnd)
+
+	for _, t := range list {
+		register(r, t, reg)
+	}
+
+	if len(list) > 0 || len(envs) > 0 {
+		log().Debugf("+ %s proxy status", StatusPath)
+
+		r.Path(StatusPath).Methods(http.MethodGet).HandlerFunc(statusHandler(rnd, reg.balancers))
+	}
+
+	if viper.GetBool(config.ProxyConformance) && viper.GetBool(config.ShowAssets) {
+		log().Debugf("+ %s conformance report", ConformancePath)
+
+		r.Path(ConformancePath).Methods(http.MethodGet).HandlerFunc(conformanceHandler(rnd))
 	}
 
 	log().Debug("Registering proxied paths done.")
+
+	return reg.balancers.stop
 }
 
-func register(rtr *mux.Router, routePattern, target string) {
-	u, _ := url.Parse(target)
+func register(rtr *mux.Router, t *target, reg *registration) {
+	log().Tracef("+ %s -> %s", t.Route, strings.Join(t.upstreams(), ", "))
+
+	h, err := newHandler(t, reg)
+	if err != nil {
+		log().Errorf("Error configuring proxy for %s: %s", t.label(), err)
 
-	log().Tracef("+ %s -> %s", routePattern, target)
+		return
+	}
 
-	proxy := httputil.NewSingleHostReverseProxy(u)
-	od := proxy.Director
+	rtr.PathPrefix(t.Route).Handler(h)
+}
 
-	proxy.Director = func(r *http.Request) {
-		od(r)
-		r.Host = r.URL.Host // Rewrite Host
+// newHandler returns the handler proxying requests to the target.
+func newHandler(t *target, reg *registration) (http.Handler, error) {
+	rec := reg.rec
 
-		scheme := "http://"
-		if r.TLS != nil {
-			scheme = "https://"
-		}
+	tr, err := t.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	limiter, err := t.limiter()
+	if err != nil {
+		return nil, err
+	}
+
+	lb, err := newBalancer(t, tr)
+	if err != nil {
+		return nil, err
+	}
+
+	reg.balancers.add(lb)
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			if _, ok := r.Header["User-Agent"]; !ok {
+				// explicitly disable User-Agent so it's not set to default value
+				r.Header.Set("User-Agent", "")
+			}
+
+			if t.StripPrefix != "" {
+				r.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, t.StripPrefix), "/")
+				r.URL.RawPath = ""
+			}
+
+			t.apply(r)
+
+			if id := requestlog.ID(r.Context()); id != "" {
+				r.Header.Set(requestlog.Header, id)
+			}
+
+			tracing.Inject(r.Context(), r.Header)
+		},
+		Transport:     lb,
+		FlushInterval: t.FlushInterval,
+		ErrorHandler:  proxyError,
+	}
+
+	validate := viper.GetBool(config.ProxyValidate)
+	conform := viper.GetBool(config.ProxyConformance)
+
+	var modifiers []func(*http.Response) error
+
+	if conform {
+		modifiers = append(modifiers, checkConformance(reg.conformMax))
+	}
 
-		log().Debugf("Proxy request to: %s%s%s", scheme, r.Host, r.URL.Path)
+	if rec != nil && rec.mode == modeRecord {
+		modifiers = append(modifiers, rec.record)
 	}
 
-	rtr.PathPrefix(routePattern).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		rc := &responseCapture{w, 0}
+	if len(modifiers) > 0 {
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			for _, modify := range modifiers {
+				if err := modify(resp); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if validate || conform || rec != nil {
+			specification, method, params := matchMethod(reg.suite, t, r)
+			if method == nil {
+				log().Debugf("No documented operation for %s %s", r.Method, r.URL.Path)
+			} else {
+				if validate && !validRequest(w, r, t, method, params, reg.validateMax) {
+					return
+				}
+
+				r = r.WithContext(withSpec(withMethod(r.Context(), method), specification))
+				requestlog.SetOperation(r.Context(), method.ID)
+			}
+		}
+
+		if t.spec != nil {
+			requestlog.SetSpec(r.Context(), t.spec.ID)
+		}
+
+		if rec != nil && rec.mode == modeReplay {
+			if !rec.replay(w, r, methodFrom(r.Context())) {
+				log().Infof("REPLAY %s %s has no matching fixture", r.Method, r.URL.Path)
+				writeError(w, http.StatusNotFound, "no recorded response matches the request")
+
+				return
+			}
+
+			log().Infof("REPLAY %s %s", r.Method, r.URL.Path)
+
+			return
+		}
+
+		if t.Identity != nil {
+			var ok bool
+			if r, ok = t.Identity.forward(w, r); !ok {
+				return
+			}
+		}
+
+		if rec != nil {
+			r = rec.capture(r)
+		}
+
+		if t.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), t.Timeout)
+			defer cancel()
+
+			r = r.WithContext(ctx)
+		}
+
+		requestlog.SetProxyTarget(r.Context(), t.label())
+
+		ctx, span := tracing.Start(r.Context(), "proxy "+t.label(),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(tracing.String("proxy.target", t.label()), tracing.String("proxy.route", t.Route)))
+		defer span.End()
+
+		r = r.WithContext(ctx)
+
+		rc := capture.Wrap(w)
 		s := time.Now()
 		log().Tracef("Proxy request started: %v", s)
 
 		proxy.ServeHTTP(rc, r)
 
+		tracing.End(span, rc.Status())
+
 		e := time.Now()
 		log().Tracef("Proxy request completed: %v", e)
 
-		log().Infof("PROXY %s %s (%d, %v)", r.Method, r.URL.Path, rc.statusCode, e.Sub(s))
+		log().Infof("PROXY %s %s (%d, %v)", r.Method, r.URL.Path, rc.Status(), e.Sub(s))
+		metrics.ObserveProxy(t.label(), rc.Status(), e.Sub(s))
 	})
+
+	if limiter == nil {
+		return h, nil
+	}
+
+	return limiter.Handler(h, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusTooManyRequests, "too many requests")
+	})), nil
+}
+
+func proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	log().Warnf("Proxy error for %s %s: %s", r.Method, r.URL.Path, err)
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "upstream request timed out")
+
+		return
+	}
+
+	writeError(w, http.StatusBadGateway, "upstream request failed")
 }
@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/auth"
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/requestlog"
+	"github.com/kenjones-cisco/dapperdox/spec"
+	"github.com/kenjones-cisco/dapperdox/tracing"
+)
+
+func TestProxyStripsPortalCredentials(t *testing.T) {
+	var upstream *http.Request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+	}))
+	defer srv.Close()
+
+	config.Restore()
+	viper.Set(config.AuthProvider, auth.ProviderToken)
+	viper.Set(config.AuthToken, "secret")
+
+	gate, err := auth.Register(mux.NewRouter(), &spec.Suite{})
+	if err != nil {
+		t.Fatalf("auth.Register() error = %v", err)
+	}
+
+	tg := newTarget("/api/")
+	tg.URL = srv.URL
+
+	reg := newRegistration(&spec.Suite{})
+	defer reg.balancers.stop()
+
+	h, err := newHandler(tg, reg)
+	if err != nil {
+		t.Fatalf("newHandler() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/things?token=secret&a=1", nil)
+	req.AddCookie(&http.Cookie{Name: viper.GetString(config.AuthSessionCookie), Value: "session"})
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+
+	w := httptest.NewRecorder()
+	auth.Handler(gate, http.NotFoundHandler())(h).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || upstream == nil {
+		t.Fatalf("proxied request answered %d, want it forwarded", w.Code)
+	}
+
+	if got := upstream.URL.RawQuery; got != "a=1" {
+		t.Errorf("upstream query = %q, want the token removed", got)
+	}
+
+	if got := upstream.Header.Get("Cookie"); got != "theme=dark" {
+		t.Errorf("upstream Cookie = %q, want the session cookie removed", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/things", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	auth.Handler(gate, http.NotFoundHandler())(h).ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := upstream.Header.Get("Authorization"); got != "" {
+		t.Errorf("upstream Authorization = %q, want the portal token removed", got)
+	}
+}
+
+func TestProxyTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	config.Restore()
+
+	tests := []struct {
+		name     string
+		setup    func(*target)
+		wantCode int
+	}{
+		{name: "whole exchange", setup: func(tg *target) { tg.Timeout = 20 * time.Millisecond }, wantCode: http.StatusGatewayTimeout},
+		{name: "response headers", setup: func(tg *target) { tg.ResponseHeaderTimeout = 20 * time.Millisecond }, wantCode: http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tg := newTarget("/api/")
+			tg.URL = srv.URL
+			tt.setup(tg)
+
+			reg := newRegistration(&spec.Suite{})
+			defer reg.balancers.stop()
+
+			h, err := newHandler(tg, reg)
+			if err != nil {
+				t.Fatalf("newHandler() error = %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/things", nil))
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	tg := newTarget("/api/")
+	tg.DialTimeout = 50 * time.Millisecond
+
+	tr, err := tg.transport()
+	if err != nil {
+		t.Fatalf("transport() error = %v", err)
+	}
+
+	// A non-routable address, which either refuses at once or never answers the dial.
+	req := httptest.NewRequest(http.MethodGet, "http://10.255.255.1/", nil)
+	req.RequestURI = ""
+
+	s := time.Now()
+
+	if _, err := tr.RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip() error = nil, want the dial to fail")
+	}
+
+	if elapsed := time.Since(s); elapsed > 5*time.Second {
+		t.Errorf("dial failed after %s, want it bounded by the dial timeout", elapsed)
+	}
+}
+
+func TestProxyStreams(t *testing.T) {
+	release := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer upstream.Close()
+
+	config.Restore()
+
+	tg := newTarget("/api/")
+	tg.URL = upstream.URL
+	tg.FlushInterval = -1
+
+	reg := newRegistration(&spec.Suite{})
+	defer reg.balancers.stop()
+
+	h, err := newHandler(tg, reg)
+	if err != nil {
+		t.Fatalf("newHandler() error = %v", err)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/events")
+	if err != nil {
+		close(release)
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The first event arrives while the upstream is still streaming.
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	close(release)
+
+	if err != nil || line != "data: 1\n" {
+		t.Errorf("first line = %q, error %v, want the first event", line, err)
+	}
+}
+
+func TestProxyForwardsRequestID(t *testing.T) {
+	var upstream *http.Request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+	}))
+	defer srv.Close()
+
+	config.Restore()
+
+	tg := newTarget("/api/")
+	tg.URL = srv.URL
+
+	reg := newRegistration(&spec.Suite{})
+	defer reg.balancers.stop()
+
+	h, err := newHandler(tg, reg)
+	if err != nil {
+		t.Fatalf("newHandler() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/things", nil)
+	req.Header.Set(requestlog.Header, "edge-1234")
+
+	requestlog.Handler(h).ServeHTTP(httptest.NewRecorder(), req)
+
+	if upstream == nil || upstream.Header.Get(requestlog.Header) != "edge-1234" {
+		t.Errorf("upstream %s not forwarded", requestlog.Header)
+	}
+}
+
+func TestProxyPropagatesTrace(t *testing.T) {
+	var upstream *http.Request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+	}))
+	defer srv.Close()
+
+	config.Restore()
+
+	if _, err := tracing.Init(); err != nil {
+		t.Fatalf("tracing.Init() error = %v", err)
+	}
+
+	tg := newTarget("/api/")
+	tg.URL = srv.URL
+
+	reg := newRegistration(&spec.Suite{})
+	defer reg.balancers.stop()
+
+	h, err := newHandler(tg, reg)
+	if err != nil {
+		t.Fatalf("newHandler() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/things", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	tracing.Middleware(h).ServeHTTP(httptest.NewRecorder(), req)
+
+	if upstream == nil {
+		t.Fatal("request not forwarded")
+	}
+
+	if !strings.Contains(upstream.Header.Get("traceparent"), "0af7651916cd43dd8448eb211c80319c") {
+		t.Errorf("upstream traceparent = %q, want the trace of the client", upstream.Header.Get("traceparent"))
+	}
+}
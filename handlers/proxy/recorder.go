@@ -0,0 +1,354 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/spec"
+	"github.com/kenjones-cisco/dapperdox/validator"
+)
+
+// all recorder modes.
+const (
+	modeRecord = "record"
+	modeReplay = "replay"
+)
+
+// unmatchedOperation names the fixture directory of requests without a documented operation.
+const unmatchedOperation = "_unmatched"
+
+// unsafeName matches the characters of an operation ID not kept in the name of its fixture directory.
+var unsafeName = regexp.MustCompile(`[^\w.-]`)
+
+type (
+	requestBodyKey struct{}
+	originalURLKey struct{}
+)
+
+// fixture is a recorded request and the upstream response to it.
+type fixture struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+type recordedRequest struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	Query        string `json:"query,omitempty"`
+	Body         string `json:"body,omitempty"`
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+}
+
+type recordedResponse struct {
+	Status       int         `json:"status"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+// recorder writes proxied traffic to, or answers requests from, a directory of fixtures
+// keyed by operation ID.
+type recorder struct {
+	mode    string
+	dir     string
+	match   map[string]bool // Request attributes compared when replaying: path, query, body
+	maxBody int64           // Largest request or response body recorded
+
+	fixtures map[string][]*fixture // Key is operation ID, loaded before any request is replayed
+}
+
+// newRecorder returns the recorder for the configured proxy mode, or nil when traffic is proxied as is.
+func newRecorder() *recorder {
+	mode := strings.ToLower(viper.GetString(config.ProxyMode))
+	if mode != modeRecord && mode != modeReplay {
+		if mode != "" {
+			log().Errorf("Unknown proxy mode %q, proxying without recording", mode)
+		}
+
+		return nil
+	}
+
+	rc := &recorder{
+		mode:     mode,
+		dir:      viper.GetString(config.ProxyFixturesDir),
+		match:    make(map[string]bool),
+		maxBody:  int64(viper.GetSizeInBytes(config.ProxyRecordMax)),
+		fixtures: make(map[string][]*fixture),
+	}
+
+	for _, m := range viper.GetStringSlice(config.ProxyReplayMatch) {
+		rc.match[strings.ToLower(m)] = true
+	}
+
+	log().Infof("Proxy is in %s mode, using fixtures in %s", mode, rc.dir)
+
+	if mode == modeReplay {
+		rc.load()
+	}
+
+	return rc
+}
+
+func (rc *recorder) load() {
+	_ = filepath.Walk(rc.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			log().Errorf("Error reading fixture %s: %s", path, err)
+
+			return nil
+		}
+
+		f := &fixture{}
+		if err := json.Unmarshal(b, f); err != nil {
+			log().Errorf("Error parsing fixture %s: %s", path, err)
+
+			return nil
+		}
+
+		operation := filepath.Base(filepath.Dir(path))
+		rc.fixtures[operation] = append(rc.fixtures[operation], f)
+
+		log().Tracef("  + fixture %s", path)
+
+		return nil
+	})
+}
+
+// capture keeps the request URL, as received before any proxy rules are applied, and a copy of
+// the request body, so they can be recorded alongside the response. A request with a body larger
+// than proxy.record.max-body is not recorded.
+func (rc *recorder) capture(r *http.Request) *http.Request {
+	u := *r.URL
+	r = r.WithContext(context.WithValue(r.Context(), originalURLKey{}, &u))
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return r
+	}
+
+	body, rest, err := validator.ReadLimited(r.Body, rc.maxBody)
+	r.Body = rest
+
+	if err != nil {
+		log().Errorf("Error reading request body to record: %s", err)
+	}
+
+	// A body too large to record is kept as nil, so the exchange is not recorded.
+	return r.WithContext(context.WithValue(r.Context(), requestBodyKey{}, body))
+}
+
+// record is a response modifier that writes the request and response to a fixture file. Event
+// streams, and exchanges with a body larger than proxy.record.max-body, are passed on unrecorded.
+func (rc *recorder) record(resp *http.Response) error {
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return nil
+	}
+
+	req := resp.Request
+
+	reqBody, ok := req.Context().Value(requestBodyKey{}).([]byte)
+	if ok && reqBody == nil {
+		log().Debugf("Not recording %s %s, as the request body is too large", req.Method, req.URL.Path)
+
+		return nil
+	}
+
+	if resp.ContentLength > rc.maxBody {
+		log().Debugf("Not recording %s %s, as the response body is too large", req.Method, req.URL.Path)
+
+		return nil
+	}
+
+	body, rest, err := validator.ReadLimited(resp.Body, rc.maxBody)
+	resp.Body = rest
+
+	if err != nil {
+		return err
+	}
+
+	if body == nil {
+		log().Debugf("Not recording %s %s, as the response body is too large", req.Method, req.URL.Path)
+
+		return nil
+	}
+
+	u, ok := req.Context().Value(originalURLKey{}).(*url.URL)
+	if !ok {
+		u = req.URL
+	}
+
+	f := &fixture{
+		Request:  recordedRequest{Method: req.Method, Path: u.Path, Query: u.Query().Encode()},
+		Response: recordedResponse{Status: resp.StatusCode, Headers: resp.Header.Clone()},
+	}
+	f.Request.Body, f.Request.BodyEncoding = encodeBody(reqBody)
+	f.Response.Body, f.Response.BodyEncoding = encodeBody(body)
+
+	operation := operationName(methodFrom(req.Context()))
+
+	b, err := json.MarshalIndent(f, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(rc.dir, operation)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log().Errorf("Error creating fixture directory %s: %s", dir, err)
+
+		return nil
+	}
+
+	file := filepath.Join(dir, rc.key(f)+".json")
+	if err := ioutil.WriteFile(file, b, 0o644); err != nil {
+		log().Errorf("Error writing fixture %s: %s", file, err)
+
+		return nil
+	}
+
+	log().Debugf("Recorded %s %s to %s", req.Method, u.Path, file)
+
+	return nil
+}
+
+// replay answers the request from the first fixture of its operation that matches, returning
+// false when there is none.
+func (rc *recorder) replay(w http.ResponseWriter, r *http.Request, method *spec.Method) bool {
+	body, rest, err := validator.ReadLimited(r.Body, rc.maxBody)
+	r.Body = rest
+
+	if err != nil {
+		log().Errorf("Error reading request body to replay: %s", err)
+	}
+
+	// No request with a larger body is recorded, so there is nothing to match it on.
+	if body == nil && rc.match["body"] {
+		return false
+	}
+
+	req := recordedRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query().Encode()}
+	req.Body, req.BodyEncoding = encodeBody(body)
+
+	for _, f := range rc.fixtures[operationName(method)] {
+		if !rc.matches(&f.Request, &req) {
+			continue
+		}
+
+		for k, v := range f.Response.Headers {
+			if k == "Content-Length" || k == "Transfer-Encoding" {
+				continue
+			}
+
+			w.Header()[k] = v
+		}
+
+		w.WriteHeader(f.Response.Status)
+		_, _ = w.Write(decodeBody(f.Response.Body, f.Response.BodyEncoding))
+
+		return true
+	}
+
+	return false
+}
+
+func (rc *recorder) matches(recorded, req *recordedRequest) bool {
+	if !strings.EqualFold(recorded.Method, req.Method) {
+		return false
+	}
+
+	if rc.match["path"] && recorded.Path != req.Path {
+		return false
+	}
+
+	if rc.match["query"] && recorded.Query != req.Query {
+		return false
+	}
+
+	if rc.match["body"] && canonicalBody(recorded) != canonicalBody(req) {
+		return false
+	}
+
+	return true
+}
+
+// key names the fixture file of a request by the attributes it is matched on, so recording
+// the same request again replaces the earlier fixture.
+func (rc *recorder) key(f *fixture) string {
+	h := sha1.New()
+	_, _ = h.Write([]byte(strings.ToUpper(f.Request.Method) + " " + f.Request.Path))
+
+	if rc.match["query"] {
+		_, _ = h.Write([]byte("?" + f.Request.Query))
+	}
+
+	if rc.match["body"] {
+		_, _ = h.Write([]byte(canonicalBody(&f.Request)))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// operationName names the fixture directory of the operation of a method. Operation IDs are taken
+// from the specification, so any that is not a safe file name is given a name of its own.
+func operationName(method *spec.Method) string {
+	if method == nil {
+		return unmatchedOperation
+	}
+
+	name := unsafeName.ReplaceAllString(method.ID, "_")
+	if name != method.ID || strings.Trim(name, ".") == "" {
+		sum := sha1.Sum([]byte(method.ID))
+		name += "-" + hex.EncodeToString(sum[:])[:8]
+	}
+
+	return name
+}
+
+// canonicalBody returns JSON bodies re-encoded, so that formatting differences do not matter.
+func canonicalBody(r *recordedRequest) string {
+	var v interface{}
+	if r.BodyEncoding == "" && json.Unmarshal([]byte(r.Body), &v) == nil {
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	}
+
+	return r.Body
+}
+
+func encodeBody(b []byte) (string, string) {
+	if utf8.Valid(b) {
+		return string(b), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(b), "base64"
+}
+
+func decodeBody(s, encoding string) []byte {
+	if encoding == "base64" {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			log().Errorf("Error decoding fixture body: %s", err)
+		}
+
+		return b
+	}
+
+	return []byte(s)
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+// newTestRecorder returns a recorder in the mode given, using fixtures in dir.
+func newTestRecorder(t *testing.T, mode, dir string, match ...string) *recorder {
+	t.Helper()
+
+	config.Restore()
+	viper.Set(config.ProxyMode, mode)
+	viper.Set(config.ProxyFixturesDir, dir)
+	viper.Set(config.ProxyRecordMax, "64")
+
+	if len(match) > 0 {
+		viper.Set(config.ProxyReplayMatch, match)
+	}
+
+	rc := newRecorder()
+	if rc == nil {
+		t.Fatalf("newRecorder() = nil in %s mode", mode)
+	}
+
+	return rc
+}
+
+// recordExchange records a request and the response to it, returning the response body passed on.
+func recordExchange(t *testing.T, rc *recorder, method *spec.Method, req *http.Request, body string, length int64) string {
+	t.Helper()
+
+	req = rc.capture(req.WithContext(withMethod(req.Context(), method)))
+
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: length,
+		Request:       req,
+	}
+
+	if err := rc.record(resp); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading the response passed on error = %v", err)
+	}
+
+	return string(b)
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	method := &spec.Method{ID: "createThing", Method: "post", Path: "/things"}
+
+	rc := newTestRecorder(t, modeRecord, dir, "path", "query", "body")
+	recordExchange(t, rc, method, httptest.NewRequest(http.MethodPost, "/things?a=1", strings.NewReader(`{"name": "x"}`)), `{"id": 1}`, 9)
+
+	rc = newTestRecorder(t, modeReplay, dir, "path", "query", "body")
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   bool
+	}{
+		{"same request", http.MethodPost, "/things?a=1", `{"name": "x"}`, true},
+		{"body formatted differently", http.MethodPost, "/things?a=1", `{ "name":"x" }`, true},
+		{"other body", http.MethodPost, "/things?a=1", `{"name": "y"}`, false},
+		{"other query", http.MethodPost, "/things?a=2", `{"name": "x"}`, false},
+		{"other path", http.MethodPost, "/others?a=1", `{"name": "x"}`, false},
+		{"other method", http.MethodPut, "/things?a=1", `{"name": "x"}`, false},
+		{"body over the limit", http.MethodPost, "/things?a=1", `{"name": "` + strings.Repeat("x", 64) + `"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			if got := rc.replay(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)), method); got != tt.want {
+				t.Fatalf("replay() = %t, want %t", got, tt.want)
+			}
+
+			if tt.want && (w.Code != http.StatusOK || w.Body.String() != `{"id": 1}`) {
+				t.Errorf("replay() answered %d %q, want the recorded response", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRecordLargeBodies(t *testing.T) {
+	dir := t.TempDir()
+	method := &spec.Method{ID: "getThing", Method: "get", Path: "/things"}
+	large := `{"data": "` + strings.Repeat("x", 64) + `"}`
+
+	rc := newTestRecorder(t, modeRecord, dir)
+
+	for _, length := range []int64{int64(len(large)), -1} {
+		if got := recordExchange(t, rc, method, httptest.NewRequest(http.MethodGet, "/things", nil), large, length); got != large {
+			t.Errorf("response of length %d passed on = %q, want %q", length, got, large)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(large))
+	if got := recordExchange(t, rc, method, req, `{}`, 2); got != `{}` {
+		t.Errorf("response passed on = %q, want %q", got, `{}`)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*", "*.json")); len(files) != 0 {
+		t.Errorf("recorded %v, want no fixture of a body over the limit", files)
+	}
+}
+
+func TestOperationName(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, id := range []string{"../../escape", "..", "a/b", `a\b`, ""} {
+		name := operationName(&spec.Method{ID: id})
+
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			t.Errorf("operationName(%q) = %q, want a safe file name", id, name)
+		}
+
+		if rel, err := filepath.Rel(dir, filepath.Join(dir, name)); err != nil || rel != name {
+			t.Errorf("operationName(%q) = %q, which is not within the fixtures directory", id, name)
+		}
+	}
+
+	if got := operationName(&spec.Method{ID: "getThing"}); got != "getThing" {
+		t.Errorf("operationName(getThing) = %q, want it kept as is", got)
+	}
+
+	if a, b := operationName(&spec.Method{ID: "a/b"}), operationName(&spec.Method{ID: "a_b"}); a == b {
+		t.Errorf("operationName() of a/b and a_b are both %q, want them distinct", a)
+	}
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/kenjones-cisco/dapperdox/auth"
+	"github.com/kenjones-cisco/dapperdox/validator"
+)
+
+// secret is a configured value, given inline, by environment variable or by file. Secrets are
+// resolved when the proxy is registered, and never sent to the client.
+type secret struct {
+	Value string `mapstructure:"value"`
+	Env   string `mapstructure:"env"`
+	File  string `mapstructure:"file"`
+}
+
+func (s secret) resolve() (string, error) {
+	switch {
+	case s.Env != "":
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+
+		return v, nil
+	case s.File != "":
+		b, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(string(b)), nil
+	default:
+		return s.Value, nil
+	}
+}
+
+// injection is a header or query parameter added to each proxied request.
+type injection struct {
+	Name   string `mapstructure:"name"`
+	secret `mapstructure:",squash"`
+
+	value string
+}
+
+// credential is the basic or bearer authorization sent upstream in place of any given by the client.
+type credential struct {
+	Type     string `mapstructure:"type"` // basic or bearer
+	Username string `mapstructure:"username"`
+	secret   `mapstructure:",squash"`
+
+	authorization string
+}
+
+// tlsConfig configures the TLS connection to the upstream.
+type tlsConfig struct {
+	CAFile     string `mapstructure:"ca-file"`
+	CertFile   string `mapstructure:"cert-file"`
+	KeyFile    string `mapstructure:"key-file"`
+	ServerName string `mapstructure:"server-name"`
+}
+
+// rules are the changes made to each request before it is forwarded to the target.
+type rules struct {
+	Headers      []*injection `mapstructure:"headers"`
+	StripHeaders []string     `mapstructure:"strip-headers"`
+	Query        []*injection `mapstructure:"query"`
+	Credential   *credential  `mapstructure:"credential"`
+	Identity     *identity    `mapstructure:"identity"`
+	TLS          *tlsConfig   `mapstructure:"tls"`
+}
+
+// resolve reads the secrets of the rules, so requests can be rewritten without further I/O.
+func (rl *rules) resolve() error {
+	for _, list := range [][]*injection{rl.Headers, rl.Query} {
+		for _, i := range list {
+			if i.Name == "" {
+				return errors.New("injected header or query parameter has no name")
+			}
+
+			v, err := i.resolve()
+			if err != nil {
+				return fmt.Errorf("%s: %w", i.Name, err)
+			}
+
+			i.value = v
+		}
+	}
+
+	if rl.Identity != nil {
+		if err := rl.Identity.resolve(); err != nil {
+			return fmt.Errorf("identity: %w", err)
+		}
+	}
+
+	if rl.Credential == nil {
+		return nil
+	}
+
+	v, err := rl.Credential.resolve()
+	if err != nil {
+		return fmt.Errorf("credential: %w", err)
+	}
+
+	switch strings.ToLower(rl.Credential.Type) {
+	case "basic":
+		rl.Credential.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(rl.Credential.Username+":"+v))
+	case "bearer":
+		rl.Credential.authorization = "Bearer " + v
+	default:
+		return fmt.Errorf("credential: unknown type %q", rl.Credential.Type)
+	}
+
+	return nil
+}
+
+// injected returns the headers and query parameters set on the outgoing request by the rules.
+func (rl *rules) injected() validator.Injected {
+	var in validator.Injected
+
+	for _, h := range rl.Headers {
+		in.Headers = append(in.Headers, h.Name)
+	}
+
+	for _, p := range rl.Query {
+		in.Query = append(in.Query, p.Name)
+	}
+
+	if rl.Credential != nil {
+		in.Headers = append(in.Headers, "Authorization")
+	}
+
+	if rl.Identity != nil {
+		in.Headers = append(in.Headers, rl.Identity.Header)
+	}
+
+	return in
+}
+
+// apply rewrites the outgoing request: the reader's portal credentials and configured headers are
+// stripped, then the headers, query parameters, credential and identity of the reader are set,
+// replacing any the client sent.
+func (rl *rules) apply(r *http.Request) {
+	auth.StripCredentials(r)
+
+	for _, h := range rl.StripHeaders {
+		r.Header.Del(h)
+	}
+
+	for _, h := range rl.Headers {
+		r.Header.Set(h.Name, h.value)
+	}
+
+	if len(rl.Query) > 0 {
+		q := r.URL.Query()
+		for _, p := range rl.Query {
+			q.Set(p.Name, p.value)
+		}
+
+		r.URL.RawQuery = q.Encode()
+	}
+
+	if rl.Credential != nil {
+		r.Header.Set("Authorization", rl.Credential.authorization)
+	}
+
+	if rl.Identity != nil {
+		rl.Identity.apply(r)
+	}
+}
+
+// config returns the TLS client configuration for the upstream, or nil to use the defaults.
+func (c *tlsConfig) config() (*tls.Config, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
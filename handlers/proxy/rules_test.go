@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRulesApply(t *testing.T) {
+	dir := t.TempDir()
+
+	token := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(token, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PROXY_TEST_PASSWORD", "env-password")
+
+	tests := []struct {
+		name      string
+		rules     rules
+		wantAuth  string
+		wantQuery string
+	}{
+		{
+			name:     "client credential kept",
+			wantAuth: "Bearer client",
+		},
+		{
+			name:     "bearer from a file",
+			rules:    rules{Credential: &credential{Type: "bearer", secret: secret{File: token}}},
+			wantAuth: "Bearer file-token",
+		},
+		{
+			name:     "basic from the environment",
+			rules:    rules{Credential: &credential{Type: "Basic", Username: "svc", secret: secret{Env: "PROXY_TEST_PASSWORD"}}},
+			wantAuth: "Basic c3ZjOmVudi1wYXNzd29yZA==",
+		},
+		{
+			name:      "query replaced",
+			rules:     rules{Query: []*injection{{Name: "key", secret: secret{Value: "upstream"}}}},
+			wantAuth:  "Bearer client",
+			wantQuery: "a=1&key=upstream",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rules.Headers = []*injection{{Name: "X-Tenant", secret: secret{Value: "acme"}}}
+			tt.rules.StripHeaders = []string{"X-Debug"}
+
+			if err := tt.rules.resolve(); err != nil {
+				t.Fatalf("resolve() error = %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/pets?a=1&key=client", nil)
+			r.Header.Set("Authorization", "Bearer client")
+			r.Header.Set("X-Tenant", "other")
+			r.Header.Set("X-Debug", "1")
+
+			tt.rules.apply(r)
+
+			if got := r.Header.Get("Authorization"); got != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", got, tt.wantAuth)
+			}
+
+			if got := r.Header.Get("X-Tenant"); got != "acme" {
+				t.Errorf("X-Tenant = %q, want acme", got)
+			}
+
+			if got := r.Header.Get("X-Debug"); got != "" {
+				t.Errorf("X-Debug = %q, want it stripped", got)
+			}
+
+			if tt.wantQuery != "" && r.URL.RawQuery != tt.wantQuery {
+				t.Errorf("query = %q, want %q", r.URL.RawQuery, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestRulesResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   rules
+		wantErr string
+	}{
+		{name: "header without a name", rules: rules{Headers: []*injection{{}}}, wantErr: "has no name"},
+		{name: "unset environment variable", rules: rules{Query: []*injection{{Name: "key", secret: secret{Env: "PROXY_TEST_UNSET"}}}}, wantErr: "PROXY_TEST_UNSET is not set"},
+		{name: "missing file", rules: rules{Credential: &credential{Type: "bearer", secret: secret{File: "missing"}}}, wantErr: "credential"},
+		{name: "unknown credential type", rules: rules{Credential: &credential{Type: "digest"}}, wantErr: "unknown type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rules.resolve()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolve() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	ca := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	empty := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		tls        *tlsConfig
+		wantErr    bool // Whether the configuration is rejected
+		wantReject bool // Whether the upstream certificate is not trusted
+	}{
+		{name: "system roots", wantReject: true},
+		{name: "ca file", tls: &tlsConfig{CAFile: ca}},
+		{name: "wrong server name", tls: &tlsConfig{CAFile: ca, ServerName: "upstream.internal"}, wantReject: true},
+		{name: "ca file without certificates", tls: &tlsConfig{CAFile: empty}, wantErr: true},
+		{name: "key without certificate", tls: &tlsConfig{KeyFile: ca}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tg := newTarget("/api/")
+			tg.TLS = tt.tls
+
+			tr, err := tg.transport()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("transport() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			req := httptest.NewRequest(http.MethodGet, srv.URL, nil)
+			req.RequestURI = ""
+
+			resp, err := tr.RoundTrip(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			if (err != nil) != tt.wantReject {
+				t.Errorf("RoundTrip() error = %v, want rejected %v", err, tt.wantReject)
+			}
+		})
+	}
+}
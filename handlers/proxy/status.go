@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/kenjones-cisco/dapperdox/render"
+)
+
+// StatusPath is the page showing the health of the upstream targets of proxied routes.
+const StatusPath = "/proxy-status"
+
+// balancers are those of the proxied routes registered for a build of the portal.
+type balancers struct {
+	sync.Mutex
+	list []*balancer
+}
+
+func (bs *balancers) add(b *balancer) {
+	bs.Lock()
+	defer bs.Unlock()
+
+	bs.list = append(bs.list, b)
+}
+
+// stop stops the health checks of the balancers, once the routes they were registered for are no
+// longer served.
+func (bs *balancers) stop() {
+	bs.Lock()
+	defer bs.Unlock()
+
+	for _, b := range bs.list {
+		b.stop()
+	}
+
+	bs.list = nil
+}
+
+// status returns the health of the upstream targets of every proxied route, ordered by route.
+func (bs *balancers) status() []UpstreamStatus {
+	bs.Lock()
+	defer bs.Unlock()
+
+	var list []UpstreamStatus
+	for _, b := range bs.list {
+		list = append(list, b.status()...)
+	}
+
+	return list
+}
+
+func statusHandler(rnd *render.Renderer, bs *balancers) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		rnd.HTML(w, http.StatusOK, "proxy_status",
+			rnd.DefaultVars(req, nil, render.Vars{"Title": "Proxy status", "Upstreams": bs.status()}))
+	}
+}
@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/auth"
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/ratelimit"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+// target is the upstream of a proxied route. A proxy.path entry is either the target URL,
+// or a map of these settings; settings left unset take the proxy-wide value.
+type target struct {
+	Route                 string           `mapstructure:"-"`
+	Name                  string           `mapstructure:"name"` // Of an environment
+	URL                   string           `mapstructure:"target"`
+	StripPrefix           string           `mapstructure:"strip-prefix"` // Removed from the path before forwarding
+	Targets               []string         `mapstructure:"targets"`      // Balanced with URL, when both are given
+	Balance               string           `mapstructure:"balance"`      // round-robin or least-connections
+	MaxFails              int              `mapstructure:"max-fails"`
+	FailTimeout           time.Duration    `mapstructure:"fail-timeout"`
+	HealthCheck           *healthCheck     `mapstructure:"health-check"`
+	Timeout               time.Duration    `mapstructure:"timeout"`                 // Whole exchange, zero for none
+	DialTimeout           time.Duration    `mapstructure:"dial-timeout"`            // Connecting to the upstream
+	ResponseHeaderTimeout time.Duration    `mapstructure:"response-header-timeout"` // Waiting for the upstream to respond
+	FlushInterval         time.Duration    `mapstructure:"flush-interval"`          // Negative flushes every write
+	RateLimit             *ratelimit.Limit `mapstructure:"ratelimit"`               // In place of the proxy-wide limit
+	rules                 `mapstructure:",squash"`
+
+	spec *spec.APISpecification // Set when the target is the host of a specification
+}
+
+// targets returns the configured proxy targets, ordered by route.
+func targets() ([]*target, error) {
+	var list []*target
+
+	for route, v := range viper.GetStringMap(config.ProxyPath) {
+		t := newTarget(route)
+
+		if err := t.decode(v); err != nil {
+			return nil, fmt.Errorf("proxy path %s: %w", route, err)
+		}
+
+		list = append(list, t)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Route < list[j].Route })
+
+	return list, nil
+}
+
+// decode reads the settings of the target from its configuration, the target URL or a map of
+// settings, and resolves the secrets of its rules.
+func (t *target) decode(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		t.URL = v
+	default:
+		dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+			Result:     t,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+	}
+
+	if len(t.upstreams()) == 0 {
+		return errors.New("no target given")
+	}
+
+	return t.resolve()
+}
+
+// limiter returns the rate limiter of the target, or of all proxy targets when it sets none. The
+// proxied routes are behind the gate, which verifies the clients they are told apart by.
+func (t *target) limiter() (*ratelimit.Limiter, error) {
+	if t.RateLimit != nil {
+		return ratelimit.New(*t.RateLimit).Verify(auth.PassedGate), nil
+	}
+
+	l, err := ratelimit.Configured(config.RateLimitProxy)
+
+	return l.Verify(auth.PassedGate), err
+}
+
+// label names the target on the status page.
+func (t *target) label() string {
+	if t.Name == "" {
+		return t.Route
+	}
+
+	return t.Route + " (" + t.Name + ")"
+}
+
+// specTargets returns a target for each specification of the suite, forwarding /{specID}/try/ to the
+// host the specification documents, unless a proxy path is configured for the route already.
+func specTargets(suite *spec.Suite, configured []*target) []*target {
+	routes := make(map[string]bool, len(configured))
+	for _, t := range configured {
+		routes[t.Route] = true
+	}
+
+	var list []*target
+
+	for id, s := range suite.Specs {
+		if len(s.APIs) == 0 || s.APIs[0].URL == nil {
+			continue
+		}
+
+		prefix := "/" + id + TryPath
+		if routes[prefix+"/"] {
+			continue
+		}
+
+		t := newTarget(prefix + "/")
+		t.URL = s.APIs[0].URL.String()
+		t.StripPrefix = prefix
+		t.spec = s
+
+		list = append(list, t)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Route < list[j].Route })
+
+	return list
+}
+
+func newTarget(route string) *target {
+	return &target{
+		Route:                 route,
+		Timeout:               viper.GetDuration(config.ProxyTimeout),
+		DialTimeout:           viper.GetDuration(config.ProxyDialTimeout),
+		ResponseHeaderTimeout: viper.GetDuration(config.ProxyResponseHeaderTimeout),
+		FlushInterval:         viper.GetDuration(config.ProxyFlushInterval),
+	}
+}
+
+// upstreams returns the URLs of all instances of the target.
+func (t *target) upstreams() []string {
+	if t.URL == "" {
+		return t.Targets
+	}
+
+	return append([]string{t.URL}, t.Targets...)
+}
+
+// transport returns the round tripper used to reach the target, with its upstream timeouts and
+// TLS configuration applied.
+func (t *target) transport() (http.RoundTripper, error) {
+	tlsCfg, err := t.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = (&net.Dialer{
+		Timeout:   t.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	tr.ResponseHeaderTimeout = t.ResponseHeaderTimeout
+
+	if tlsCfg != nil {
+		tr.TLSClientConfig = tlsCfg
+	}
+
+	return tr, nil
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+func TestSpecTargets(t *testing.T) {
+	host := func(raw string) spec.APISet {
+		u, _ := url.Parse(raw)
+
+		return spec.APISet{{URL: u}}
+	}
+
+	suite := &spec.Suite{Specs: map[string]*spec.APISpecification{
+		"pets":    {ID: "pets", APIs: host("https://pets.example.com/v1")},
+		"owners":  {ID: "owners", APIs: host("https://owners.example.com")},
+		"stores":  {ID: "stores", APIs: host("https://stores.example.com")},
+		"nothing": {ID: "nothing"},
+	}}
+
+	configured := []*target{{Route: "/stores" + TryPath + "/"}}
+
+	list := specTargets(suite, configured)
+
+	want := []struct{ route, url string }{
+		{"/owners/try/", "https://owners.example.com"},
+		{"/pets/try/", "https://pets.example.com/v1"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("specTargets() = %d targets, want %d", len(list), len(want))
+	}
+
+	for i, w := range want {
+		tg := list[i]
+		if tg.Route != w.route || tg.URL != w.url || tg.StripPrefix+"/" != tg.Route || tg.spec != suite.Specs[tg.spec.ID] {
+			t.Errorf("target %d = %s to %s, strip %q, want %s to %s", i, tg.Route, tg.URL, tg.StripPrefix, w.route, w.url)
+		}
+	}
+}
+
+func TestSpecTargetForwards(t *testing.T) {
+	var path string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer srv.Close()
+
+	config.Restore()
+
+	u, _ := url.Parse(srv.URL + "/v1")
+	suite := &spec.Suite{Specs: map[string]*spec.APISpecification{"pets": {ID: "pets", APIs: spec.APISet{{URL: u}}}}}
+
+	list := specTargets(suite, nil)
+	if len(list) != 1 {
+		t.Fatalf("specTargets() = %d targets, want 1", len(list))
+	}
+
+	reg := newRegistration(suite)
+	defer reg.balancers.stop()
+
+	h, err := newHandler(list[0], reg)
+	if err != nil {
+		t.Fatalf("newHandler() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pets/try/pets/1", nil))
+
+	if w.Code != http.StatusOK || path != "/v1/pets/1" {
+		t.Errorf("status = %d, upstream path %q, want %d, /v1/pets/1", w.Code, path, http.StatusOK)
+	}
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/kenjones-cisco/dapperdox/spec"
+	"github.com/kenjones-cisco/dapperdox/validator"
+)
+
+// matchMethod finds the documented method for a request proxied to the target, and the specification
+// documenting it: the specification of the target, for the routes proxied to the host of one, or
+// else any specification of the suite. The request path is tried as given and then without the
+// proxy route prefix, as the specification may document either.
+func matchMethod(suite *spec.Suite, t *target, r *http.Request) (*spec.APISpecification, *spec.Method, map[string]string) {
+	match := suite.MatchMethod
+	if t.spec != nil {
+		match = func(verb, path string) (*spec.APISpecification, *spec.Method, map[string]string) {
+			method, params := t.spec.MatchMethod(verb, path)
+
+			return t.spec, method, params
+		}
+	}
+
+	if specification, method, params := match(r.Method, r.URL.Path); method != nil {
+		return specification, method, params
+	}
+
+	if path := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(t.Route, "/")); path != r.URL.Path {
+		if specification, method, params := match(r.Method, path); method != nil {
+			return specification, method, params
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// validRequest checks the request against its documented method, reading at most maxBody of its
+// body, and answers invalid requests with a 400 listing every violation. The headers and query
+// parameters the target sets are not checked, as the client does not send them.
+func validRequest(w http.ResponseWriter, r *http.Request, t *target, method *spec.Method, params map[string]string, maxBody int64) bool {
+	violations := validator.Request(method, r, params, maxBody, t.injected())
+	if len(violations) == 0 {
+		return true
+	}
+
+	log().Infof("PROXY %s %s rejected, %d violations of operation %s", r.Method, r.URL.Path, len(violations), method.ID)
+
+	writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":      "request does not conform to the API specification",
+		"code":       http.StatusBadRequest,
+		"operation":  method.ID,
+		"violations": violations,
+	})
+
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]interface{}{"error": msg, "code": status})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+func TestMatchMethod(t *testing.T) {
+	v1 := &spec.APISpecification{ID: "v1", APIs: spec.APISet{{Methods: []*spec.Method{
+		{ID: "v1-pets", Method: "get", Path: "/pets"},
+		{ID: "v1-owners", Method: "get", Path: "/owners"},
+	}}}}
+	v2 := &spec.APISpecification{ID: "v2", APIs: spec.APISet{{Methods: []*spec.Method{{ID: "v2-pets", Method: "get", Path: "/pets"}}}}}
+	suite := &spec.Suite{Specs: map[string]*spec.APISpecification{"v1": v1, "v2": v2}}
+
+	tests := []struct {
+		name   string
+		target *target
+		path   string
+		want   string // ID of the method matched, or "" for none
+	}{
+		{name: "specification of the target", target: &target{Route: "/v2/try/", spec: v2}, path: "/v2/try/pets", want: "v2-pets"},
+		{name: "documented by another specification", target: &target{Route: "/v2/try/", spec: v2}, path: "/v2/try/owners"},
+		{name: "any specification", target: &target{Route: "/api/"}, path: "/api/owners", want: "v1-owners"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specification, method, _ := matchMethod(suite, tt.target, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			got := ""
+			if method != nil {
+				got = method.ID
+
+				if !strings.HasPrefix(got, specification.ID+"-") {
+					t.Errorf("matchMethod() = %s of specification %s", got, specification.ID)
+				}
+			}
+
+			if got != tt.want {
+				t.Errorf("matchMethod() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectedNotValidated(t *testing.T) {
+	method := &spec.Method{
+		ID:           "listPets",
+		Method:       "get",
+		Path:         "/pets",
+		HeaderParams: []spec.Parameter{{Name: "X-Tenant-Id", Type: []string{"string"}, Required: true}},
+		QueryParams:  []spec.Parameter{{Name: "key", Type: []string{"string"}, Required: true}},
+	}
+
+	tests := []struct {
+		name     string
+		rules    rules
+		wantCode int
+	}{
+		{name: "not injected", wantCode: http.StatusBadRequest},
+		{
+			name:     "injected",
+			rules:    rules{Headers: []*injection{{Name: "x-tenant-id"}}, Query: []*injection{{Name: "key"}}},
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			if validRequest(w, httptest.NewRequest(http.MethodGet, "/pets", nil), &target{rules: tt.rules}, method, nil, 1024) {
+				w.WriteHeader(http.StatusOK)
+			}
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Package ratelimit implements token bucket rate limiting of requests, per client.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// all client keys.
+const (
+	KeyIP      = "ip"
+	KeySession = "session"
+	KeyAPIKey  = "api-key"
+)
+
+const (
+	defaultSessionCookie = "dapperdox-session"
+	defaultAPIKeyHeader  = "Authorization"
+)
+
+// Limit configures a token bucket. Each client may make Burst requests at once, with the bucket
+// refilling at Requests every Per.
+type Limit struct {
+	Requests int           `mapstructure:"requests"`
+	Per      time.Duration `mapstructure:"per"`
+	Burst    int           `mapstructure:"burst"`
+	Key      string        `mapstructure:"key"`    // ip, or session or api-key once verified
+	Cookie   string        `mapstructure:"cookie"` // Session cookie, for the session key
+	Header   string        `mapstructure:"header"` // API key header, for the api-key key
+}
+
+// Verifier tells whether the session cookie or API key header of a request is a credential the
+// portal verified, before the request is authenticated. Clients are only told apart by credentials
+// they cannot make up, as each made up one would otherwise be given a bucket of its own.
+type Verifier interface {
+	VerifiedSession(r *http.Request, cookie string) bool
+	VerifiedCredential(r *http.Request, header string) bool
+}
+
+// Limiter holds a token bucket per client.
+type Limiter struct {
+	limit    Limit
+	rate     float64 // Tokens per second
+	verifier Verifier
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Configured returns the limiter for the limit at the configuration key, or nil when no limit is set.
+func Configured(key string) (*Limiter, error) {
+	if !viper.IsSet(key) {
+		return nil, nil
+	}
+
+	var l Limit
+	if err := viper.UnmarshalKey(key, &l); err != nil {
+		return nil, err
+	}
+
+	return New(l), nil
+}
+
+// New returns the limiter for the limit, or nil when the limit allows no requests to be counted.
+func New(l Limit) *Limiter {
+	if l.Requests <= 0 {
+		return nil
+	}
+
+	if l.Per <= 0 {
+		l.Per = time.Second
+	}
+
+	if l.Burst <= 0 {
+		l.Burst = l.Requests
+	}
+
+	if l.Cookie == "" {
+		l.Cookie = defaultSessionCookie
+	}
+
+	if l.Header == "" {
+		l.Header = defaultAPIKeyHeader
+	}
+
+	return &Limiter{
+		limit:   l,
+		rate:    float64(l.Requests) / l.Per.Seconds(),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Verify has the limiter tell clients apart by the sessions and API keys the verifier verified, and
+// returns the limiter. Without a verifier, clients are told apart by their IP address alone.
+func (l *Limiter) Verify(v Verifier) *Limiter {
+	if l != nil {
+		l.verifier = v
+	}
+
+	return l
+}
+
+// Handler returns a handler that passes requests to h while the client has tokens left, and to
+// denied otherwise, with a 429 status to write. RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers are set on every response, and Retry-After on those denied.
+func (l *Limiter) Handler(h, denied http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, remaining, reset, retry := l.take(l.key(r), time.Now())
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(l.limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+
+		if !ok {
+			log().Debugf("Rate limit exceeded by %s for %s", l.key(r), r.URL.Path)
+
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(retry)))
+			denied.ServeHTTP(w, r)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// take removes a token from the client's bucket, returning whether there was one, the tokens
+// remaining, the time until the bucket is full again and the time until the next token.
+func (l *Limiter) take(key string, now time.Time) (bool, int, time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	capacity := float64(l.limit.Burst)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	reset := l.duration(capacity - b.tokens)
+	retry := time.Duration(0)
+
+	if !allowed {
+		retry = l.duration(1 - b.tokens)
+	}
+
+	return allowed, int(b.tokens), reset, retry
+}
+
+// prune forgets the buckets that have refilled, at most once per refill period.
+func (l *Limiter) prune(now time.Time) {
+	full := l.duration(float64(l.limit.Burst))
+	if now.Sub(l.lastPrune) < full {
+		return
+	}
+
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, k)
+		}
+	}
+
+	l.lastPrune = now
+}
+
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// key identifies the client of the request, falling back to its IP address when the configured
+// session cookie or API key header is absent or not verified.
+func (l *Limiter) key(r *http.Request) string {
+	switch strings.ToLower(l.limit.Key) {
+	case KeySession:
+		if c, err := r.Cookie(l.limit.Cookie); err == nil && c.Value != "" && l.verifier != nil &&
+			l.verifier.VerifiedSession(r, l.limit.Cookie) {
+			return "session:" + c.Value
+		}
+	case KeyAPIKey:
+		if v := r.Header.Get(l.limit.Header); v != "" && l.verifier != nil && l.verifier.VerifiedCredential(r, l.limit.Header) {
+			return "api-key:" + v
+		}
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	l := New(Limit{Requests: 2, Per: time.Minute})
+
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTooManyRequests) }))
+
+	tests := []struct {
+		remoteAddr    string
+		wantCode      int
+		wantRemaining string
+		wantRetry     string
+	}{
+		{remoteAddr: "192.0.2.1:1234", wantCode: http.StatusOK, wantRemaining: "1"},
+		{remoteAddr: "192.0.2.1:5678", wantCode: http.StatusOK, wantRemaining: "0"},
+		{remoteAddr: "192.0.2.1:1234", wantCode: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: "30"},
+		{remoteAddr: "192.0.2.2:1234", wantCode: http.StatusOK, wantRemaining: "1"},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tt.wantCode {
+			t.Errorf("request %d from %s status = %d, want %d", i+1, tt.remoteAddr, w.Code, tt.wantCode)
+		}
+
+		if got := w.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+			t.Errorf("request %d RateLimit-Remaining = %q, want %q", i+1, got, tt.wantRemaining)
+		}
+
+		if got := w.Header().Get("Retry-After"); got != tt.wantRetry {
+			t.Errorf("request %d Retry-After = %q, want %q", i+1, got, tt.wantRetry)
+		}
+
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d RateLimit-Limit = %q, want 2", i+1, got)
+		}
+	}
+}
+
+func TestTakeRefills(t *testing.T) {
+	l := New(Limit{Requests: 2, Per: time.Minute, Burst: 1})
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, true},
+		{0, false},
+		{29 * time.Second, false},
+		{time.Second, true}, // A token is added every 30s.
+	}
+	for i, s := range steps {
+		now = now.Add(s.after)
+
+		if ok, _, _, _ := l.take("ip:192.0.2.1", now); ok != s.want {
+			t.Errorf("take %d = %v, want %v", i+1, ok, s.want)
+		}
+	}
+}
+
+// verifier verifies the session abc and the API key secret.
+type verifier struct{}
+
+func (verifier) VerifiedSession(r *http.Request, cookie string) bool {
+	c, err := r.Cookie(cookie)
+
+	return err == nil && c.Value == "abc"
+}
+
+func (verifier) VerifiedCredential(r *http.Request, header string) bool {
+	return r.Header.Get(header) == "secret"
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    Limit
+		verifier Verifier
+		cookie   string
+		header   string
+		want     string
+	}{
+		{name: "ip", limit: Limit{Key: KeyIP}, verifier: verifier{}, cookie: "abc", want: "ip:192.0.2.1"},
+		{name: "session", limit: Limit{Key: KeySession}, verifier: verifier{}, cookie: "abc", want: "session:abc"},
+		{name: "session not verified", limit: Limit{Key: KeySession}, verifier: verifier{}, cookie: "forged", want: "ip:192.0.2.1"},
+		{name: "session without verifier", limit: Limit{Key: KeySession}, cookie: "abc", want: "ip:192.0.2.1"},
+		{name: "session without cookie", limit: Limit{Key: KeySession}, verifier: verifier{}, want: "ip:192.0.2.1"},
+		{name: "api key", limit: Limit{Key: KeyAPIKey, Header: "X-API-Key"}, verifier: verifier{}, header: "secret", want: "api-key:secret"},
+		{name: "api key not verified", limit: Limit{Key: KeyAPIKey, Header: "X-API-Key"}, verifier: verifier{}, header: "forged", want: "ip:192.0.2.1"},
+		{name: "api key without header", limit: Limit{Key: KeyAPIKey}, verifier: verifier{}, want: "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.limit.Requests = 1
+			l := New(tt.limit).Verify(tt.verifier)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: defaultSessionCookie, Value: tt.cookie})
+			}
+
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+
+			if got := l.key(req); got != tt.want {
+				t.Errorf("key() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWithoutRequests(t *testing.T) {
+	if l := New(Limit{Per: time.Second}); l != nil {
+		t.Errorf("New() without requests = %v, want nil", l)
+	}
+}
@@ -21,71 +21,56 @@ package reference
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/gorilla/mux"
 
+	"github.com/kenjones-cisco/dapperdox/handlers/requestlog"
 	"github.com/kenjones-cisco/dapperdox/render"
 	"github.com/kenjones-cisco/dapperdox/spec"
 )
 
-type (
-	versionedMethod   map[string]spec.Method    // key is version
-	versionedResource map[string]*spec.Resource // key is version
-)
-
-var (
-	pathVersionMethod   map[string]versionedMethod   // Key is path
-	pathVersionResource map[string]versionedResource // Key is path
-)
+type versionedResource map[string]*spec.Resource // key is version
 
-// Register creates routes for specification resource.
-func Register(r *mux.Router) {
+// Register creates routes for specification resource, of the specifications of the suite.
+func Register(r *mux.Router, suite *spec.Suite, rnd *render.Renderer) {
 	log().Info("Registering reference documentation")
 
-	pathVersionMethod = make(map[string]versionedMethod)
-	pathVersionResource = make(map[string]versionedResource)
+	pathVersionResource := make(map[string]versionedResource) // Key is path
 
 	// Loop for all APISpecification's in the APISuite
-	for _, specification := range spec.APISuite {
+	for _, specification := range suite.Specs {
 		specID := "/" + specification.ID
 
 		log().Debugf("Registering reference for OpenAPI specification %q", specification.APIInfo.Title)
 
 		for _, api := range specification.APIs {
 			log().Debugf("  - Scanning API [%s] %s", api.ID, api.Name)
-			r.Path(specID + "/reference/" + api.ID).Methods(http.MethodGet).HandlerFunc(apiHandler(specification, api))
+			r.Path(specID + "/reference/" + api.ID).Methods(http.MethodGet).HandlerFunc(apiHandler(rnd, specification, api))
+			r.Path(specID + "/navigation/reference/" + api.ID).Methods(http.MethodGet).HandlerFunc(navigationHandler(rnd, specification, api))
 
-			version := api.CurrentVersion
+			// Register each method once, whichever versions of the API it is in.
+			registered := make(map[string]bool)
 
-			for _, method := range api.Methods {
-				path := specID + "/reference/" + api.ID + "/" + method.ID
+			register := func(methods []*spec.Method) {
+				for _, method := range methods {
+					path := specID + "/reference/" + api.ID + "/" + method.ID
+					if registered[path] {
+						continue
+					}
 
-				log().Debugf("    + method %s [%s]", path, method.Name)
+					log().Debugf("    + method %s [%s]", path, method.Name)
 
-				// Add version->method to pathVersionMethod
-				if _, ok := pathVersionMethod[path]; !ok {
-					pathVersionMethod[path] = make(versionedMethod)
+					registered[path] = true
 
-					r.Path(path).Methods(http.MethodGet).HandlerFunc(methodHandler(specification, api, path))
+					r.Path(path).Methods(http.MethodGet).HandlerFunc(methodHandler(rnd, specification, api, specification.MethodVersions(api.ID, method.ID)))
 				}
-
-				pathVersionMethod[path][version] = method
 			}
 
-			for version, methods := range api.Versions {
-				for _, method := range methods {
-					log().Debugf("    + %s %s", method.ID, method.Name)
+			register(api.Methods)
 
-					path := specID + "/reference/" + api.ID + "/" + method.ID
-					// Add version->resource to pathVersionResource
-					if _, ok := pathVersionMethod[path]; !ok {
-						pathVersionMethod[path] = make(versionedMethod)
-
-						r.Path(path).Methods(http.MethodGet).HandlerFunc(methodHandler(specification, api, path))
-					}
-
-					pathVersionMethod[path][version] = method
-				}
+			for _, methods := range api.Versions {
+				register(methods)
 			}
 		}
 
@@ -101,7 +86,7 @@ func Register(r *mux.Router) {
 				if _, ok := pathVersionResource[path]; !ok {
 					pathVersionResource[path] = make(versionedResource)
 
-					r.Path(path).Methods(http.MethodGet).HandlerFunc(globalResourceHandler(specification, path))
+					r.Path(path).Methods(http.MethodGet).HandlerFunc(globalResourceHandler(rnd, specification, pathVersionResource[path]))
 				}
 
 				pathVersionResource[path][version] = resource
@@ -110,16 +95,16 @@ func Register(r *mux.Router) {
 	}
 }
 
-func getVersionMethod(api spec.APIGroup, version string) []spec.Method {
+func getVersionMethod(api *spec.APIGroup, version string) []*spec.Method {
 	methods, ok := api.Versions[version]
 	if !ok {
 		methods = api.Methods
 	}
 
-	return methods[0:]
+	return methods
 }
 
-func getMethodVersions(api spec.APIGroup, versions versionedMethod) []string {
+func getMethodVersions(api *spec.APIGroup, versions map[string]*spec.Method) []string {
 	// See how many versions there are across the whole API. If 1, then version selection is not required.
 	if len(api.Versions) <= 1 {
 		return nil
@@ -136,7 +121,7 @@ func getMethodVersions(api spec.APIGroup, versions versionedMethod) []string {
 	return keys
 }
 
-func getAPIVersions(api spec.APIGroup) []string {
+func getAPIVersions(api *spec.APIGroup) []string {
 	if len(api.Versions) <= 1 {
 		return nil // There is only one version defined
 	}
@@ -153,7 +138,7 @@ func getAPIVersions(api spec.APIGroup) []string {
 }
 
 // apiHandler is a http.Handler for rendering API reference docs.
-func apiHandler(specification *spec.APISpecification, api spec.APIGroup) func(w http.ResponseWriter, req *http.Request) {
+func apiHandler(rnd *render.Renderer, specification *spec.APISpecification, api *spec.APIGroup) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		version := req.FormValue("v") // Get the resource version
 		if version == "" {
@@ -166,14 +151,14 @@ func apiHandler(specification *spec.APISpecification, api spec.APIGroup) func(w
 		tmpl := "api"
 		customTmpl := "reference/" + api.ID
 
-		if render.TemplateLookup(customTmpl) != nil {
+		if rnd.TemplateLookup(customTmpl) != nil {
 			tmpl = customTmpl
 		}
 
 		log().Tracef("-- template: %s  Version %s", tmpl, version)
 
-		render.HTML(w, http.StatusOK, tmpl,
-			render.DefaultVars(req, specification,
+		rnd.HTML(w, http.StatusOK, tmpl,
+			rnd.DefaultVars(req, specification,
 				render.Vars{
 					"Title":         api.Name,
 					"API":           api,
@@ -186,30 +171,35 @@ func apiHandler(specification *spec.APISpecification, api spec.APIGroup) func(w
 }
 
 // methodHandler is a http.Handler for rendering API method reference docs.
-func methodHandler(specification *spec.APISpecification, api spec.APIGroup, path string) func(w http.ResponseWriter, req *http.Request) {
+func methodHandler(rnd *render.Renderer, specification *spec.APISpecification, api *spec.APIGroup, methods map[string]*spec.Method) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		version := req.FormValue("v") // Get the resource version
 		if version == "" {
 			version = api.CurrentVersion
 		}
 
-		versions := getMethodVersions(api, pathVersionMethod[path])
-		method := pathVersionMethod[path][version]
+		versions := getMethodVersions(api, methods)
+
+		method, ok := methods[version]
+		if !ok {
+			notFound(rnd, w, req)
+
+			return
+		}
 
 		tmpl := "method"
 		customTmpl := "reference/" + api.ID + "/" + method.ID
 
-		if render.TemplateLookup(customTmpl) != nil {
+		if rnd.TemplateLookup(customTmpl) != nil {
 			tmpl = customTmpl
 		}
 
 		log().Tracef("-- template: %s  Version %s", tmpl, version)
 
-		// TODO default to latest if version not found, or 404 ?
-		method = pathVersionMethod[path][version]
+		requestlog.SetOperation(req.Context(), method.ID)
 
-		render.HTML(w, http.StatusOK, tmpl,
-			render.DefaultVars(req, specification,
+		rnd.HTML(w, http.StatusOK, tmpl,
+			rnd.DefaultVars(req, specification,
 				render.Vars{
 					"Title":         method.Name,
 					"API":           api,
@@ -221,8 +211,32 @@ func methodHandler(specification *spec.APISpecification, api spec.APIGroup, path
 	}
 }
 
+// navigationHandler is a http.Handler for rendering the navigation to the methods of an API, which
+// pages load when it is expanded rather than each listing the methods of every API.
+func navigationHandler(rnd *render.Renderer, specification *spec.APISpecification, api *spec.APIGroup) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		version := req.FormValue("v") // Get the resource version - blank is the current
+		outer := api.ID
+		query := ""
+
+		if version != "" {
+			outer = version + api.ID
+			query = "?v=" + url.QueryEscape(version)
+		}
+
+		rnd.Fragment(w, http.StatusOK, "fragments/sidenav_methods",
+			rnd.DefaultVars(req, specification,
+				render.Vars{
+					"NavAPI":     api,
+					"NavMethods": getVersionMethod(api, version),
+					"NavOuter":   outer,
+					"NavQuery":   query,
+				}))
+	}
+}
+
 // globalResourceHandler is a http.Handler for rendering API resource reference docs.
-func globalResourceHandler(specification *spec.APISpecification, path string) func(w http.ResponseWriter, req *http.Request) {
+func globalResourceHandler(rnd *render.Renderer, specification *spec.APISpecification, versionList versionedResource) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		version := req.FormValue("v") // Get the resource version - blank is the latest
 		if version == "" {
@@ -233,31 +247,40 @@ func globalResourceHandler(specification *spec.APISpecification, path string) fu
 		var versions []string
 
 		ix := 0
-		versionList := pathVersionResource[path]
 
 		if len(versionList) > 1 {
 			// There is more than one version (there is always a "latest"), so
 			// compile list of those available for resource
-			versions = make([]string, len(pathVersionResource[path]))
+			versions = make([]string, len(versionList))
 			for key := range versionList {
 				versions[ix] = key
 				ix++
 			}
 		}
 
-		resource := pathVersionResource[path][version]
+		resource, ok := versionList[version]
+		if !ok {
+			notFound(rnd, w, req)
+
+			return
+		}
 
 		log().Debugf("Render resource %s", resource.ID)
 
 		tmpl := "resource"
 		customTmpl := "resources/" + resource.ID
 
-		if render.TemplateLookup(customTmpl) != nil {
+		if rnd.TemplateLookup(customTmpl) != nil {
 			tmpl = customTmpl
 		}
 
 		log().Tracef("-- template: %s  Version %s", tmpl, version)
 
-		render.HTML(w, http.StatusOK, tmpl, render.DefaultVars(req, specification, render.Vars{"Title": resource.Title, "Resource": resource, "Version": version, "Versions": versions}))
+		rnd.HTML(w, http.StatusOK, tmpl, rnd.DefaultVars(req, specification, render.Vars{"Title": resource.Title, "Resource": resource, "Version": version, "Versions": versions}))
 	}
 }
+
+// notFound answers a request for a version the method or resource is not documented in.
+func notFound(rnd *render.Renderer, w http.ResponseWriter, req *http.Request) {
+	rnd.HTML(w, http.StatusNotFound, "error", rnd.DefaultVars(req, nil, render.Vars{"error": "Page not found", "code": http.StatusNotFound}))
+}
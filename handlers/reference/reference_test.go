@@ -0,0 +1,61 @@
+package reference
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/render"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+func TestVersions(t *testing.T) {
+	config.Restore()
+	viper.Set(config.SpecDir, "../../fixtures/")
+	viper.Set(config.SpecFilename, "common_api.json")
+	viper.Set(config.DefaultAssetsDir, "../../assets")
+	viper.Set(config.Theme, "default")
+
+	suite, err := spec.LoadSpecifications(nil)
+	if err != nil {
+		t.Fatalf("LoadSpecifications() error = %v", err)
+	}
+
+	r := mux.NewRouter()
+	Register(r, suite, render.New(suite, nil))
+
+	var method, resource string
+
+	for _, s := range suite.Specs {
+		method = "/" + s.ID + "/reference/" + s.APIs[0].ID + "/" + s.APIs[0].Methods[0].ID
+
+		for id := range s.ResourceList["latest"] {
+			resource = "/" + s.ID + "/resources/" + id
+		}
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{name: "method - current version", target: method, want: http.StatusOK},
+		{name: "method - unknown version", target: method + "?v=unknown", want: http.StatusNotFound},
+		{name: "resource - latest version", target: resource, want: http.StatusOK},
+		{name: "resource - unknown version", target: resource + "?v=unknown", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if w.Code != tt.want {
+				t.Errorf("GET %s status = %d, want %d", tt.target, w.Code, tt.want)
+			}
+		})
+	}
+}
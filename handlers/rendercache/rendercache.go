@@ -0,0 +1,296 @@
+// Package rendercache holds rendered reference and guide pages in memory, so they are only rendered
+// once. A page depends on its route, the version asked for, the environment chosen in the API
+// explorer, the signed in reader and the path prefix the portal is reached at, which key it. The
+// cache is built with the router, so it is dropped when the configuration is reloaded, and forgets
+// the least recently used pages to stay within its configured size.
+package rendercache
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/auth"
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/basepath"
+	"github.com/kenjones-cisco/dapperdox/handlers/requestlog"
+	"github.com/kenjones-cisco/dapperdox/metrics"
+	"github.com/kenjones-cisco/dapperdox/render"
+)
+
+// entryOverhead approximates the memory held by an entry besides its key and page.
+const entryOverhead = 256
+
+// Cache holds rendered pages, up to a size in bytes.
+type Cache struct {
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // Most recently used at the front
+	entries map[string]*list.Element
+}
+
+// page is a rendered page, with the annotations of the request it was rendered for.
+type page struct {
+	key         string
+	contentType string
+	body        []byte
+	spec        string
+	operation   string
+}
+
+func (p *page) size() int64 {
+	return int64(len(p.key)+len(p.body)) + entryOverhead
+}
+
+// New returns a cache of pages of up to maxSize bytes.
+func New(maxSize int64) *Cache {
+	return &Cache{maxSize: maxSize, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Configured returns the cache configured, or nil when pages are not cached.
+func Configured() *Cache {
+	if !viper.GetBool(config.RenderCacheEnabled) {
+		return nil
+	}
+
+	maxSize := int64(viper.GetSizeInBytes(config.RenderCacheMaxSize))
+	if maxSize <= 0 {
+		return nil
+	}
+
+	metrics.SetRenderCacheSize(0)
+
+	return New(maxSize)
+}
+
+// Handler serves pages from the cache, rendering and caching those not yet in it. Only successful
+// GET requests are cached.
+func (c *Cache) Handler(h http.Handler) http.Handler {
+	if c == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			h.ServeHTTP(w, req)
+
+			return
+		}
+
+		key := keyOf(req)
+
+		if p := c.get(key); p != nil {
+			metrics.ObserveRenderCache(true)
+
+			requestlog.SetSpec(req.Context(), p.spec)
+			requestlog.SetOperation(req.Context(), p.operation)
+
+			w.Header().Set("Content-Type", p.contentType)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(p.body)
+
+			return
+		}
+
+		metrics.ObserveRenderCache(false)
+
+		rec := newRecorder(w, c.maxSize)
+
+		h.ServeHTTP(rec, req)
+
+		c.store(key, req, rec)
+	})
+}
+
+// Warm renders the pages of the routes for readers who have not signed in, reaching the portal under
+// the prefix given, until the cache is full. Routes with variables in their path are skipped, having
+// no single page.
+func (c *Cache) Warm(routes []*mux.Route, prefix string) {
+	if c == nil {
+		return
+	}
+
+	s := time.Now()
+	n := 0
+
+	for _, route := range routes {
+		path, err := route.GetPathTemplate()
+		if err != nil || strings.Contains(path, "{") {
+			continue
+		}
+
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			continue
+		}
+
+		req = req.WithContext(basepath.NewContext(requestlog.NewContext(req.Context()), prefix))
+
+		key := keyOf(req)
+		if c.get(key) != nil {
+			continue
+		}
+
+		rec := newRecorder(discard{header: make(http.Header)}, c.maxSize)
+
+		route.GetHandler().ServeHTTP(rec, req)
+
+		if !c.store(key, req, rec) {
+			continue
+		}
+
+		n++
+
+		if c.full() {
+			log().Infof("Render cache filled warming %d pages", n)
+
+			break
+		}
+	}
+
+	log().Infof("Warmed render cache with %d pages in %v", n, time.Since(s))
+}
+
+// keyOf returns the key of the page a request is for.
+func keyOf(req *http.Request) string {
+	var b strings.Builder
+
+	b.WriteString(basepath.Prefix(req))
+	b.WriteString(req.URL.Path)
+	b.WriteByte(0)
+	b.WriteString(req.FormValue("v"))
+	b.WriteByte(0)
+
+	if ck, err := req.Cookie(render.EnvironmentCookie); err == nil {
+		b.WriteString(ck.Value)
+	}
+
+	b.WriteByte(0)
+
+	if u := auth.FromContext(req.Context()); u != nil {
+		b.WriteString(u.Name)
+		b.WriteByte(0)
+		b.WriteString(strings.Join(u.Groups, ","))
+	}
+
+	return b.String()
+}
+
+func (c *Cache) get(key string) *page {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+
+		return el.Value.(*page)
+	}
+
+	return nil
+}
+
+// store caches the page recorded, when it rendered successfully, reporting whether it did.
+func (c *Cache) store(key string, req *http.Request, rec *recorder) bool {
+	// Pages setting cookies are particular to the reader.
+	if rec.status != http.StatusOK || rec.overflow || len(rec.Header()["Set-Cookie"]) != rec.cookies {
+		return false
+	}
+
+	p := &page{key: key, contentType: rec.Header().Get("Content-Type"), body: rec.buf}
+	p.spec, p.operation = requestlog.Annotations(req.Context())
+
+	if p.size() > c.maxSize {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.size -= el.Value.(*page).size()
+		c.lru.Remove(el)
+	}
+
+	c.entries[key] = c.lru.PushFront(p)
+	c.size += p.size()
+
+	for c.size > c.maxSize {
+		el := c.lru.Back()
+		old := el.Value.(*page)
+
+		c.lru.Remove(el)
+		delete(c.entries, old.key)
+		c.size -= old.size()
+	}
+
+	metrics.SetRenderCacheSize(c.size)
+
+	return true
+}
+
+func (c *Cache) full() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size >= c.maxSize
+}
+
+// recorder keeps a copy of the page written, up to a limit.
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	buf      []byte
+	limit    int64
+	overflow bool
+	cookies  int // Cookies set before the page was rendered
+}
+
+func newRecorder(w http.ResponseWriter, limit int64) *recorder {
+	return &recorder{ResponseWriter: w, limit: limit, cookies: len(w.Header()["Set-Cookie"])}
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	if !r.overflow {
+		if int64(len(r.buf)+len(b)) > r.limit {
+			r.overflow = true
+			r.buf = nil
+		} else {
+			r.buf = append(r.buf, b...)
+		}
+	}
+
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the original writer, for http.ResponseController.
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// discard is the writer of the pages rendered to warm the cache.
+type discard struct {
+	header http.Header
+}
+
+func (d discard) Header() http.Header       { return d.header }
+func (discard) WriteHeader(int)             {}
+func (discard) Write(b []byte) (int, error) { return len(b), nil }
@@ -0,0 +1,151 @@
+package rendercache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/auth"
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/basepath"
+	"github.com/kenjones-cisco/dapperdox/render"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+func TestKeys(t *testing.T) {
+	config.Restore()
+	viper.Set(config.AuthProvider, auth.ProviderHeader)
+	viper.Set(config.AuthHeaderTrusted, []string{"192.0.2.0/24"})
+	viper.Set(config.AuthRequired, false)
+
+	g, err := auth.Register(mux.NewRouter(), &spec.Suite{})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	renders := 0
+
+	h := auth.Handler(g, http.NotFoundHandler())(New(1 << 20).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renders++
+
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(strconv.Itoa(renders)))
+	})))
+
+	tests := []struct {
+		name   string
+		target string
+		env    string
+		prefix string
+		user   string
+		groups string
+		want   string // Page served, numbered by the render it is from
+	}{
+		{name: "rendered", target: "/page", want: "1"},
+		{name: "cached", target: "/page", want: "1"},
+		{name: "other version", target: "/page?v=2", want: "2"},
+		{name: "other environment", target: "/page", env: "prod", want: "3"},
+		{name: "environment cached", target: "/page", env: "prod", want: "3"},
+		{name: "other prefix", target: "/page", prefix: "/portal", want: "4"},
+		{name: "signed in", target: "/page", user: "alice", want: "5"},
+		{name: "other reader", target: "/page", user: "bob", want: "6"},
+		{name: "signed in cached", target: "/page", user: "alice", want: "5"},
+		{name: "other groups", target: "/page", user: "alice", groups: "admins", want: "7"},
+		{name: "not signed in cached", target: "/page", want: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req = req.WithContext(basepath.NewContext(req.Context(), tt.prefix))
+
+			if tt.env != "" {
+				req.AddCookie(&http.Cookie{Name: render.EnvironmentCookie, Value: tt.env})
+			}
+
+			if tt.user != "" {
+				req.Header.Set("X-Forwarded-User", tt.user)
+				req.Header.Set("X-Forwarded-Groups", tt.groups)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("page from render %s, want from render %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	renders := 0
+
+	h := New(3 * entryOverhead).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renders++
+
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/cookie":
+			http.SetCookie(w, &http.Cookie{Name: "reader", Value: "alice"})
+		}
+
+		_, _ = w.Write([]byte("page"))
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		wantRenders int
+	}{
+		{name: "not found", target: "/missing", wantRenders: 2},
+		{name: "setting a cookie", target: "/cookie", wantRenders: 2},
+		{name: "not a GET", method: http.MethodPost, target: "/page", wantRenders: 2},
+		{name: "page", target: "/page", wantRenders: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			renders = 0
+
+			for i := 0; i < 2; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, tt.target, nil))
+			}
+
+			if renders != tt.wantRenders {
+				t.Errorf("%s %s rendered %d times, want %d", method, tt.target, renders, tt.wantRenders)
+			}
+		})
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := New(2 * (entryOverhead + 16))
+
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("page"))
+	}))
+
+	for _, target := range []string{"/a", "/b", "/a", "/c"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	for target, want := range map[string]bool{"/a": true, "/b": false, "/c": true} {
+		if got := c.get(keyOf(httptest.NewRequest(http.MethodGet, target, nil))) != nil; got != want {
+			t.Errorf("%s cached %v, want %v, the least recently used being forgotten", target, got, want)
+		}
+	}
+
+	if c.size > c.maxSize {
+		t.Errorf("size = %d, over the maximum %d", c.size, c.maxSize)
+	}
+}
@@ -0,0 +1,208 @@
+// Package requestlog identifies each request by an ID, and logs a single access line for it once
+// it has been served. Handlers annotate the line with the specification, operation and proxy
+// target the request was served for.
+package requestlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kenjones-cisco/dapperdox/handlers/capture"
+	"github.com/kenjones-cisco/dapperdox/logger"
+)
+
+// Header carries the request ID, from the client or a proxy in front, and to proxied upstreams.
+const Header = "X-Request-ID"
+
+// maxIDLength limits the length of request IDs taken from clients.
+const maxIDLength = 128
+
+// entry holds the annotations of the access line of a request.
+type entry struct {
+	id string
+
+	mu        sync.Mutex
+	spec      string
+	operation string
+	target    string
+	user      string
+}
+
+type entryKey struct{}
+
+// Handler honours the request ID sent by the client, or generates one, setting it on the response,
+// and logs the access line once the request has been served.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &entry{id: r.Header.Get(Header)}
+		if !validID(e.id) {
+			e.id = newID()
+			r.Header.Set(Header, e.id)
+		}
+
+		w.Header().Set(Header, e.id)
+
+		r = r.WithContext(context.WithValue(r.Context(), entryKey{}, e))
+		lw := capture.Wrap(w)
+		s := time.Now()
+
+		h.ServeHTTP(lw, r)
+
+		e.log(r, lw, time.Since(s))
+	})
+}
+
+// NewContext returns a context carrying annotations for a request served internally, rather than
+// through Handler, so they can be read back with Annotations.
+func NewContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, entryKey{}, &entry{})
+}
+
+// Annotations returns the specification and operation the access line of the request is annotated
+// with.
+func Annotations(ctx context.Context) (spec, operation string) {
+	if e := fromContext(ctx); e != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		return e.spec, e.operation
+	}
+
+	return "", ""
+}
+
+// ID returns the ID of the request, or "" when it has none.
+func ID(ctx context.Context) string {
+	if e := fromContext(ctx); e != nil {
+		return e.id
+	}
+
+	return ""
+}
+
+// Logger returns a logger carrying the ID of the request.
+func Logger(ctx context.Context) logrus.Ext1FieldLogger {
+	return logger.Logger().WithField("request_id", ID(ctx))
+}
+
+// SetSpec annotates the access line with the ID of the specification served.
+func SetSpec(ctx context.Context, id string) {
+	if e := fromContext(ctx); e != nil {
+		e.mu.Lock()
+		e.spec = id
+		e.mu.Unlock()
+	}
+}
+
+// SetOperation annotates the access line with the ID of the operation served.
+func SetOperation(ctx context.Context, id string) {
+	if e := fromContext(ctx); e != nil {
+		e.mu.Lock()
+		e.operation = id
+		e.mu.Unlock()
+	}
+}
+
+// SetProxyTarget annotates the access line with the proxy target the request was forwarded to.
+func SetProxyTarget(ctx context.Context, target string) {
+	if e := fromContext(ctx); e != nil {
+		e.mu.Lock()
+		e.target = target
+		e.mu.Unlock()
+	}
+}
+
+// SetUser annotates the access line with the name of the signed in reader.
+func SetUser(ctx context.Context, name string) {
+	if e := fromContext(ctx); e != nil {
+		e.mu.Lock()
+		e.user = name
+		e.mu.Unlock()
+	}
+}
+
+func fromContext(ctx context.Context) *entry {
+	if ctx == nil {
+		return nil
+	}
+
+	e, _ := ctx.Value(entryKey{}).(*entry)
+
+	return e
+}
+
+func (e *entry) log(r *http.Request, w *capture.Writer, d time.Duration) {
+	route := ""
+	if cr := mux.CurrentRoute(r); cr != nil {
+		route, _ = cr.GetPathTemplate()
+	}
+
+	e.mu.Lock()
+	fields := logrus.Fields{
+		"pkg":         "access",
+		"request_id":  e.id,
+		"remote":      r.RemoteAddr,
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"route":       route,
+		"spec":        e.spec,
+		"operation":   e.operation,
+		"proxy":       e.target,
+		"user":        e.user,
+		"status":      w.Status(),
+		"bytes":       w.Bytes(),
+		"duration_ms": float64(d.Microseconds()) / 1000,
+		"referer":     withoutQuery(r.Referer()),
+		"user_agent":  r.UserAgent(),
+	}
+	e.mu.Unlock()
+
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID().String()
+	}
+
+	logger.Logger().WithFields(fields).Infof("%s %s %d", r.Method, r.URL.Path, w.Status())
+}
+
+// withoutQuery returns a URL without its query, which is not logged, as it may hold credentials such
+// as the token readers sign in with.
+func withoutQuery(u string) string {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		return u[:i]
+	}
+
+	return u
+}
+
+// validID reports whether a request ID sent by a client can be trusted in logs and headers.
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,163 @@
+package requestlog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kenjones-cisco/dapperdox/logger"
+)
+
+// accessLog records the access lines logged.
+func accessLog(t *testing.T) *test.Hook {
+	t.Helper()
+
+	hook := test.NewLocal(logger.Logger().(*logrus.Entry).Logger)
+	t.Cleanup(hook.Reset)
+
+	return hook
+}
+
+func TestQueryNotLogged(t *testing.T) {
+	hook := accessLog(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/guides?token=secret", nil)
+	req.Header.Set("Referer", "https://docs.example.com/?token=secret")
+
+	Handler(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+
+	e := hook.LastEntry()
+	if e == nil {
+		t.Fatal("no access line logged")
+	}
+
+	if e.Data["path"] != "/guides" || e.Data["referer"] != "https://docs.example.com/" {
+		t.Errorf("logged path %v, referer %v, want them without their query", e.Data["path"], e.Data["referer"])
+	}
+
+	for k, v := range e.Data {
+		if s, ok := v.(string); ok && strings.Contains(s, "secret") {
+			t.Errorf("logged %s = %q, holding the token", k, s)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		sent string
+		kept bool
+	}{
+		{name: "none sent"},
+		{name: "sent", sent: "edge-1234", kept: true},
+		{name: "with spaces", sent: "edge 1234"},
+		{name: "too long", sent: strings.Repeat("a", maxIDLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := accessLog(t)
+
+			var inner string
+
+			h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inner = ID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.sent != "" {
+				req.Header.Set(Header, tt.sent)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			id := w.Header().Get(Header)
+			if tt.kept && id != tt.sent {
+				t.Errorf("%s = %q, want %q", Header, id, tt.sent)
+			}
+
+			if !tt.kept && (id == tt.sent || len(id) != 32) {
+				t.Errorf("%s = %q, want a generated ID", Header, id)
+			}
+
+			if inner != id {
+				t.Errorf("ID() = %q, want %q", inner, id)
+			}
+
+			if e := hook.LastEntry(); e == nil || e.Data["request_id"] != id {
+				t.Errorf("access line not logged with request ID %q", id)
+			}
+		})
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	hook := accessLog(t)
+
+	rtr := mux.NewRouter()
+	rtr.Use(Handler)
+	rtr.HandleFunc("/{specID}/reference/{operation}", func(w http.ResponseWriter, r *http.Request) {
+		SetSpec(r.Context(), "pets")
+		SetOperation(r.Context(), "listPets")
+		SetProxyTarget(r.Context(), "/pets/try/")
+		SetUser(r.Context(), "alice")
+
+		if spec, operation := Annotations(r.Context()); spec != "pets" || operation != "listPets" {
+			t.Errorf("Annotations() = %s, %s, want pets, listPets", spec, operation)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("page"))
+	})
+
+	tid, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	sid, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid}))
+
+	rtr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/pets/reference/listPets", nil).WithContext(ctx))
+
+	e := hook.LastEntry()
+	if e == nil {
+		t.Fatal("no access line logged")
+	}
+
+	want := logrus.Fields{
+		"route":     "/{specID}/reference/{operation}",
+		"spec":      "pets",
+		"operation": "listPets",
+		"proxy":     "/pets/try/",
+		"user":      "alice",
+		"status":    http.StatusAccepted,
+		"bytes":     4,
+		"trace_id":  tid.String(),
+	}
+	for k, v := range want {
+		if e.Data[k] != v {
+			t.Errorf("logged %s = %v, want %v", k, e.Data[k], v)
+		}
+	}
+}
+
+func TestAnnotationsWithoutHandler(t *testing.T) {
+	ctx := NewContext(context.Background())
+	SetSpec(ctx, "pets")
+	SetOperation(ctx, "listPets")
+
+	if spec, operation := Annotations(ctx); spec != "pets" || operation != "listPets" {
+		t.Errorf("Annotations() = %s, %s, want pets, listPets", spec, operation)
+	}
+
+	// Requests served without an entry are not annotated, nor fail.
+	SetSpec(context.Background(), "pets")
+
+	if spec, _ := Annotations(context.Background()); spec != "" || ID(context.Background()) != "" {
+		t.Errorf("Annotations() = %s without an entry, want none", spec)
+	}
+}
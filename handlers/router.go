@@ -3,7 +3,6 @@ package handlers
 import (
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gorilla/handlers"
@@ -11,69 +10,340 @@ import (
 	"github.com/justinas/nosurf"
 	"github.com/spf13/viper"
 
+	"github.com/kenjones-cisco/dapperdox/auth"
+	"github.com/kenjones-cisco/dapperdox/compression"
 	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/gitsource"
+	"github.com/kenjones-cisco/dapperdox/handlers/basepath"
+	"github.com/kenjones-cisco/dapperdox/handlers/cache"
 	"github.com/kenjones-cisco/dapperdox/handlers/guides"
 	"github.com/kenjones-cisco/dapperdox/handlers/home"
+	"github.com/kenjones-cisco/dapperdox/handlers/mock"
 	"github.com/kenjones-cisco/dapperdox/handlers/proxy"
+	"github.com/kenjones-cisco/dapperdox/handlers/ratelimit"
 	"github.com/kenjones-cisco/dapperdox/handlers/reference"
+	"github.com/kenjones-cisco/dapperdox/handlers/rendercache"
+	"github.com/kenjones-cisco/dapperdox/handlers/requestlog"
 	"github.com/kenjones-cisco/dapperdox/handlers/specs"
 	"github.com/kenjones-cisco/dapperdox/handlers/static"
 	"github.com/kenjones-cisco/dapperdox/handlers/timeout"
 	log "github.com/kenjones-cisco/dapperdox/logger"
+	"github.com/kenjones-cisco/dapperdox/metrics"
 	"github.com/kenjones-cisco/dapperdox/render"
 	"github.com/kenjones-cisco/dapperdox/spec"
+	"github.com/kenjones-cisco/dapperdox/tracing"
 	"github.com/kenjones-cisco/dapperdox/version"
 )
 
-// NewRouterChain creates a router with a chain of middlewares that acts as an http.Handler.
-func NewRouterChain() http.Handler {
+// NewRouterChain creates a router with a chain of middlewares that acts as an http.Handler. Everything
+// the router serves is built afresh for it, so a router built when the configuration is reloaded
+// replaces the one being served whole. The handler returned is an io.Closer, to be closed once it
+// is no longer served.
+func NewRouterChain() (http.Handler, error) {
+	src, err := gitsource.Load()
+	if err != nil {
+		return nil, fmt.Errorf("git repository error: %w", err)
+	}
+
+	suite, err := spec.LoadSpecifications(src)
+	if err != nil {
+		return nil, fmt.Errorf("load specification error: %w", err)
+	}
+
+	rnd := render.New(suite, src)
 	router := mux.NewRouter()
+
+	gate, err := auth.Register(router, suite)
+	if err != nil {
+		return nil, fmt.Errorf("authentication error: %w", err)
+	}
+
+	groups := make(routeGroups)
+	pages := rendercache.Configured()
+	withAuth := auth.Handler(gate, http.HandlerFunc(denied(rnd)))
+
 	router.Use(
+		tracing.Middleware,
+		metrics.Middleware,
+		requestlog.Handler,
 		handlers.RecoveryHandler(handlers.RecoveryLogger(log.Logger()), handlers.PrintRecoveryStack(true)),
-		withLogger,
-		timeoutHandler,
-		withCsrf,
+		groups.rateLimitHandler(rnd),
+		withAuth,
+		withUser,
+		groups.compressHandler(compression.Middleware()),
+		groups.timeoutHandler(rnd),
+		groups.validateHandler(time.Now()),
+		withCsrf(rnd),
 		injectHeaders,
 		handlers.CORS(handlers.AllowedOrigins(viper.GetStringSlice(config.AllowOrigin))),
+		groups.cacheHandler(pages),
 	)
 
-	specs.Register(router)
+	specsGroup := newRouteGroup(config.TimeoutSpecs, config.RateLimitSpecs, gate)
+	pagesGroup := newRouteGroup(config.TimeoutPages, config.RateLimitPages, gate)
+	pagesGroup.validate = true
+
+	// The sign in and out routes are answered as pages.
+	groups.add(router, pagesGroup)
+
+	specs.Register(router, src)
+	groups.add(router, specsGroup)
+
+	metrics.SetSpecifications(len(suite.Specs), countOperations(suite))
+
+	// Reference and guide pages only change with the specifications and assets, so are cached once rendered.
+	referenceGroup := *pagesGroup
+	referenceGroup.cached = true
+
+	reference.Register(router, suite, rnd)
+	guides.Register(router, suite, rnd)
+	groups.add(router, &referenceGroup)
+
+	static.Register(router, rnd)
+	home.Register(router, suite, rnd)
+	groups.add(router, pagesGroup)
+
+	// Proxied routes apply the timeouts and rate limits of their own targets, as responses may be streamed,
+	// and are only compressed when configured to be.
+	stopProxies := proxy.Register(router, suite, rnd)
+	groups.add(router, &routeGroup{compress: viper.GetBool(config.CompressionProxy)})
+
+	// The mock API shares the limits of the pages, but its responses are not validated as pages are.
+	mockGroup := *pagesGroup
+	mockGroup.validate = false
+
+	mock.Register(router, suite)
+	groups.add(router, &mockGroup)
+
+	// Requests matching no route are answered as pages.
+	groups[nil] = pagesGroup
+
+	if pages != nil && viper.GetBool(config.RenderCacheWarm) {
+		if gate != nil {
+			log.Logger().Info("Not warming the render cache, as pages are rendered for signed in readers")
+		} else {
+			go pages.Warm(groups.routes(&referenceGroup), basepath.Configured())
+		}
+	}
+
+	// Routes are registered at the root, and served under the base path.
+	return &chain{Handler: basepath.Handler(router), stop: stopProxies}, nil
+}
+
+// chain is the handler of a router built, which stops what runs in the background for the router
+// when it is closed.
+type chain struct {
+	http.Handler
+	stop func()
+}
+
+// Close stops the health checks of the upstream targets of the proxied routes.
+func (c *chain) Close() error {
+	c.stop()
+
+	return nil
+}
+
+func countOperations(suite *spec.Suite) int {
+	n := 0
+
+	for _, s := range suite.Specs {
+		for _, api := range s.APIs {
+			n += len(api.Methods)
+		}
+	}
+
+	return n
+}
+
+// denied answers readers who may not see a page as though it did not exist.
+func denied(rnd *render.Renderer) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		rnd.HTML(w, http.StatusNotFound, "error",
+			rnd.DefaultVars(req, nil, render.Vars{"error": "Page not found", "code": http.StatusNotFound}))
+	}
+}
+
+// withUser names the signed in reader in the access log.
+func withUser(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if u := auth.FromContext(req.Context()); u != nil {
+			requestlog.SetUser(req.Context(), u.Name)
+		}
+
+		h.ServeHTTP(w, req)
+	})
+}
+
+func withCsrf(rnd *render.Renderer) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		csrfHandler := nosurf.New(h)
+		// The mock API and automatic proxies are called by the explorer, not submitted from a form. Those
+		// proxies forward the identity of the reader only with the header the explorer sets instead.
+		csrfHandler.ExemptRegexp("^" + mock.PathPrefix + "/")
+		csrfHandler.ExemptRegexp("^/[^/]+" + proxy.TryPath + "/")
+		csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rsn := nosurf.Reason(req).Error()
+			log.Logger().Warnf("failed csrf validation: %s", rsn)
+			rnd.HTML(w, http.StatusBadRequest, "error", rnd.DefaultVars(req, nil, render.Vars{"error": rsn}))
+		}))
+
+		return csrfHandler
+	}
+}
+
+// routeGroup holds the time limit and rate limiter shared by a group of routes. A zero time
+// limit or nil limiter leaves the routes without one. Responses of routes in a validating group
+// are given an ETag, so unchanged pages are answered with 304 Not Modified, those of routes in
+// a compressing group are compressed when the client accepts it, and the pages of routes in a
+// cached group are held in the render cache.
+type routeGroup struct {
+	timeout  time.Duration
+	limiter  *ratelimit.Limiter
+	validate bool
+	compress bool
+	cached   bool
+}
+
+// newRouteGroup returns a group with the time limit and rate limit at the configuration keys. The
+// rate limit applies ahead of the gate, so clients are told apart only by the sessions and API keys
+// the gate verified earlier.
+func newRouteGroup(timeoutKey, rateLimitKey string, gate *auth.Gate) *routeGroup {
+	limiter, err := ratelimit.Configured(rateLimitKey)
+	if err != nil {
+		log.Logger().Errorf("Error reading rate limit %s: %s", rateLimitKey, err)
+	}
+
+	return &routeGroup{timeout: viper.GetDuration(timeoutKey), limiter: limiter.Verify(gate), compress: true}
+}
+
+// routeGroups holds the group of each route, being the group the route was registered in.
+type routeGroups map[*mux.Route]*routeGroup
+
+// add puts the routes registered since the last group into the group.
+func (rg routeGroups) add(r *mux.Router, g *routeGroup) {
+	_ = r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if _, ok := rg[route]; !ok {
+			rg[route] = g
+		}
+
+		return nil
+	})
+}
+
+// routes returns the routes in the group.
+func (rg routeGroups) routes(g *routeGroup) []*mux.Route {
+	var routes []*mux.Route
+
+	for route, group := range rg {
+		if route != nil && group == g {
+			routes = append(routes, route)
+		}
+	}
+
+	return routes
+}
+
+func (rg routeGroups) group(req *http.Request) *routeGroup {
+	if g, ok := rg[mux.CurrentRoute(req)]; ok {
+		return g
+	}
 
-	if err := spec.LoadSpecifications(); err != nil {
-		log.Logger().Fatalf("Load specification error: %s", err)
+	return rg[nil]
+}
+
+func (rg routeGroups) timeoutHandler(rnd *render.Renderer) func(http.Handler) http.Handler {
+	onTimeout := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		log.Logger().Warnf("request timed out: %s", req.URL.Path)
+		rnd.HTML(w, http.StatusRequestTimeout, "error", rnd.DefaultVars(req, nil, render.Vars{"error": "Request timed out"}))
+	})
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			g := rg.group(req)
+			if g == nil || g.timeout <= 0 {
+				h.ServeHTTP(w, req)
+
+				return
+			}
+
+			timeout.Handler(h, g.timeout, onTimeout).ServeHTTP(w, req)
+		})
 	}
+}
+
+// cacheHandler serves the pages of the routes of cached groups from the render cache.
+func (rg routeGroups) cacheHandler(pages *rendercache.Cache) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		cached := pages.Handler(h)
 
-	render.Register()
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if g := rg.group(req); g != nil && g.cached {
+				cached.ServeHTTP(w, req)
 
-	reference.Register(router)
-	guides.Register(router)
-	static.Register(router)
-	home.Register(router)
-	proxy.Register(router)
+				return
+			}
 
-	return router
+			h.ServeHTTP(w, req)
+		})
+	}
 }
 
-func withLogger(h http.Handler) http.Handler {
-	return handlers.CombinedLoggingHandler(os.Stdout, h)
+// compressHandler compresses the responses of the routes of compressing groups.
+func (rg routeGroups) compressHandler(compress func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		compressed := compress(h)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if g := rg.group(req); g != nil && g.compress {
+				compressed.ServeHTTP(w, req)
+
+				return
+			}
+
+			h.ServeHTTP(w, req)
+		})
+	}
 }
 
-func withCsrf(h http.Handler) http.Handler {
-	csrfHandler := nosurf.New(h)
-	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		rsn := nosurf.Reason(req).Error()
-		log.Logger().Warnf("failed csrf validation: %s", rsn)
-		render.HTML(w, http.StatusBadRequest, "error", map[string]interface{}{"error": rsn})
-	}))
+// validateHandler validates the responses of the routes of validating groups, as last modified
+// when the router was built.
+func (rg routeGroups) validateHandler(built time.Time) func(http.Handler) http.Handler {
+	validate := cache.Validate(built)
+
+	return func(h http.Handler) http.Handler {
+		validated := validate(h)
 
-	return csrfHandler
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if g := rg.group(req); g != nil && g.validate {
+				validated.ServeHTTP(w, req)
+
+				return
+			}
+
+			h.ServeHTTP(w, req)
+		})
+	}
 }
 
-func timeoutHandler(h http.Handler) http.Handler {
-	return timeout.Handler(h, 1*time.Second, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		log.Logger().Warn("request timed out")
-		render.HTML(w, http.StatusRequestTimeout, "error", map[string]interface{}{"error": "Request timed out"})
-	}))
+func (rg routeGroups) rateLimitHandler(rnd *render.Renderer) func(http.Handler) http.Handler {
+	onLimit := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rnd.HTML(w, http.StatusTooManyRequests, "error",
+			rnd.DefaultVars(req, nil, render.Vars{"error": "Too many requests", "code": http.StatusTooManyRequests}))
+	})
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			g := rg.group(req)
+			if g == nil || g.limiter == nil {
+				h.ServeHTTP(w, req)
+
+				return
+			}
+
+			g.limiter.Handler(h, onLimit).ServeHTTP(w, req)
+		})
+	}
 }
 
 // Handle additional headers such as strict transport security for TLS, and
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+// TestRebuildWhileServing builds routers while another is serving, as on reload, which is to leave
+// the router served untouched. Run with -race.
+func TestRebuildWhileServing(t *testing.T) {
+	config.Restore()
+	viper.Set(config.SpecDir, "../fixtures/")
+	viper.Set(config.SpecFilename, "common_api.json")
+	viper.Set(config.DefaultAssetsDir, "../assets")
+	viper.Set(config.Theme, "default")
+
+	served, err := NewRouterChain()
+	if err != nil {
+		t.Fatalf("NewRouterChain() error = %v", err)
+	}
+	defer served.(io.Closer).Close()
+
+	var wg sync.WaitGroup
+
+	for _, target := range []string{"/", "/reference/", "/swagger/common_api.json", "/static/css/style.css"} {
+		wg.Add(1)
+
+		go func(target string) {
+			defer wg.Done()
+
+			for i := 0; i < 5; i++ {
+				w := httptest.NewRecorder()
+				served.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+				if w.Code >= http.StatusInternalServerError {
+					t.Errorf("GET %s status = %d while rebuilding", target, w.Code)
+				}
+			}
+		}(target)
+	}
+
+	for i := 0; i < 2; i++ {
+		h, err := NewRouterChain()
+		if err != nil {
+			t.Fatalf("NewRouterChain() error = %v", err)
+		}
+
+		h.(io.Closer).Close()
+	}
+
+	wg.Wait()
+}
+
+func TestRateLimitedPages(t *testing.T) {
+	config.Restore()
+	viper.Set(config.SpecDir, "../fixtures/")
+	viper.Set(config.SpecFilename, "common_api.json")
+	viper.Set(config.DefaultAssetsDir, "../assets")
+	viper.Set(config.Theme, "default")
+	viper.Set(config.RateLimitPages, map[string]interface{}{"requests": 1, "per": "1m"})
+
+	h, err := NewRouterChain()
+	if err != nil {
+		t.Fatalf("NewRouterChain() error = %v", err)
+	}
+	defer h.(io.Closer).Close()
+
+	for i, limited := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if (w.Code == http.StatusTooManyRequests) != limited {
+			t.Errorf("request %d status = %d, want rate limited %v", i+1, w.Code, limited)
+		}
+
+		if limited && w.Header().Get("Retry-After") == "" {
+			t.Error("rate limited response without Retry-After")
+		}
+	}
+
+	// The specifications are limited apart from the pages.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger/common_api.json", nil))
+
+	if w.Code == http.StatusTooManyRequests {
+		t.Errorf("GET /swagger/common_api.json status = %d, limited with the pages", w.Code)
+	}
+}
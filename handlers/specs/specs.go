@@ -20,25 +20,46 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package specs
 
 import (
-	"io/ioutil"
+	"io/fs"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
 
+	"github.com/kenjones-cisco/dapperdox/compression"
 	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/gitsource"
+	"github.com/kenjones-cisco/dapperdox/handlers/basepath"
+	"github.com/kenjones-cisco/dapperdox/handlers/cache"
 )
 
-var (
-	specMap      map[string][]byte
-	specReplacer *strings.Replacer
-)
+// contentType is the media type specifications are served as.
+const contentType = "application/json"
+
+// specFile holds a specification served, with when it was last modified.
+type specFile struct {
+	content  []byte
+	variants compression.Variants
+	modTime  time.Time
+	raw      []byte // As written, when the site URL is substituted in it
+}
+
+// rewrite holds how the URLs of the specifications are rewritten, as configured when they were
+// registered.
+type rewrite struct {
+	urls      map[string]string // Rewritten to the URL given, or the site URL when ""
+	site      string
+	forwarded bool              // Whether requests forwarded by a reverse proxy have their own site URL
+	replacer  *strings.Replacer // Rewrites to the site URL configured
+	toSite    bool              // Whether any URL is rewritten to the site URL
+}
 
-// Register creates routes for each static resource.
-func Register(r *mux.Router) {
+// Register creates routes for each specification of the spec-dir of the source, or the tag
+// published in its place, and of its git refs.
+func Register(r *mux.Router, src *gitsource.Source) {
 	log().Info("Registering specifications")
 
 	if viper.GetString(config.SpecDir) == "" {
@@ -47,61 +68,66 @@ func Register(r *mux.Router) {
 		return
 	}
 
-	// Build a replacer to search/replace specification URLs
-	if specReplacer == nil {
-		var replacements []string
-
-		// Configure the replacer with key=value pairs
-		for k, v := range viper.GetStringMapString(config.SpecRewriteURL) {
-			if v != "" {
-				// Map between configured to=from URL pair
-				replacements = append(replacements, k, v)
-			} else {
-				// Map between configured URL and site URL
-				replacements = append(replacements, k, viper.GetString(config.SiteURL))
-			}
-		}
-
-		specReplacer = strings.NewReplacer(replacements...)
+	rw := &rewrite{
+		urls:      viper.GetStringMapString(config.SpecRewriteURL),
+		site:      viper.GetString(config.SiteURL),
+		forwarded: viper.GetBool(config.ForwardedHeaders),
 	}
+	rw.replacer, rw.toSite = rw.to(rw.site)
 
-	base, err := filepath.Abs(filepath.Clean(viper.GetString(config.SpecDir)))
+	dir := viper.GetString(config.SpecDir)
+
+	fsys, err := src.Open(dir)
 	if err != nil {
-		log().Errorf("Error forming specification path: %s", err)
+		log().Errorf("Error opening specifications %s: %s", dir, err)
+
+		return
 	}
 
-	log().Debugf("- Scanning base directory %s", base)
+	log().Debugf("- Scanning specifications %s", dir)
+
+	registerSource(r, fsys, "", rw)
 
-	base = filepath.ToSlash(base)
+	// The specifications of sections published from git refs are served from beneath their name.
+	for _, ref := range src.Refs() {
+		if ref.Section != "" {
+			log().Debugf("- Scanning specifications of git ref %s", ref.Name)
 
-	specMap = make(map[string][]byte)
+			registerSource(r, ref.Specs(), "/"+ref.Section, rw)
+		}
+	}
+}
 
-	_ = filepath.Walk(base, func(path string, _ os.FileInfo, _ error) error {
-		if path == base {
+// registerSource creates routes for each specification of a source, beneath the prefix given.
+func registerSource(r *mux.Router, fsys fs.FS, prefix string, rw *rewrite) {
+	_ = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
 			// Nothing to do with this path
 			return nil
 		}
 
 		log().Debugf("  - %s", path)
 
-		path = filepath.ToSlash(path)
-		ext := filepath.Ext(path)
-
-		switch ext {
+		switch filepath.Ext(path) {
 		case ".json", ".yml", ".yaml":
-			// Strip base path and file extension
-			route := strings.TrimPrefix(path, base)
+			route := prefix + "/" + path
 
 			log().Debugf("    = URL : %s", route)
-			log().Tracef("    + File: %s", path)
 
-			specMap[route], _ = ioutil.ReadFile(path)
+			b, _ := fs.ReadFile(fsys, path)
 
 			// Replace URLs in document
-			specMap[route] = []byte(specReplacer.Replace(string(specMap[route])))
+			f := &specFile{content: []byte(rw.replacer.Replace(string(b))), modTime: time.Now()}
+			f.variants = compression.Precompress(contentType, f.content)
+			if rw.toSite && rw.forwarded {
+				f.raw = b
+			}
+			if info, err := d.Info(); err == nil && !info.ModTime().IsZero() {
+				f.modTime = info.ModTime()
+			}
 
-			r.Path(route).Methods(http.MethodGet).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-				serveSpec(w, route)
+			r.Path(route).Methods(http.MethodGet, http.MethodHead).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				serveSpec(w, req, route, f, rw)
 			})
 		}
 
@@ -109,10 +135,44 @@ func Register(r *mux.Router) {
 	})
 }
 
-func serveSpec(w http.ResponseWriter, resource string) {
+func serveSpec(w http.ResponseWriter, req *http.Request, resource string, f *specFile, rw *rewrite) {
 	log().Debugf("Serve file %s", resource)
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-control", "public, max-age=259200")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(specMap[resource])
+
+	w.Header().Set("Content-Type", contentType)
+
+	if f.raw != nil {
+		w.Header().Add("Vary", basepath.ForwardedHost+", "+basepath.ForwardedProto)
+
+		if site := basepath.SiteURL(req); site != rw.site {
+			r, _ := rw.to(site)
+			cache.ServeContent(w, req, []byte(r.Replace(string(f.raw))), f.modTime, cache.Revalidate)
+
+			return
+		}
+	}
+
+	cache.ServeEncoded(w, req, f.content, f.variants, f.modTime, cache.Revalidate)
+}
+
+// to returns the replacer of the specification URLs configured, rewriting those without a URL to the
+// site URL given, and whether there are any such.
+func (rw *rewrite) to(site string) (*strings.Replacer, bool) {
+	var (
+		replacements []string
+		toSite       bool
+	)
+
+	// Configure the replacer with key=value pairs
+	for k, v := range rw.urls {
+		if v != "" {
+			// Map between configured to=from URL pair
+			replacements = append(replacements, k, v)
+		} else {
+			// Map between configured URL and site URL
+			replacements = append(replacements, k, site)
+			toSite = true
+		}
+	}
+
+	return strings.NewReplacer(replacements...), toSite
 }
@@ -24,26 +24,31 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 
+	"github.com/kenjones-cisco/dapperdox/handlers/cache"
 	"github.com/kenjones-cisco/dapperdox/render"
 	"github.com/kenjones-cisco/dapperdox/render/asset"
 )
 
-// Register creates routes for each static resource.
-func Register(r *mux.Router) {
+// Register creates routes for each static resource compiled for the renderer.
+func Register(r *mux.Router, rnd *render.Renderer) {
 	log().Debug("registering not found handler in static package")
 
 	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		render.HTML(w, http.StatusNotFound, "error", render.DefaultVars(req, nil, map[string]interface{}{"error": "Page not found", "code": http.StatusNotFound}))
+		rnd.HTML(w, http.StatusNotFound, "error", rnd.DefaultVars(req, nil, map[string]interface{}{"error": "Page not found", "code": http.StatusNotFound}))
 	})
 
 	log().Debug("registering static content handlers for static package")
 
 	var allow bool
 
-	for _, file := range asset.Names() {
+	loaded := time.Now()
+	assets := rnd.Assets()
+
+	for _, file := range assets.Names() {
 		mimeType := mime.TypeByExtension(filepath.Ext(file))
 
 		if mimeType == "" {
@@ -52,34 +57,49 @@ func Register(r *mux.Router) {
 
 		log().Debugf("Got MIME type: %s", mimeType)
 
+		// Compare without parameters, as text types may be registered with a charset
+		mediaType, _, _ := mime.ParseMediaType(mimeType)
+
 		switch {
-		case strings.HasPrefix(mimeType, "image"),
-			strings.HasPrefix(mimeType, "text/css"),
-			strings.HasSuffix(mimeType, "javascript"):
+		case strings.HasPrefix(mediaType, "image"),
+			strings.HasPrefix(mediaType, "text/css"),
+			strings.HasSuffix(mediaType, "javascript"):
 			allow = true
 		default:
 			allow = false
 		}
 
-		if allow {
+		if allow && strings.HasPrefix(file, asset.StaticPrefix+"/") {
 			// Drop assets/static prefix
-			path := strings.TrimPrefix(file, "assets/static")
+			path := strings.TrimPrefix(file, asset.StaticPrefix)
 
-			log().Debugf("registering handler for static asset: %s", path)
+			b, err := assets.Asset(file)
+			if err != nil {
+				// This should never happen!
+				log().Errorf("it happened ¯\\_(ツ)_/¯ %s", path)
 
-			r.Path(path).Methods(http.MethodGet).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-				if b, err := asset.Asset("assets/static" + path); err == nil {
-					w.Header().Set("Content-Type", mimeType)
-					w.Header().Set("Cache-control", "public, max-age=259200")
-					w.WriteHeader(http.StatusOK)
-					_, _ = w.Write(b)
+				continue
+			}
+
+			etag := cache.ETag(b)
+			variants := assets.Encoded(file)
 
-					return
+			serve := func(directive string) http.HandlerFunc {
+				return func(w http.ResponseWriter, req *http.Request) {
+					w.Header().Set("Content-Type", mimeType)
+					w.Header().Set("ETag", etag)
+					cache.ServeEncoded(w, req, b, variants, loaded, directive)
 				}
-				// This should never happen!
-				log().Errorf("it happened ¯\\_(ツ)_/¯ %s", path)
-				r.NotFoundHandler.ServeHTTP(w, req)
-			})
+			}
+
+			log().Debugf("registering handler for static asset: %s", path)
+
+			r.Path(path).Methods(http.MethodGet, http.MethodHead).HandlerFunc(serve(cache.Revalidate))
+
+			// The fingerprinted path changes with the content, so it is never stale.
+			if fp := assets.Fingerprint(path); fp != path {
+				r.Path(fp).Methods(http.MethodGet, http.MethodHead).HandlerFunc(serve(cache.Immutable))
+			}
 		}
 	}
 }
@@ -111,3 +111,17 @@ func (tw *writer) WriteHeader(code int) {
 	tw.wroteHeader = true
 	tw.w.WriteHeader(code)
 }
+
+// Flush sends any buffered data to the client, unless the handler has timed out.
+func (tw *writer) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,92 @@
+package timeout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newHandler returns the handler of h, timing out when expire is closed.
+func newHandler(h http.HandlerFunc, expire chan time.Time) http.Handler {
+	return &handler{h, func() <-chan time.Time { return expire }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestTimeout)
+	})}
+}
+
+func TestHandler(t *testing.T) {
+	t.Run("in time", func(t *testing.T) {
+		h := newHandler(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("page"))
+		}, make(chan time.Time))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if w.Code != http.StatusOK || w.Body.String() != "page" {
+			t.Errorf("status = %d, body %q, want %d, page", w.Code, w.Body.String(), http.StatusOK)
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		expire, release, wrote := make(chan time.Time), make(chan struct{}), make(chan error, 1)
+
+		h := newHandler(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+
+			_, err := w.Write([]byte("late"))
+			wrote <- err
+		}, expire)
+
+		w := httptest.NewRecorder()
+
+		close(expire)
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		close(release)
+
+		if w.Code != http.StatusRequestTimeout {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusRequestTimeout)
+		}
+
+		if err := <-wrote; err == nil {
+			t.Error("write after the timeout error = nil, want an error")
+		}
+
+		if w.Body.Len() != 0 {
+			t.Errorf("body = %q, want nothing written after the timeout", w.Body.String())
+		}
+	})
+}
+
+// TestStreaming flushes a response before the time limit, which the timeout then leaves to the
+// client as it is, rather than answering it twice.
+func TestStreaming(t *testing.T) {
+	expire, flushed, release, done := make(chan time.Time), make(chan struct{}), make(chan struct{}), make(chan struct{})
+
+	h := newHandler(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		close(flushed)
+
+		<-release
+		w.(http.Flusher).Flush() // After the timeout, not passed on.
+	}, expire)
+
+	w := httptest.NewRecorder()
+
+	go func() {
+		<-flushed
+		close(expire)
+	}()
+
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	close(release)
+	<-done
+
+	if w.Code != http.StatusOK || w.Body.String() != "data: 1\n\n" || !w.Flushed {
+		t.Errorf("status = %d, body %q, flushed %v, want the stream flushed before the timeout", w.Code, w.Body.String(), w.Flushed)
+	}
+}
@@ -1,10 +1,20 @@
 package logger
 
 import (
+	"fmt"
 	stdlog "log"
+	"os"
+	"strings"
 	"sync"
 
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// all log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
 )
 
 var (
@@ -40,17 +50,83 @@ func SetLevel(level string) {
 	}
 }
 
+// SetFormat sets the format of log messages, being text or json.
+func SetFormat(format string) error {
+	newLogger()
+
+	var f logrus.Formatter
+
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		f = textFormatter()
+	case FormatJSON:
+		f = &logrus.JSONFormatter{TimestampFormat: RFC3339NanoFixed}
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	logrus.SetFormatter(f)
+	_logger.(*logrus.Entry).Logger.SetFormatter(f)
+
+	return nil
+}
+
+var output *lumberjack.Logger // The log file, when logging to one
+
+// SetOutput writes log messages to the file, rotating it when it grows beyond maxSize megabytes
+// and keeping maxBackups rotated files. Messages are written to stderr when no file is given.
+func SetOutput(file string, maxSize, maxBackups int) error {
+	newLogger()
+
+	l := _logger.(*logrus.Entry).Logger
+
+	if output != nil {
+		if output.Filename == file && output.MaxSize == maxSize && output.MaxBackups == maxBackups {
+			return nil
+		}
+
+		defer output.Close()
+	}
+
+	if file == "" {
+		output = nil
+
+		logrus.SetOutput(os.Stderr)
+		l.SetOutput(os.Stderr)
+
+		return nil
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_ = f.Close()
+
+	output = &lumberjack.Logger{Filename: file, MaxSize: maxSize, MaxBackups: maxBackups}
+
+	logrus.SetOutput(output)
+	l.SetOutput(output)
+
+	return nil
+}
+
+func textFormatter() logrus.Formatter {
+	return &logrus.TextFormatter{
+		TimestampFormat:  RFC3339NanoFixed,
+		FullTimestamp:    true,
+		QuoteEmptyFields: true,
+	}
+}
+
 func newLogger() logrus.Ext1FieldLogger {
 	initialize.Do(func() {
 		l := logrus.New()
 		// configure the default logger to include timestamps and quote empty fields to make visually
 		// seeing an empty Field easier. These configurations will not impact or influence the
 		// configuration of the logstash hook below.
-		l.Formatter = &logrus.TextFormatter{
-			TimestampFormat:  RFC3339NanoFixed,
-			FullTimestamp:    true,
-			QuoteEmptyFields: true,
-		}
+		l.Formatter = textFormatter()
 
 		_logger = logrus.NewEntry(l)
 
@@ -18,6 +18,7 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -31,6 +32,8 @@ import (
 	"github.com/kenjones-cisco/dapperdox/handlers"
 	log "github.com/kenjones-cisco/dapperdox/logger"
 	"github.com/kenjones-cisco/dapperdox/network"
+	"github.com/kenjones-cisco/dapperdox/server"
+	"github.com/kenjones-cisco/dapperdox/tracing"
 	"github.com/kenjones-cisco/dapperdox/version"
 )
 
@@ -52,14 +55,18 @@ func main() {
 
 	config.Init()
 
-	log.SetLevel(viper.GetString(config.LogLevel))
+	if err := server.ConfigureLogging(); err != nil {
+		log.Logger().Fatalf("Error configuring logging: %s", err)
+	}
+
+	shutdownTracing, err := tracing.Init()
+	if err != nil {
+		log.Logger().Fatalf("Error configuring tracing: %s", err)
+	}
 
-	chain := handlers.NewRouterChain()
+	srv := server.New(handlers.NewRouterChain)
 
-	var (
-		listener net.Listener
-		err      error
-	)
+	var listener net.Listener
 
 	if viper.GetString(config.TLSCert) != "" && viper.GetString(config.TLSKey) != "" {
 		listener, err = network.NewSecuredListener()
@@ -71,7 +78,13 @@ func main() {
 		log.Logger().Fatalf("Error listening on %s: %s", viper.GetString(config.BindAddr), err)
 	}
 
-	if err = http.Serve(listener, chain); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	err = srv.Run(listener)
+
+	if terr := shutdownTracing(context.Background()); terr != nil {
+		log.Logger().Errorf("Error flushing traces: %s", terr)
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Logger().Fatalf("%v", err)
 	}
 }
@@ -0,0 +1,170 @@
+// Package metrics collects the metrics of the documentation service, for Prometheus to scrape.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/kenjones-cisco/dapperdox/handlers/capture"
+)
+
+const namespace = "dapperdox"
+
+// Path is the path the metrics are served at, on the metrics listener.
+const Path = "/metrics"
+
+// unmatched labels requests matching no route.
+const unmatched = "unmatched"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve HTTP requests, by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	renderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "render_duration_seconds",
+		Help:      "Time to render pages, by template.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"template"})
+
+	renderCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "render_cache_lookups_total",
+		Help:      "Pages looked up in the render cache, by result.",
+	}, []string{"result"})
+
+	renderCacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "render_cache_bytes",
+		Help:      "Size of the pages held in the render cache.",
+	})
+
+	proxyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "proxy_request_duration_seconds",
+		Help:      "Time to proxy requests, by target and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"target", "code"})
+
+	specifications = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "specifications",
+		Help:      "Specifications loaded.",
+	})
+
+	operations = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "operations",
+		Help:      "Operations of the current API versions of the loaded specifications.",
+	})
+
+	lastReload = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_timestamp_seconds",
+		Help:      "Time of the last configuration load or reload.",
+	})
+
+	lastReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration load or reload succeeded.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		requests, requestDuration, renderDuration, renderCacheLookups, renderCacheBytes, proxyDuration,
+		specifications, operations, lastReload, lastReloadSuccess,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorLog: errorLogger{}})
+}
+
+// Middleware counts and times the requests, labelled by the template of the route they matched.
+func Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := time.Now()
+		sw := capture.Wrap(w)
+
+		h.ServeHTTP(sw, r)
+
+		route := unmatched
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if t, err := cr.GetPathTemplate(); err == nil {
+				route = t
+			}
+		}
+
+		requests.WithLabelValues(route, r.Method, strconv.Itoa(sw.Status())).Inc()
+		requestDuration.WithLabelValues(route, r.Method).Observe(time.Since(s).Seconds())
+	})
+}
+
+// ObserveRender records the time taken to render a template.
+func ObserveRender(template string, d time.Duration) {
+	renderDuration.WithLabelValues(template).Observe(d.Seconds())
+}
+
+// ObserveRenderCache records whether a page was found in the render cache.
+func ObserveRenderCache(hit bool) {
+	if hit {
+		renderCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		renderCacheLookups.WithLabelValues("miss").Inc()
+	}
+}
+
+// SetRenderCacheSize records the size of the pages held in the render cache.
+func SetRenderCacheSize(bytes int64) {
+	renderCacheBytes.Set(float64(bytes))
+}
+
+// ObserveProxy records the time taken and status of a proxied request.
+func ObserveProxy(target string, status int, d time.Duration) {
+	proxyDuration.WithLabelValues(target, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+// SetSpecifications records the number of specifications and operations loaded.
+func SetSpecifications(specs, ops int) {
+	specifications.Set(float64(specs))
+	operations.Set(float64(ops))
+}
+
+// ObserveReload records the time and outcome of loading the configuration.
+func ObserveReload(ok bool) {
+	lastReload.SetToCurrentTime()
+
+	if ok {
+		lastReloadSuccess.Set(1)
+	} else {
+		lastReloadSuccess.Set(0)
+	}
+}
+
+type errorLogger struct{}
+
+func (errorLogger) Println(v ...interface{}) {
+	log().Error(v...)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMiddleware(t *testing.T) {
+	rtr := mux.NewRouter()
+	rtr.Use(Middleware)
+	rtr.HandleFunc("/metrics-test/pets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	rtr.NotFoundHandler = Middleware(http.NotFoundHandler())
+
+	for _, path := range []string{"/metrics-test/pets/1", "/metrics-test/pets/2", "/metrics-test/owners"} {
+		rtr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	ObserveProxy("/metrics-test/", http.StatusBadGateway, time.Millisecond)
+
+	got := scrape(t)
+
+	for _, want := range []string{
+		`dapperdox_http_requests_total{code="201",method="POST",route="/metrics-test/pets/{id}"} 2`,
+		`dapperdox_http_requests_total{code="404",method="POST",route="unmatched"} 1`,
+		`dapperdox_proxy_request_duration_seconds_count{code="502",target="/metrics-test/"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics do not include %s", want)
+		}
+	}
+
+	if strings.Contains(got, "/metrics-test/pets/1") {
+		t.Error("metrics labelled by path rather than route template")
+	}
+}
+
+func TestObserveReload(t *testing.T) {
+	ObserveReload(false)
+
+	if got := scrape(t); !strings.Contains(got, "dapperdox_config_last_reload_successful 0") {
+		t.Error("failed reload not recorded")
+	}
+
+	ObserveReload(true)
+
+	if got := scrape(t); !strings.Contains(got, "dapperdox_config_last_reload_successful 1") {
+		t.Error("successful reload not recorded")
+	}
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, Path, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s = %d, want %d", Path, w.Code, http.StatusOK)
+	}
+
+	return w.Body.String()
+}
@@ -22,12 +22,19 @@ package network
 import (
 	"crypto/tls"
 	"net"
+	"sync"
 
 	"github.com/spf13/viper"
 
 	"github.com/kenjones-cisco/dapperdox/config"
 )
 
+// certificate is served by secured listeners, and replaced when reloaded.
+var certificate struct {
+	sync.RWMutex
+	crt *tls.Certificate
+}
+
 // NewListener creates a new network Listener.
 func NewListener() (net.Listener, error) {
 	log().Infof("listening on %s for unsecured connections", viper.GetString(config.BindAddr))
@@ -37,8 +44,7 @@ func NewListener() (net.Listener, error) {
 
 // NewSecuredListener creates a secure network Listener.
 func NewSecuredListener() (net.Listener, error) {
-	crt, err := tls.LoadX509KeyPair(viper.GetString(config.TLSCert), viper.GetString(config.TLSKey))
-	if err != nil {
+	if err := ReloadCertificate(); err != nil {
 		return nil, err
 	}
 
@@ -63,7 +69,7 @@ func NewSecuredListener() (net.Listener, error) {
 			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
 			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
 		},
-		Certificates: []tls.Certificate{crt},
+		GetCertificate: getCertificate,
 	}
 
 	l, err := newListener()
@@ -76,6 +82,28 @@ func NewSecuredListener() (net.Listener, error) {
 	return tls.NewListener(l, tlscfg), nil
 }
 
+// ReloadCertificate reads the TLS certificate and key again, for new connections to secured
+// listeners. The certificate in use is kept when they cannot be read.
+func ReloadCertificate() error {
+	crt, err := tls.LoadX509KeyPair(viper.GetString(config.TLSCert), viper.GetString(config.TLSKey))
+	if err != nil {
+		return err
+	}
+
+	certificate.Lock()
+	certificate.crt = &crt
+	certificate.Unlock()
+
+	return nil
+}
+
+func getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificate.RLock()
+	defer certificate.RUnlock()
+
+	return certificate.crt, nil
+}
+
 func newListener() (net.Listener, error) {
 	return net.Listen("tcp", viper.GetString(config.BindAddr))
 }
@@ -26,26 +26,53 @@ package asset
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"io/fs"
+	"mime"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/spf13/viper"
 
+	"github.com/kenjones-cisco/dapperdox/assets"
+	"github.com/kenjones-cisco/dapperdox/compression"
 	"github.com/kenjones-cisco/dapperdox/config"
 	"github.com/kenjones-cisco/dapperdox/formatter"
 )
 
-var (
-	_bindata      = map[string][]byte{}
-	_metadata     = map[string]map[string]string{}
+// Store holds the assets compiled for a build of the portal, with their metadata. Assets are only
+// added to a store while it is compiled, so the assets of a changed source are compiled into a new
+// store.
+type Store struct {
+	mu            sync.RWMutex // Guards the assets and their metadata
+	bindata       map[string][]byte
+	metadata      map[string]map[string]string
+	fingerprints  map[string]string
+	encoded       map[string]compression.Variants
 	guideReplacer *strings.Replacer
 	gfmReplace    []*gfmReplacer
-)
+}
+
+// New returns an empty store.
+func New() *Store {
+	return &Store{
+		bindata:      map[string][]byte{},
+		metadata:     map[string]map[string]string{},
+		fingerprints: map[string]string{},
+		encoded:      map[string]compression.Variants{},
+	}
+}
+
+// StaticPrefix prefixes the names of the static assets, served as they are.
+const StaticPrefix = "assets/static"
+
+// fingerprintLength is the number of hex digits of the content hash in fingerprinted paths.
+const fingerprintLength = 10
 
 var (
 	sectionSplitRegex = regexp.MustCompile(`\[\[[\w\-/]+\]\]`)
@@ -53,19 +80,34 @@ var (
 )
 
 // Asset returns asset content.
-func Asset(name string) ([]byte, error) {
+func (s *Store) Asset(name string) ([]byte, error) {
 	cannonicalName := strings.ReplaceAll(name, "\\", "/")
-	if a, ok := _bindata[cannonicalName]; ok {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if a, ok := s.bindata[cannonicalName]; ok {
 		return a, nil
 	}
 
 	return nil, fmt.Errorf("Asset %s not found", name)
 }
 
+// Encoded returns the compressed encodings of a static asset, or nil when it has none.
+func (s *Store) Encoded(name string) compression.Variants {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.encoded[strings.ReplaceAll(name, "\\", "/")]
+}
+
 // Names returns all asset names.
-func Names() []string {
-	names := make([]string, 0, len(_bindata))
-	for name := range _bindata {
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.bindata))
+	for name := range s.bindata {
 		names = append(names, name)
 	}
 
@@ -73,8 +115,11 @@ func Names() []string {
 }
 
 // MetaData returns file metadata.
-func MetaData(filename, name string) string {
-	if md, ok := _metadata[filename]; ok {
+func (s *Store) MetaData(filename, name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if md, ok := s.metadata[filename]; ok {
 		if val, ok := md[strings.ToLower(name)]; ok {
 			return val
 		}
@@ -83,10 +128,31 @@ func MetaData(filename, name string) string {
 	return ""
 }
 
-// Compile specs.
-func Compile(dir, prefix string) {
+// Fingerprint returns the URL path of the static asset at path with a hash of its content inserted
+// before the extension, so /css/style.css becomes /css/style.0123456789.css. Fingerprinted paths
+// change whenever the content does, so they can be cached as immutable. The path is returned
+// unchanged when there is no such asset.
+func (s *Store) Fingerprint(path string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if h, ok := s.fingerprints[StaticPrefix+path]; ok {
+		ext := filepath.Ext(path)
+
+		return strings.TrimSuffix(path, ext) + "." + h + ext
+	}
+
+	return path
+}
+
+// Compile compiles the assets of the directory dir of a file system, naming them with the prefix
+// given. Assets already compiled take precedence, so sources are compiled from the most specific to
+// the defaults.
+func (s *Store) Compile(fsys fs.FS, dir, prefix string) {
+	log().Debugf("- Scanning directory %s", dir)
+
 	// Build a replacer to search/replace Document URLs in the documents.
-	if guideReplacer == nil {
+	if s.guideReplacer == nil {
 		var replacements []string
 
 		// Configure the replacer with key=value pairs
@@ -94,42 +160,31 @@ func Compile(dir, prefix string) {
 			replacements = append(replacements, k, v)
 		}
 
-		guideReplacer = strings.NewReplacer(replacements...)
-	}
-
-	dir, err := filepath.Abs(dir)
-	if err != nil {
-		log().Errorf("Error forming absolute path: %s", err)
+		s.guideReplacer = strings.NewReplacer(replacements...)
 	}
 
-	log().Debugf("- Scanning directory %s", dir)
-
-	dir = filepath.ToSlash(dir)
-
-	_ = filepath.Walk(dir, func(path string, info os.FileInfo, _ error) error {
-		path = filepath.Clean(filepath.ToSlash(path))
-
-		if info == nil {
+	_ = fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
 			return nil
 		}
-		if info.IsDir() {
+
+		if d.IsDir() {
 			// Skip hidden directories TODO this should be applied to files also.
-			_, node := filepath.Split(path)
-			if node[0] == '.' {
-				return filepath.SkipDir
+			if path != dir && d.Name()[0] == '.' {
+				return fs.SkipDir
 			}
 
 			return nil
 		}
 
-		buf, err := ioutil.ReadFile(path)
+		buf, err := fs.ReadFile(fsys, path)
 		if err != nil {
 			panic(err)
 		}
 
-		relative, err := filepath.Rel(dir, path)
-		if err != nil {
-			panic(err)
+		relative := path
+		if dir != "." {
+			relative = strings.TrimPrefix(path, dir+"/")
 		}
 
 		ext := filepath.Ext(path)
@@ -154,53 +209,65 @@ func Compile(dir, prefix string) {
 				}
 
 				for i, heading := range headings {
-					buf = processMarkdown([]byte(sections[i]))
+					buf = s.processMarkdown([]byte(sections[i]))
 
 					relative = filepath.Join(mdname, heading, "overlay.tmpl")
-					storeTemplate(prefix, relative, guideReplacer.Replace(string(buf)), meta)
+					s.storeTemplate(prefix, relative, s.guideReplacer.Replace(string(buf)), meta)
 				}
 			} else {
-				buf = processMarkdown(buf) // Convert markdown into HTML
+				buf = s.processMarkdown(buf) // Convert markdown into HTML
 
 				relative = mdname + ".tmpl"
-				storeTemplate(prefix, relative, guideReplacer.Replace(string(buf)), meta)
+				s.storeTemplate(prefix, relative, s.guideReplacer.Replace(string(buf)), meta)
 			}
 		case ".tmpl":
 			buf, meta = processMetadata(buf)
-			storeTemplate(prefix, relative, guideReplacer.Replace(string(buf)), meta)
+			s.storeTemplate(prefix, relative, s.guideReplacer.Replace(string(buf)), meta)
 
 		case ".html":
 			log().Panicf("  * Error - Refusing to process .html files. Expects HTML template fragments with .tmpl extension. File %s", relative)
 
 		default:
-			storeTemplate(prefix, relative, guideReplacer.Replace(string(buf)), meta)
+			s.storeTemplate(prefix, relative, s.guideReplacer.Replace(string(buf)), meta)
 		}
 
 		return nil
 	})
 }
 
-func storeTemplate(prefix, name, template string, meta map[string]string) {
+func (s *Store) storeTemplate(prefix, name, template string, meta map[string]string) {
 	newname := filepath.ToSlash(filepath.Join(prefix, name))
 
-	if _, ok := _bindata[newname]; !ok {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.bindata[newname]; !ok {
 		log().Debugf("  + Import %s", newname)
 		// Store the template, doing and search/replaces on the way
-		_bindata[newname] = []byte(template)
+		s.bindata[newname] = []byte(template)
+
+		if strings.HasPrefix(newname, StaticPrefix+"/") {
+			sum := sha256.Sum256(s.bindata[newname])
+			s.fingerprints[newname] = hex.EncodeToString(sum[:])[:fingerprintLength]
+
+			if v := compression.Precompress(mime.TypeByExtension(filepath.Ext(newname)), s.bindata[newname]); v != nil {
+				s.encoded[newname] = v
+			}
+		}
 
 		if len(meta) > 0 {
 			log().Trace("    + Adding metadata")
 
-			_metadata[newname] = meta
+			s.metadata[newname] = meta
 		}
 	}
 }
 
 // processMarkdown Returns rendered markdown.
-func processMarkdown(doc []byte) []byte {
+func (s *Store) processMarkdown(doc []byte) []byte {
 	html := formatter.Markdown(doc)
 	// Apply any HTML substitutions
-	for _, rep := range gfmReplace {
+	for _, rep := range s.gfmReplace {
 		html = rep.Regexp.ReplaceAll(html, rep.Replace)
 	}
 
@@ -275,61 +342,17 @@ func splitOnSection(text string) ([]string, []string) {
 }
 
 // CompileGFMMap github markdown.
-func CompileGFMMap() {
-	var mapfile string
-
-	if viper.GetString(config.AssetsDir) != "" {
-		mapfile = filepath.Join(viper.GetString(config.AssetsDir), "gfm.map")
-		log().Tracef("Looking in assets dir for %s", mapfile)
-
-		if _, err := os.Stat(mapfile); os.IsNotExist(err) {
-			mapfile = ""
-		}
-	}
-
-	if mapfile == "" && viper.GetString(config.ThemeDir) != "" {
-		mapfile = filepath.Join(viper.GetString(config.ThemeDir), viper.GetString(config.Theme), "gfm.map")
-		log().Tracef("Looking in theme dir for %s", mapfile)
-
-		if _, err := os.Stat(mapfile); os.IsNotExist(err) {
-			mapfile = ""
-		}
-	}
-
-	if mapfile == "" {
-		mapfile = filepath.Join(viper.GetString(config.DefaultAssetsDir), "themes", viper.GetString(config.Theme), "gfm.map")
-		log().Tracef("Looking in default theme dir for %s", mapfile)
-
-		if _, err := os.Stat(mapfile); os.IsNotExist(err) {
-			mapfile = ""
-		}
-	}
-
-	if mapfile == "" {
-		mapfile = filepath.Join(viper.GetString(config.DefaultAssetsDir), "themes", "default", "gfm.map")
-		log().Tracef("Looking in default theme for %s", mapfile)
-
-		if _, err := os.Stat(mapfile); os.IsNotExist(err) {
-			mapfile = ""
-		}
-	}
-
-	if mapfile == "" {
+func (s *Store) CompileGFMMap(open func(location string) (fs.FS, error)) {
+	file, mapfile, err := assets.Open(open, "gfm.map")
+	if err != nil {
 		log().Trace("No GFM HTML mapfile found")
 
 		return
 	}
+	defer file.Close()
 
 	log().Tracef("Processing GFM HTML mapfile: %s", mapfile)
 
-	file, err := os.Open(mapfile)
-	if err != nil {
-		log().Errorf("Error: %s", err)
-
-		return
-	}
-	defer file.Close()
-
 	scanner := bufio.NewScanner(file)
 
 	for scanner.Scan() {
@@ -338,7 +361,7 @@ func CompileGFMMap() {
 		rep := &gfmReplacer{}
 		if rep.Parse(line) != nil {
 			log().Tracef("GFM replace %s with %s", rep.Regexp, rep.Replace)
-			gfmReplace = append(gfmReplace, rep)
+			s.gfmReplace = append(s.gfmReplace, rep)
 		}
 	}
 
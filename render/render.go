@@ -20,87 +20,184 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package render
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"html/template"
 	"io"
+	"io/fs"
 	"math"
-	"net/http"
-	"path/filepath"
+	"path"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/unrolled/render"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/kenjones-cisco/dapperdox/assets"
 	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/gitsource"
+	"github.com/kenjones-cisco/dapperdox/metrics"
 	"github.com/kenjones-cisco/dapperdox/render/asset"
 	"github.com/kenjones-cisco/dapperdox/spec"
+	"github.com/kenjones-cisco/dapperdox/tracing"
 )
 
-var (
-	// global instance of github.com/unrolled/render.Render.
-	_render *render.Render
-
-	counter int
-)
+// Renderer renders the pages of a build of the portal, from the templates and assets compiled for it.
+// A renderer is not changed once the routes of the build are registered, so a new one is created
+// when the configuration is reloaded, and requests in progress complete with the one they started
+// with.
+type Renderer struct {
+	render *render.Render
+	assets *asset.Store
+	suite  *spec.Suite
+
+	config        interface{} // Configuration used within templates, as it was when created
+	forceSpecList bool
+	mockEnabled   bool
+
+	guides       map[string]GuideType // Per specification-id, or 'top-level'
+	environments map[string][]string  // Names of the environments the API explorer can target, per specification-id
+	explorerURLs map[string]string    // Base URLs the API explorer sends requests to, per specification-id
+
+	// mu serialises renders, as github.com/unrolled/render does, so the template helpers keeping
+	// state can be given fresh state for each render.
+	mu sync.Mutex
+}
 
-// Register is alias for initializing new render.Render.
-func Register() {
+// New compiles the templates and assets for the specifications of the suite, from the assets source
+// configured, or the tag of the git source published in its place, and the defaults.
+func New(suite *spec.Suite, src *gitsource.Source) *Renderer {
 	log().Debug("initializing Render")
 
-	_render = new()
+	r := &Renderer{
+		assets:        asset.New(),
+		suite:         suite,
+		config:        config.C,
+		forceSpecList: viper.GetBool(config.ForceSpecList),
+		mockEnabled:   viper.GetBool(config.MockEnabled),
+		guides:        map[string]GuideType{},
+		environments:  map[string][]string{},
+		explorerURLs:  map[string]string{},
+	}
+
+	r.render = r.compile(src)
+
+	return r
+}
+
+// Assets returns the assets compiled for the renderer.
+func (r *Renderer) Assets() *asset.Store {
+	return r.assets
 }
 
 // HTML is an alias to github.com/unrolled/render.Render.HTML.
-func HTML(w io.Writer, status int, name string, binding interface{}, htmlOpt ...render.HTMLOptions) {
-	_ = _render.HTML(w, status, name, binding, htmlOpt...)
+func (r *Renderer) HTML(w io.Writer, status int, name string, binding interface{}, htmlOpt ...render.HTMLOptions) {
+	s := time.Now()
+
+	ctx, span := tracing.Start(bindingContext(binding), "render "+name, trace.WithAttributes(tracing.String("template", name)))
+	defer span.End()
+
+	if m, ok := binding.(map[string]interface{}); ok {
+		m[contextVar] = ctx // Overlays are traced within the render
+	}
+
+	r.execute(w, status, name, binding, htmlOpt)
+
+	metrics.ObserveRender(name, time.Since(s))
+}
+
+// Fragment renders a template without the layout, as part of a page for the page to load.
+func (r *Renderer) Fragment(w io.Writer, status int, name string, binding interface{}) {
+	r.HTML(w, status, name, binding, render.HTMLOptions{Layout: ""})
+}
+
+// execute renders the template with fresh state for its helpers.
+func (r *Renderer) execute(w io.Writer, status int, name string, binding interface{}, htmlOpt []render.HTMLOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t := r.render.TemplateLookup(name); t != nil {
+		t.Funcs(statefulFuncs())
+	}
+
+	_ = r.render.HTML(w, status, name, binding, htmlOpt...)
+}
+
+// bindingContext returns the context of the request the template data was made for.
+func bindingContext(binding interface{}) context.Context {
+	if m, ok := binding.(map[string]interface{}); ok {
+		if ctx, ok := m[contextVar].(context.Context); ok {
+			return ctx
+		}
+	}
+
+	return context.Background()
 }
 
 // TemplateLookup is an alias to github.com/unrolled/render.TemplateLookup.
-func TemplateLookup(t string) *template.Template {
-	return _render.TemplateLookup(t)
+func (r *Renderer) TemplateLookup(t string) *template.Template {
+	return r.render.TemplateLookup(t)
 }
 
-func new() *render.Render {
+func (r *Renderer) compile(src *gitsource.Source) *render.Render {
 	log().Trace("creating instance of render.Render")
 
-	asset.CompileGFMMap()
+	r.assets.CompileGFMMap(src.Open)
 
 	// XXX Order of directory importing is IMPORTANT XXX
-	if viper.GetString(config.AssetsDir) != "" {
-		asset.Compile(filepath.Join(viper.GetString(config.AssetsDir), "templates"), "assets/templates")
-		asset.Compile(filepath.Join(viper.GetString(config.AssetsDir), "static"), "assets/static")
-		asset.Compile(filepath.Join(viper.GetString(config.AssetsDir), "themes", viper.GetString(config.Theme)), "assets")
-		compileSections(viper.GetString(config.AssetsDir))
+	theme := viper.GetString(config.Theme)
+
+	if dir := viper.GetString(config.AssetsDir); dir != "" {
+		if fsys, err := src.Open(dir); err != nil {
+			log().Errorf("Error opening assets %s: %s", dir, err)
+		} else {
+			r.assets.Compile(fsys, "templates", "assets/templates")
+			r.assets.Compile(fsys, "static", "assets/static")
+			r.assets.Compile(fsys, path.Join("themes", theme), "assets")
+			r.compileSections(fsys)
+		}
+	}
+
+	r.compileRefSections()
+
+	// The defaults are compiled in, unless a default assets source is configured
+	defaults, err := assets.Default()
+	if err != nil {
+		log().Errorf("Error opening default assets, using those compiled in: %s", err)
 	}
 
 	// Import custom theme from custom directory (if defined)
-	if viper.GetString(config.Theme) != "" {
-		dir := filepath.Join(viper.GetString(config.DefaultAssetsDir), "themes")
-		if viper.GetString(config.ThemeDir) != "" {
-			dir = viper.GetString(config.ThemeDir)
+	if theme != "" {
+		if dir := viper.GetString(config.ThemeDir); dir != "" {
+			if themes, err := src.Open(dir); err != nil {
+				log().Errorf("Error opening themes %s: %s", dir, err)
+			} else {
+				r.assets.Compile(themes, theme, "assets")
+			}
+		} else {
+			r.assets.Compile(defaults, path.Join("themes", theme), "assets")
 		}
-
-		asset.Compile(filepath.Join(dir, viper.GetString(config.Theme)), "assets")
 	}
 
-	if viper.GetString(config.Theme) != "default" {
+	if theme != "default" {
 		// The default theme underpins all others
-		asset.Compile(filepath.Join(viper.GetString(config.DefaultAssetsDir), "themes", "default"), "assets")
+		r.assets.Compile(defaults, "themes/default", "assets")
 	}
 
-	compileSections(viper.GetString(config.DefaultAssetsDir))
+	r.compileSections(defaults)
 
-	// Fallback to local templates directory
-	asset.Compile(filepath.Join(viper.GetString(config.DefaultAssetsDir), "templates"), "assets/templates")
-	// Fallback to local static directory
-	asset.Compile(filepath.Join(viper.GetString(config.DefaultAssetsDir), "static"), "assets/static")
+	// Fallback to default templates directory
+	r.assets.Compile(defaults, "templates", "assets/templates")
+	// Fallback to default static directory
+	r.assets.Compile(defaults, "static", "assets/static")
 
 	return render.New(render.Options{
-		Asset:      asset.Asset,
-		AssetNames: asset.Names,
+		Asset:      r.assets.Asset,
+		AssetNames: r.assets.Names,
 		Directory:  "assets/templates",
 		Delims:     render.Delims{Left: "[:", Right: ":]"},
 		Layout:     "layout",
@@ -113,51 +210,62 @@ func new() *render.Render {
 			"uc":            strings.ToUpper,
 			"join":          strings.Join,
 			"concat":        func(a, b string) string { return a + b },
-			"counter_set":   func(a int) int { counter = a; return counter },
-			"counter_add":   func(a int) int { counter += a; return counter },
 			"mod":           func(a int, m int) int { return a % m },
 			"sub":           func(a, b interface{}) int64 { return toInt64(a) - toInt64(b) },
 			"safehtml":      func(s string) template.HTML { return template.HTML(s) },
-			"haveTemplate":  TemplateLookup,
-			"overlay":       func(n string, d ...interface{}) template.HTML { return overlayFunc(n, d) },
+			"haveTemplate":  r.TemplateLookup,
+			"overlay":       func(n string, d ...interface{}) template.HTML { return r.overlayFunc(n, d) },
 			"getAssetPaths": func(s string, d ...interface{}) []string { return getAssetPaths(s, d) },
-		}},
+			"asset":         r.assets.Fingerprint,
+		}, statefulFuncs()},
 	})
 }
 
-func compileSections(assetsDir string) {
-	// specification specific guides
-	for _, specification := range spec.APISuite {
-		log().Debugf("- Specification assets for %q", specification.APIInfo.Title)
-		compileSectionPart(specification.ID, assetsDir, "templates", "assets/templates/")
-		compileSectionPart(specification.ID, assetsDir, "static", "assets/static/")
+// statefulFuncs returns the template helpers keeping state, which is that of a single render.
+func statefulFuncs() template.FuncMap {
+	counter := 0
+
+	return template.FuncMap{
+		"counter_set": func(a int) int { counter = a; return counter },
+		"counter_add": func(a int) int { counter += a; return counter },
 	}
 }
 
-func compileSectionPart(id, assetsDir, part, prefix string) {
-	stem := filepath.Join(id, part)
-	asset.Compile(filepath.Join(assetsDir, "sections", stem), filepath.Join(prefix, stem))
+func (r *Renderer) compileSections(fsys fs.FS) {
+	// specification specific guides
+	for _, specification := range r.suite.Specs {
+		log().Debugf("- Specification assets for %q", specification.APIInfo.Title)
+		r.compileSectionPart(specification.ID, fsys, "templates", "assets/templates/")
+		r.compileSectionPart(specification.ID, fsys, "static", "assets/static/")
+	}
 }
 
-// htmlWriter implements an HTML Writer interface.
-type htmlWriter struct {
-	h *bufio.Writer
+func (r *Renderer) compileSectionPart(id string, fsys fs.FS, part, prefix string) {
+	stem := path.Join(id, part)
+	r.assets.Compile(fsys, path.Join("sections", stem), path.Join(prefix, stem))
 }
 
-// Header provides empty implementation.
-func (w htmlWriter) Header() http.Header { return http.Header{} }
+// compileRefSections compiles the guides of the sections published from git refs, which are those of
+// their ref.
+func (r *Renderer) compileRefSections() {
+	for _, specification := range r.suite.Specs {
+		if specification.Ref == nil || specification.Ref.Assets() == nil {
+			continue
+		}
 
-// WriteHeader provides empty implementation.
-func (w htmlWriter) WriteHeader(int) {}
+		log().Debugf("- Section assets for %q", specification.APIInfo.Title)
 
-// Write provides empty implementation.
-func (w htmlWriter) Write(data []byte) (int, error) { return w.h.Write(data) }
+		fsys := specification.Ref.Assets()
+		id := strings.TrimSuffix(specification.ID, "-"+specification.Ref.Section)
+		stem := path.Join(specification.ID, "templates")
 
-// Flush provides empty implementation.
-func (w htmlWriter) Flush() { _ = w.h.Flush() }
+		r.assets.Compile(fsys, path.Join("sections", id, "templates"), path.Join("assets/templates", stem))
+		r.assets.Compile(fsys, "templates/guides", path.Join("assets/templates", stem, "guides"))
+	}
+}
 
 // XXX WHY ARRAY of DATA?
-func overlayFunc(name string, data []interface{}) template.HTML { // TODO Will be specification specific
+func (r *Renderer) overlayFunc(name string, data []interface{}) template.HTML { // TODO Will be specification specific
 	if len(data) == 0 || data[0] == nil {
 		log().Debug("Data nil")
 
@@ -173,20 +281,25 @@ func overlayFunc(name string, data []interface{}) template.HTML { // TODO Will b
 		return ""
 	}
 
+	_, span := tracing.Start(bindingContext(datamap), "overlay "+name)
+	defer span.End()
+
 	var b bytes.Buffer
 
 	// Look for an overlay file in declaration order.... Highest priority is first.
 	for _, op := range overlayPaths(name, datamap) {
 		log().Tracef("Overlay: Does %q exist?", op)
 
-		if TemplateLookup(op) != nil {
+		if t := r.TemplateLookup(op); t != nil {
 			log().Tracef("Applying overlay %q", op)
-
-			writer := htmlWriter{h: bufio.NewWriter(&b)}
+			span.SetAttributes(tracing.String("template", op))
 
 			// data is a single item array (though I've not figured out why yet!)
-			_ = new().HTML(writer, http.StatusOK, op, data[0], render.HTMLOptions{Layout: ""})
-			writer.Flush()
+			// The overlay is executed from the templates compiled for the render in progress, without a layout.
+			if err := t.Execute(&b, data[0]); err != nil {
+				log().Errorf("Error applying overlay %q: %s", op, err)
+				b.Reset()
+			}
 
 			break
 		}
@@ -204,12 +317,12 @@ func overlayPaths(name string, datamap map[string]interface{}) []string {
 	// 3. Resource
 	// 4. Specification List page
 	//
-	if _, ok := datamap["API"].(spec.APIGroup); ok {
-		if _, ok := datamap["Methods"].([]spec.Method); ok {
+	if _, ok := datamap["API"].(*spec.APIGroup); ok {
+		if _, ok := datamap["Methods"].([]*spec.Method); ok {
 			getAPIAssetPaths(name, &overlayName, datamap)
 		}
 
-		if _, ok := datamap["Method"].(spec.Method); ok {
+		if _, ok := datamap["Method"].(*spec.Method); ok {
 			getMethodAssetPaths(name, &overlayName, datamap)
 		}
 	}
@@ -294,7 +407,7 @@ func getOverlayStems(overlayAsset string) *overlayStems {
 }
 
 func getMethodAssetPaths(overlayAsset string, paths *[]string, datamap map[string]interface{}) {
-	method := datamap["Method"].(spec.Method)
+	method := datamap["Method"].(*spec.Method)
 	apiID := method.APIGroup.ID
 
 	a := getOverlayStems(overlayAsset)
@@ -318,7 +431,7 @@ func getMethodAssetPaths(overlayAsset string, paths *[]string, datamap map[strin
 }
 
 func getAPIAssetPaths(overlayAsset string, paths *[]string, datamap map[string]interface{}) {
-	apiID := datamap["API"].(spec.APIGroup).ID
+	apiID := datamap["API"].(*spec.APIGroup).ID
 
 	a := getOverlayStems(overlayAsset)
 
@@ -0,0 +1,233 @@
+package render
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/unrolled/render"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/spec"
+	"github.com/kenjones-cisco/dapperdox/spec/spectest"
+)
+
+const (
+	testAssetsDir = "../assets"
+	// Operations of the large specification benchmarked.
+	benchOperations = 5000
+)
+
+// benchOverlays are the overlays of the method template applied in benchmarks.
+var benchOverlays = []string{"banner", "description", "request", "response", "additional"}
+
+// writeOverlays writes an overlay of each name for all methods to the assets directory dir.
+func writeOverlays(tb testing.TB, dir string, names []string) {
+	tb.Helper()
+
+	for _, name := range names {
+		d := filepath.Join(dir, "templates", "reference", "method", name)
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			tb.Fatal(err)
+		}
+
+		overlay := []byte("<p>[: .Method.Name :] " + name + " overlay</p>")
+		if err := ioutil.WriteFile(filepath.Join(d, "overlay.tmpl"), overlay, 0o600); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func setupLargeSpec(tb testing.TB) (*Renderer, *spec.APISpecification, *spec.APIGroup) {
+	tb.Helper()
+
+	config.Restore()
+
+	dir := tb.TempDir()
+	assets := tb.TempDir()
+
+	writeOverlays(tb, assets, benchOverlays)
+
+	name, err := spectest.WriteLarge(dir, benchOperations)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	viper.Set(config.SpecDir, dir)
+	viper.Set(config.SpecFilename, name)
+	viper.Set(config.AssetsDir, assets)
+	viper.Set(config.DefaultAssetsDir, testAssetsDir)
+	viper.Set(config.Theme, "default")
+
+	suite, err := spec.LoadSpecifications(nil)
+	if err != nil {
+		tb.Fatalf("LoadSpecifications() error = %v", err)
+	}
+
+	r := New(suite, nil)
+
+	for _, s := range suite.Specs {
+		return r, s, s.APIs[0]
+	}
+
+	tb.Fatal("no specification loaded")
+
+	return nil, nil, nil
+}
+
+func methodVars(r *Renderer, s *spec.APISpecification, api *spec.APIGroup) map[string]interface{} {
+	method := api.Methods[0]
+
+	return r.DefaultVars(nil, s, Vars{
+		"Title":         method.Name,
+		"API":           api,
+		"Method":        method,
+		"Version":       api.CurrentVersion,
+		"LatestVersion": api.CurrentVersion,
+	})
+}
+
+func apiVars(r *Renderer, s *spec.APISpecification, api *spec.APIGroup) map[string]interface{} {
+	return r.DefaultVars(nil, s, Vars{
+		"Title":         api.Name,
+		"API":           api,
+		"Methods":       api.Methods,
+		"Version":       api.CurrentVersion,
+		"LatestVersion": api.CurrentVersion,
+	})
+}
+
+// BenchmarkMethodPage renders the page of an operation of a large specification, applying the
+// overlays of the method template.
+func BenchmarkMethodPage(b *testing.B) {
+	r, s, api := setupLargeSpec(b)
+
+	pageBudget.Run(b, func() interface{} {
+		w := httptest.NewRecorder()
+		r.HTML(w, http.StatusOK, "method", methodVars(r, s, api))
+
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "description overlay") {
+			b.Fatalf("HTML() status = %d, without overlays", w.Code)
+		}
+
+		return nil
+	})
+}
+
+// BenchmarkMethodPageParallel renders operation pages concurrently, as requests are served.
+func BenchmarkMethodPageParallel(b *testing.B) {
+	r, s, api := setupLargeSpec(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.HTML(httptest.NewRecorder(), http.StatusOK, "method", methodVars(r, s, api))
+		}
+	})
+}
+
+// BenchmarkAPIPage renders the page listing the operations of an API of a large specification.
+func BenchmarkAPIPage(b *testing.B) {
+	r, s, api := setupLargeSpec(b)
+
+	pageBudget.Run(b, func() interface{} {
+		r.HTML(httptest.NewRecorder(), http.StatusOK, "api", apiVars(r, s, api))
+
+		return nil
+	})
+}
+
+// pageBudget is the time and memory a page of the large specification is to be rendered within.
+var pageBudget = spectest.Budget{Time: 500 * time.Millisecond, Alloc: 32 << 20}
+
+func TestLargeSpecificationPages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping rendering a large specification in short mode")
+	}
+
+	r, s, api := setupLargeSpec(t)
+	other := s.APIs[1]
+
+	w := httptest.NewRecorder()
+	r.HTML(w, http.StatusOK, "method", methodVars(r, s, api))
+
+	page := w.Body.String()
+
+	// The navigation lists the methods of the API shown, and loads those of others when expanded.
+	if link := "/reference/" + api.ID + "/" + api.Methods[1].ID; !strings.Contains(page, link) {
+		t.Errorf("method page does not link to %s", link)
+	}
+
+	if link := "/reference/" + other.ID + "/" + other.Methods[0].ID; strings.Contains(page, link) {
+		t.Errorf("method page links to %s, of another API", link)
+	}
+
+	if nav := "/navigation/reference/" + other.ID; !strings.Contains(page, nav) {
+		t.Errorf("method page does not load the navigation of another API from %s", nav)
+	}
+
+	w = httptest.NewRecorder()
+	r.HTML(w, http.StatusOK, "api", apiVars(r, s, api))
+
+	if link := "/reference/" + api.ID + "/" + api.Methods[len(api.Methods)-1].ID; w.Code != http.StatusOK || !strings.Contains(w.Body.String(), link) {
+		t.Errorf("API page = %d, without a link to %s", w.Code, link)
+	}
+}
+
+func TestCounterIsPerRender(t *testing.T) {
+	config.Restore()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "templates"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "templates", "counter.tmpl"), []byte("[: counter_add 1 :]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Set(config.AssetsDir, dir)
+	viper.Set(config.DefaultAssetsDir, testAssetsDir)
+	viper.Set(config.Theme, "default")
+
+	r := New(&spec.Suite{}, nil)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.HTML(w, http.StatusOK, "counter", nil, render.HTMLOptions{Layout: ""})
+
+		if got := strings.TrimSpace(w.Body.String()); got != "1" {
+			t.Errorf("render %d: counter_add 1 = %q, want %q", i+1, got, "1")
+		}
+	}
+}
+
+func TestEmbeddedDefaults(t *testing.T) {
+	config.Restore()
+
+	viper.Set(config.DefaultAssetsDir, "")
+	viper.Set(config.Theme, "default")
+
+	r := New(&spec.Suite{}, nil)
+
+	for _, name := range []string{"assets/templates/layout.tmpl", "assets/static/css/style.css"} {
+		if _, err := r.Assets().Asset(name); err != nil {
+			t.Errorf("Asset(%q) error = %v, want the default compiled in", name, err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.HTML(w, http.StatusNotFound, "error", r.DefaultVars(nil, nil, Vars{"error": "Page not found", "code": http.StatusNotFound}))
+
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Page not found") {
+		t.Errorf("HTML() status = %d, without the default theme", w.Code)
+	}
+}
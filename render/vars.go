@@ -2,16 +2,22 @@ package render
 
 import (
 	"net/http"
+	"strings"
 
-	"github.com/spf13/viper"
-
-	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/auth"
+	"github.com/kenjones-cisco/dapperdox/handlers/basepath"
+	"github.com/kenjones-cisco/dapperdox/handlers/mock"
+	"github.com/kenjones-cisco/dapperdox/handlers/requestlog"
 	"github.com/kenjones-cisco/dapperdox/navigation"
 	"github.com/kenjones-cisco/dapperdox/spec"
 )
 
-// Guides are per specification-id, or 'top-level'.
-var guides = map[string]GuideType{}
+// EnvironmentCookie carries the environment chosen in the API explorer of a specification. The cookie
+// path is that of the specification, so each specification has its own choice.
+const EnvironmentCookie = "dapperdox-environment"
+
+// contextVar holds the context of the request in the template data, so renders can be traced.
+const contextVar = "RequestContext"
 
 // GuideType defines an array of Navigation for guides.
 type GuideType []*navigation.Node
@@ -20,50 +26,116 @@ type GuideType []*navigation.Node
 type Vars map[string]interface{}
 
 // DefaultVars adds the default vars (config, specs, others....) to the data map.
-func DefaultVars(req *http.Request, s *spec.APISpecification, m Vars) map[string]interface{} {
+func (r *Renderer) DefaultVars(req *http.Request, s *spec.APISpecification, m Vars) map[string]interface{} {
 	if m == nil {
 		log().Trace("creating new template data map")
 
 		m = make(map[string]interface{})
 	}
 
-	m["Config"] = config.C
-	m["APISuite"] = spec.APISuite
-	m["APISuiteGroups"] = spec.APISuiteGroups
+	// Links to pages of the portal are prefixed with the path it is served under.
+	base := basepath.Prefix(req)
+
+	m["Config"] = r.config
+	m["BasePath"] = base
+	m["APISuite"] = auth.Specs(req, r.suite.Specs)
+	m["APISuiteGroups"] = auth.SpecGroups(req, r.suite.Groups)
+
+	if req != nil {
+		m[contextVar] = req.Context()
+
+		if u := auth.FromContext(req.Context()); u != nil {
+			m["User"] = u
+			m["LogoutURL"] = base + auth.LogoutPath
+		}
+	}
 
 	// If we have a multiple specifications or are forcing a parent "root" page for the single specification
 	// then set MultipleSpecs to true to enable navigation back to the root page.
-	if viper.GetBool(config.ForceSpecList) || len(spec.APISuite) > 1 {
+	if r.forceSpecList || len(r.suite.Specs) > 1 {
 		m["MultipleSpecs"] = true
 	}
 
 	if s == nil {
-		m["NavigationGuides"] = guides[""] // Global guides
-		m["SpecPath"] = ""
+		m["NavigationGuides"] = auth.Guides(req, r.guides[""]) // Global guides
+		m["SpecPath"] = base
 
 		return m
 	}
 
+	if req != nil {
+		requestlog.SetSpec(req.Context(), s.ID)
+	}
+
 	// Per specification defaults
-	m["NavigationGuides"] = guides[s.ID]
+	m["NavigationGuides"] = auth.Guides(req, r.guides[s.ID])
 
 	m["ID"] = s.ID
-	m["SpecPath"] = "/" + s.ID
+	m["SpecPath"] = base + "/" + s.ID
 	m["APIs"] = s.APIs
 	m["APIVersions"] = s.APIVersions
 	m["Resources"] = s.ResourceList
 	m["Info"] = s.APIInfo
-	m["SpecURL"] = s.URL
+	m["SpecURL"] = localURL(base, s.URL)
+
+	if u, ok := r.explorerURLs[s.ID]; ok {
+		m["ExplorerURL"] = localURL(base, u)
+	}
+
+	if names, ok := r.environments[s.ID]; ok {
+		m["Environments"] = names
+		m["Environment"] = selectedEnvironment(req, names)
+		m["EnvironmentCookie"] = EnvironmentCookie
+	}
+
+	if r.mockEnabled {
+		m["MockURL"] = base + mock.PathPrefix + "/" + s.ID
+	}
 
 	return m
 }
 
-// SetGuidesNavigation adds api to navigation.
-func SetGuidesNavigation(s *spec.APISpecification, guidesnav []*navigation.Node) {
+// SetGuidesNavigation adds api to navigation. It is called as the routes are registered.
+func (r *Renderer) SetGuidesNavigation(s *spec.APISpecification, guidesnav []*navigation.Node) {
 	id := ""
 	if s != nil {
 		id = s.ID
 	}
 
-	guides[id] = guidesnav
+	r.guides[id] = guidesnav
+}
+
+// SetExplorerURL sets the base URL the API explorer sends requests to for a specification,
+// in place of the host the specification documents. It is called as the routes are registered.
+func (r *Renderer) SetExplorerURL(s *spec.APISpecification, u string) {
+	r.explorerURLs[s.ID] = u
+}
+
+// SetEnvironments sets the names of the environments the API explorer of a specification can
+// target, the first being the default. It is called as the routes are registered.
+func (r *Renderer) SetEnvironments(s *spec.APISpecification, names []string) {
+	r.environments[s.ID] = names
+}
+
+// localURL prefixes a path of the portal with the path it is served under, leaving absolute URLs.
+func localURL(base, u string) string {
+	if strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "//") {
+		return base + u
+	}
+
+	return u
+}
+
+func selectedEnvironment(req *http.Request, names []string) string {
+	if req != nil {
+		if c, err := req.Cookie(EnvironmentCookie); err == nil {
+			for _, n := range names {
+				if n == c.Value {
+					return n
+				}
+			}
+		}
+	}
+
+	return names[0]
 }
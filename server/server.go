@@ -0,0 +1,246 @@
+// Package server runs the documentation service, draining it gracefully on SIGTERM or SIGINT,
+// and reloading its configuration on SIGHUP.
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/health"
+	"github.com/kenjones-cisco/dapperdox/logger"
+	"github.com/kenjones-cisco/dapperdox/metrics"
+	"github.com/kenjones-cisco/dapperdox/network"
+)
+
+// Builder creates the handler serving every request, from the current configuration.
+type Builder func() (http.Handler, error)
+
+// Server serves requests with the handler last built, so it can be rebuilt without dropping
+// connections. The health endpoints are served ahead of the handler, and the metrics on a listener
+// of their own, when one is configured.
+type Server struct {
+	build   Builder
+	srv     *http.Server
+	metrics *http.Server
+
+	mu      sync.RWMutex
+	handler http.Handler
+}
+
+// New returns the server for the handler the builder creates, with the configured timeouts. Until
+// the handler is built, requests are answered with a 503.
+func New(build Builder) *Server {
+	s := &Server{build: build, handler: http.HandlerFunc(starting)}
+	s.srv = &http.Server{
+		Handler:           health.Handler(s),
+		ReadTimeout:       viper.GetDuration(config.ServerReadTimeout),
+		ReadHeaderTimeout: viper.GetDuration(config.ServerReadHeaderTimeout),
+		WriteTimeout:      viper.GetDuration(config.ServerWriteTimeout),
+		IdleTimeout:       viper.GetDuration(config.ServerIdleTimeout),
+		MaxHeaderBytes:    viper.GetInt(config.ServerMaxHeaderBytes),
+	}
+
+	if addr := viper.GetString(config.MetricsAddr); addr != "" {
+		m := http.NewServeMux()
+		m.Handle(metrics.Path, metrics.Handler())
+
+		s.metrics = &http.Server{
+			Addr:              addr,
+			Handler:           m,
+			ReadHeaderTimeout: viper.GetDuration(config.ServerReadHeaderTimeout),
+		}
+	}
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	h := s.handler
+	s.mu.RUnlock()
+
+	h.ServeHTTP(w, r)
+}
+
+// Run serves connections from the listener and builds the handler, then serves until SIGTERM or
+// SIGINT, when it stops accepting connections and waits for the requests in progress, up to the
+// shutdown timeout. SIGHUP reloads the configuration.
+func (s *Server) Run(l net.Listener) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	defer signal.Stop(signals)
+
+	served := make(chan error, 2)
+
+	if s.metrics != nil {
+		ml, err := net.Listen("tcp", s.metrics.Addr)
+		if err != nil {
+			return fmt.Errorf("metrics: %w", err)
+		}
+
+		log().Infof("Serving metrics on %s", ml.Addr())
+
+		go func() {
+			served <- s.metrics.Serve(ml)
+		}()
+	}
+
+	go func() {
+		served <- s.srv.Serve(l)
+	}()
+
+	h, err := s.build()
+	metrics.ObserveReload(err == nil)
+
+	if err != nil {
+		health.SetReady(false, err.Error())
+
+		return err
+	}
+
+	s.setHandler(h)
+	health.SetReady(true, "")
+
+	for {
+		select {
+		case err := <-served:
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := s.Reload(); err != nil {
+					log().Errorf("Reload failed, keeping the current configuration: %s", err)
+				}
+
+				continue
+			}
+
+			return s.shutdown(sig)
+		}
+	}
+}
+
+func (s *Server) shutdown(sig os.Signal) error {
+	timeout := viper.GetDuration(config.ServerShutdownTimeout)
+	log().Infof("Received %s, shutting down within %s", sig, timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if s.metrics != nil {
+		_ = s.metrics.Shutdown(ctx)
+	}
+
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+
+	log().Info("Shutdown complete")
+
+	return nil
+}
+
+// Reload reads the configuration file and TLS certificate again, and builds a new handler, which
+// replaces the one served only once everything has been built. Should anything fail, the previous
+// configuration is restored and the current handler kept. Requests in progress complete with the
+// handler they started with. The server timeouts are only read at startup.
+func (s *Server) Reload() (err error) {
+	log().Info("Reloading configuration")
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+
+		metrics.ObserveReload(err == nil)
+	}()
+
+	restore, err := config.Reload()
+	if err != nil {
+		return err
+	}
+
+	h, err := s.apply()
+	if err != nil {
+		restore()
+
+		return err
+	}
+
+	closeHandler(s.setHandler(h))
+	log().Info("Configuration reloaded")
+
+	return nil
+}
+
+// apply builds the handler for the configuration read, and applies the logging and certificate
+// configured, closing the handler built should they fail.
+func (s *Server) apply() (h http.Handler, err error) {
+	h, err = s.build()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			closeHandler(h)
+		}
+	}()
+
+	if viper.GetString(config.TLSCert) != "" && viper.GetString(config.TLSKey) != "" {
+		if err := network.ReloadCertificate(); err != nil {
+			return nil, fmt.Errorf("certificate: %w", err)
+		}
+	}
+
+	if err := ConfigureLogging(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// ConfigureLogging applies the configured log level, format and output.
+func ConfigureLogging() error {
+	logger.SetLevel(viper.GetString(config.LogLevel))
+
+	if err := logger.SetFormat(viper.GetString(config.LogFormat)); err != nil {
+		return err
+	}
+
+	return logger.SetOutput(viper.GetString(config.LogFile), viper.GetInt(config.LogMaxSize), viper.GetInt(config.LogMaxBackups))
+}
+
+// setHandler serves new requests with the handler, returning the one served before.
+func (s *Server) setHandler(h http.Handler) http.Handler {
+	s.mu.Lock()
+	prev := s.handler
+	s.handler = h
+	s.mu.Unlock()
+
+	return prev
+}
+
+// closeHandler releases what a handler no longer served runs in the background.
+func closeHandler(h http.Handler) {
+	if c, ok := h.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log().Warnf("Closing the previous handler: %s", err)
+		}
+	}
+}
+
+func starting(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, "Starting, please try again shortly", http.StatusServiceUnavailable)
+}
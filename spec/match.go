@@ -0,0 +1,86 @@
+package spec
+
+import (
+	"strings"
+)
+
+// MatchMethod finds the documented method of the specification that serves the given
+// HTTP verb and request path, by matching the path against each method path template.
+// Literal path segments take precedence over templated ones, so /pets/mine is preferred
+// to /pets/{id}. The values of templated path segments are returned keyed by name.
+func (c *APISpecification) MatchMethod(verb, path string) (*Method, map[string]string) {
+	var (
+		best       *Method
+		bestParams map[string]string
+		bestScore  = -1
+	)
+
+	verb = strings.ToLower(verb)
+	segments := splitPath(path)
+
+	for i := range c.APIs {
+		api := c.APIs[i]
+
+		for j := range api.Methods {
+			method := api.Methods[j]
+
+			if method.Method != verb {
+				continue
+			}
+
+			params, score, ok := matchTemplate(splitPath(method.Path), segments)
+			if ok && score > bestScore {
+				best, bestParams, bestScore = method, params, score
+			}
+		}
+	}
+
+	return best, bestParams
+}
+
+// MatchMethod finds the documented method, across all specifications of the suite, that serves
+// the given HTTP verb and request path.
+func (s *Suite) MatchMethod(verb, path string) (*APISpecification, *Method, map[string]string) {
+	for _, specification := range s.Specs {
+		if method, params := specification.MatchMethod(verb, path); method != nil {
+			return specification, method, params
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// matchTemplate matches request path segments against path template segments, returning
+// the values of any templated segments and a score counting the literal segments matched.
+func matchTemplate(template, segments []string) (map[string]string, int, bool) {
+	if len(template) != len(segments) {
+		return nil, 0, false
+	}
+
+	params := make(map[string]string)
+	score := 0
+
+	for i, t := range template {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+
+			params[t[1:len(t)-1]] = segments[i]
+
+			continue
+		}
+
+		if t != segments[i] {
+			return nil, 0, false
+		}
+
+		score++
+	}
+
+	return params, score, true
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
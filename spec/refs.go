@@ -0,0 +1,96 @@
+package spec
+
+import (
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/gitsource"
+)
+
+// loadRef loads the specifications of a git ref into the suite, as a version of the APIs of the
+// specifications they share an ID with, or as specifications of a section of their own.
+func loadRef(ref *gitsource.Ref, suite map[string]*APISpecification, groups map[string][]*APISpecification) error {
+	for _, specLocation := range viper.GetStringSlice(config.SpecFilename) {
+		if !isLocalSpecURL(specLocation) {
+			log().Debugf("Not loading %s at git ref %s, as it is not local", specLocation, ref.Name)
+
+			continue
+		}
+
+		log().Infof("specLocation: %s at git ref %s", specLocation, ref.Name)
+
+		specification := &APISpecification{source: ref.Specs()}
+
+		if err := specification.load(specLocation); err != nil {
+			return err
+		}
+
+		if ref.Section == "" {
+			current, ok := suite[specification.ID]
+			if !ok {
+				log().Warnf("Not publishing %s at git ref %s as version %s, as %s is not published", specLocation, ref.Name, ref.Version, specification.ID)
+
+				continue
+			}
+
+			current.addVersion(ref.Version, specification)
+
+			continue
+		}
+
+		// A section has its own pages, and its specifications are served from beneath its name.
+		specification.Ref = ref
+		specification.ID += "-" + ref.Section
+		specification.APIInfo.Title += " (" + ref.Section + ")"
+		specification.URL = "/" + ref.Section + specification.URL
+
+		suite[specification.ID] = specification
+		groups[specification.GroupBy] = append(groups[specification.GroupBy], specification)
+	}
+
+	return nil
+}
+
+// addVersion publishes the APIs of another specification as a version of those of this one which
+// have the same ID.
+func (c *APISpecification) addVersion(version string, other *APISpecification) {
+	apis := make(map[string]*APIGroup, len(c.APIs))
+
+	for _, api := range c.APIs {
+		if api.CurrentVersion == version {
+			log().Errorf("Not publishing version %s of %s, as it is the current version", version, c.ID)
+
+			return
+		}
+
+		apis[api.ID] = api
+	}
+
+	for _, o := range other.APIs {
+		api, ok := apis[o.ID]
+		if !ok {
+			log().Debugf("Not publishing API %s of version %s, as the current version has no such API", o.ID, version)
+
+			continue
+		}
+
+		if api.Versions == nil {
+			api.Versions = map[string][]*Method{api.CurrentVersion: api.Methods}
+		}
+
+		api.Versions[version] = o.Methods
+	}
+
+	for _, resources := range other.ResourceList {
+		if c.ResourceList[version] == nil {
+			c.ResourceList[version] = make(map[string]*Resource)
+		}
+
+		for id, resource := range resources {
+			c.ResourceList[version][id] = resource
+		}
+	}
+
+	c.groupVersions()
+	c.indexMethods()
+}
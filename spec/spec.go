@@ -23,13 +23,16 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"net/url"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 
-	"github.com/go-openapi/loads"
 	"github.com/go-openapi/spec"
 	"github.com/go-openapi/swag"
 	"github.com/serenize/snaker"
@@ -37,6 +40,7 @@ import (
 
 	"github.com/kenjones-cisco/dapperdox/config"
 	"github.com/kenjones-cisco/dapperdox/formatter"
+	"github.com/kenjones-cisco/dapperdox/gitsource"
 )
 
 const (
@@ -58,6 +62,10 @@ const (
 	MethodResponse
 )
 
+// MapKey is the name of the property of a resource describing the additionalProperties of the
+// object, being the values of a map keyed by any name.
+const MapKey = "<key>"
+
 var kababExclude = regexp.MustCompile(`[^\w\s]`) // Any non word or space character
 
 var collectionTable = map[string]string{
@@ -76,11 +84,12 @@ var sortTypes = map[string]bool{
 	"summary":    true,
 }
 
-// APISuite holds multiple apis held by name.
-var APISuite map[string]*APISpecification
-
-// APISuiteGroups holds multiple apis sorted by groups.
-var APISuiteGroups map[string][]*APISpecification
+// Suite holds the specifications loaded, by ID and by group. A suite is not changed once loaded,
+// so the specifications are loaded into a new one when the configuration is reloaded.
+type Suite struct {
+	Specs  map[string]*APISpecification
+	Groups map[string][]*APISpecification
+}
 
 // APISpecification holds the content of a parsed api.
 type APISpecification struct {
@@ -89,15 +98,21 @@ type APISpecification struct {
 	APIInfo Info
 	URL     string
 	GroupBy string
+	Ref     *gitsource.Ref // Git ref it is published from as a section, or nil
+
+	source fs.FS // Where local specifications are read from
 
 	SecurityDefinitions map[string]SecurityScheme
 	DefaultSecurity     map[string]Security
 	ResourceList        map[string]map[string]*Resource // Version->ResourceName->Resource
 	APIVersions         map[string]APISet               // Version->APISet
+
+	methods   map[string]map[string]*Method // API ID/method ID->Version->Method
+	resources sync.Mutex                    // Guards ResourceList and the schemas of the document while tags are processed
 }
 
 // APISet list of grouped APIs.
-type APISet []APIGroup
+type APISet []*APIGroup
 
 // APIGroup parents all grouped API methods (Grouping controlled by tagging, if used, or by method path otherwise).
 type APIGroup struct {
@@ -106,9 +121,9 @@ type APIGroup struct {
 	URL                    *url.URL
 	MethodNavigationByName bool
 	MethodSortBy           []string
-	Versions               map[string][]Method // All versions, keyed by version string.
-	Methods                []Method            // The current version
-	CurrentVersion         string              // The latest version in operation for the API
+	Versions               map[string][]*Method // All versions, keyed by version string.
+	Methods                []*Method            // The current version
+	CurrentVersion         string               // The latest version in operation for the API
 	Info                   *Info
 	Consumes               []string
 	Produces               []string
@@ -123,7 +138,7 @@ type Info struct {
 // Version holds version to list of associated method.
 type Version struct {
 	Version string
-	Methods []Method
+	Methods []*Method
 }
 
 // OAuth2Scheme is a specific security scheme.
@@ -196,6 +211,7 @@ type Response struct {
 	StatusDescription string
 	Resource          *Resource
 	Headers           []Header
+	Examples          map[string]string // Response examples, keyed by MIME type
 	IsArray           bool
 }
 
@@ -209,7 +225,6 @@ type Resource struct {
 	Title                 string
 	Description           string
 	Example               string
-	Schema                string
 	Type                  []string // Will contain two elements if an array or map [0]=array [1]=What type is in the array
 	Properties            map[string]*Resource
 	Required              bool
@@ -218,6 +233,15 @@ type Resource struct {
 	Methods               map[string]*Method
 	Enum                  []string
 	origin                ResourceOrigin
+	schema                *schemaExample
+}
+
+// schemaExample is the JSON representation of a resource, serialised when it is first shown.
+type schemaExample struct {
+	once    sync.Once
+	rep     map[string]interface{}
+	isArray bool
+	text    string
 }
 
 // Header represents an API parameter.
@@ -233,25 +257,33 @@ type Header struct {
 }
 
 // SortMethods implements sortable array of method.
-type SortMethods []Method
+type SortMethods []*Method
 
 func (a SortMethods) Len() int           { return len(a) }
 func (a SortMethods) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a SortMethods) Less(i, j int) bool { return a[i].SortKey < a[j].SortKey }
 
-// LoadSpecifications loads the provided api specifications.
-func LoadSpecifications() error {
-	loadStatusCodes()
+// LoadSpecifications loads the provided api specifications, reading local specifications from the
+// spec-dir of the source given, and those of its git refs.
+func LoadSpecifications(src *gitsource.Source) (*Suite, error) {
+	loadStatusCodes(src.Open)
 	loadReplacer()
 
-	if APISuite == nil {
-		APISuite = make(map[string]*APISpecification)
-		APISuiteGroups = make(map[string][]*APISpecification)
+	suite := &Suite{
+		Specs:  make(map[string]*APISpecification),
+		Groups: make(map[string][]*APISpecification),
 	}
 
-	log().Infof("configured spec filenames: %v", viper.GetStringSlice(config.SpecFilename))
+	locations := viper.GetStringSlice(config.SpecFilename)
+
+	log().Infof("configured spec filenames: %v", locations)
+
+	local, err := openLocal(src, locations)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, specLocation := range viper.GetStringSlice(config.SpecFilename) {
+	for _, specLocation := range locations {
 		log().Infof("specLocation: %s", specLocation)
 
 		var (
@@ -259,45 +291,64 @@ func LoadSpecifications() error {
 			specification *APISpecification
 		)
 
-		if specification, ok = APISuite[""]; !ok {
-			specification = &APISpecification{}
+		if specification, ok = suite.Specs[""]; !ok {
+			specification = &APISpecification{source: local}
 		}
 
 		if err := specification.load(specLocation); err != nil {
-			return err
+			return nil, err
 		}
 
-		APISuite[specification.ID] = specification
+		suite.Specs[specification.ID] = specification
 
-		if _, exists := APISuiteGroups[specification.GroupBy]; !exists {
-			APISuiteGroups[specification.GroupBy] = make([]*APISpecification, 0)
+		if _, exists := suite.Groups[specification.GroupBy]; !exists {
+			suite.Groups[specification.GroupBy] = make([]*APISpecification, 0)
 		}
 
-		APISuiteGroups[specification.GroupBy] = append(APISuiteGroups[specification.GroupBy], specification)
+		suite.Groups[specification.GroupBy] = append(suite.Groups[specification.GroupBy], specification)
 	}
 
-	return nil
+	for _, ref := range src.Refs() {
+		if err := loadRef(ref, suite.Specs, suite.Groups); err != nil {
+			return nil, err
+		}
+	}
+
+	return suite, nil
+}
+
+// openLocal opens the spec-dir of the source, when any of the specification locations is local.
+func openLocal(src *gitsource.Source, locations []string) (fs.FS, error) {
+	for _, location := range locations {
+		if isLocalSpecURL(location) {
+			dir := viper.GetString(config.SpecDir)
+			if dir == "" {
+				dir = "."
+			}
+
+			return src.Open(dir)
+		}
+	}
+
+	return nil, nil
 }
 
 func (c *APISpecification) load(specLocation string) error {
-	document, err := loadSpec(normalizeSpecLocation(specLocation))
+	apispec, err := loadSpec(c.source, specLocation)
 	if err != nil {
 		return err
 	}
 
-	apispec := document.Spec()
-
 	if isLocalSpecURL(specLocation) && !strings.HasPrefix(specLocation, "/") {
 		specLocation = "/" + specLocation
 	}
 
 	c.URL = specLocation
 
-	basePath := apispec.BasePath
-	basePathLen := len(basePath)
 	// Ignore basepath if it is a single '/'
-	if basePathLen == 1 && basePath[0] == '/' {
-		basePathLen = 0
+	basePath := apispec.BasePath
+	if basePath == "/" {
+		basePath = ""
 	}
 
 	scheme := "http"
@@ -353,116 +404,254 @@ func (c *APISpecification) load(specLocation string) error {
 		}
 	}
 
-	// Use the top level TAGS to order the API resources/endpoints
-	// If Tags: [] is not defined, or empty, then no filtering or ordering takes place,
-	// and all API paths will be documented..
-	for _, tag := range getTags(apispec) {
-		log().Trace("  In tag loop...")
-		// Tag matching may not be as expected if multiple paths have the same TAG (which is technically permitted)
-		var (
-			ok  bool
-			api *APIGroup
-		)
+	proto := APIGroup{
+		URL:                    u,
+		Info:                   &c.APIInfo,
+		MethodNavigationByName: methodNavByName,
+		MethodSortBy:           methodSortBy,
+		Consumes:               apispec.Consumes,
+		Produces:               apispec.Produces,
+	}
 
-		groupingByTag := false
-		if tag.Name != "" {
-			groupingByTag = true
-		}
+	if c.ResourceList == nil {
+		c.ResourceList = make(map[string]map[string]*Resource)
+	}
 
-		// Will only populate if Tagging used in spec. processMethod overrides if needed.
-		name := tag.Description
-		if name == "" {
-			name = tag.Name
+	var paths map[string]spec.PathItem
+	if apispec.Paths != nil {
+		paths = apispec.Paths.Paths
+	}
+	sources := groupSources(getTags(apispec), paths)
+
+	// The groups are independent of each other, so are built in parallel, then added in order.
+	apis := make([]*APIGroup, len(sources))
+
+	inParallel(len(sources), func(i int) {
+		apis[i] = c.buildGroup(sources[i], proto, paths, basePath)
+	})
+
+	for _, api := range apis {
+		if api != nil {
+			c.APIs = append(c.APIs, api) // All APIs (versioned within)
 		}
+	}
+
+	c.groupVersions()
+	c.indexMethods()
 
-		log().Tracef("    - %s", name)
-
-		// If we're grouping by TAGs, then build the API at the tag level
-		if groupingByTag {
-			api = &APIGroup{
-				ID:                     titleToKebab(name),
-				Name:                   name,
-				URL:                    u,
-				Info:                   &c.APIInfo,
-				MethodNavigationByName: methodNavByName,
-				MethodSortBy:           methodSortBy,
-				Consumes:               apispec.Consumes,
-				Produces:               apispec.Produces,
+	return nil
+}
+
+// groupVersions builds the API map, grouping by version.
+func (c *APISpecification) groupVersions() {
+	c.APIVersions = nil
+
+	for _, api := range c.APIs {
+		for v, methods := range api.Versions {
+			if c.APIVersions == nil {
+				c.APIVersions = make(map[string]APISet)
 			}
+			// Create copy of API sharing the methods of the version we are building
+			napi := *api
+			napi.Methods = methods
+			napi.Versions = nil
+			c.APIVersions[v] = append(c.APIVersions[v], &napi) // Group APIs by version
 		}
+	}
+}
 
-		for path, pathItem := range document.Analyzer.AllPaths() {
-			log().Trace("    In path loop...")
+// groupSource is what an API group is built from: a tag, and the paths holding its operations.
+type groupSource struct {
+	tag   spec.Tag
+	paths []string
+}
 
-			if isPrivate(pathItem.Extensions) {
-				log().Debugf("%s all operations private", basePath+path)
+// groupSources returns the sources of the API groups of the tags.
+//
+// Use the top level TAGS to order the API resources/endpoints
+// If Tags: [] is not defined, or empty, then no filtering or ordering takes place,
+// and all API paths will be documented, each path in a group of its own.
+func groupSources(tags []spec.Tag, paths map[string]spec.PathItem) []groupSource {
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
 
-				continue
-			}
+	sort.Strings(names)
 
-			if basePathLen > 0 {
-				path = basePath + path
-			}
+	// Index the paths by the tags of their operations, rather than scanning every path for each tag.
+	tagged := make(map[string][]string)
+
+	for _, path := range names {
+		pi := paths[path]
+		seen := make(map[string]bool)
 
-			// If not grouping by tag, then build the API at the path level
-			if !groupingByTag {
-				api = &APIGroup{
-					ID:                     titleToKebab(name),
-					Name:                   name,
-					URL:                    u,
-					Info:                   &c.APIInfo,
-					MethodNavigationByName: methodNavByName,
-					MethodSortBy:           methodSortBy,
-					Consumes:               apispec.Consumes,
-					Produces:               apispec.Produces,
+		for _, o := range pathOperations(&pi) {
+			for _, t := range o.Tags {
+				if !seen[t] {
+					seen[t] = true
+					tagged[t] = append(tagged[t], path)
 				}
 			}
+		}
+	}
 
-			var ver string
-			if ver, ok = pathItem.Extensions[versionExt].(string); !ok {
-				ver = "latest"
-			}
+	var sources []groupSource
 
-			api.CurrentVersion = ver
+	for _, tag := range tags {
+		// Tag matching may not be as expected if multiple paths have the same TAG (which is technically permitted)
+		if tag.Name != "" {
+			sources = append(sources, groupSource{tag: tag, paths: tagged[tag.Name]})
 
-			pi := pathItem
-			c.getMethods(tag, api, &api.Methods, &pi, path, ver) // Current version
+			continue
+		}
 
-			// If API was populated (will not be if tags do not match), add to set
-			if !groupingByTag && len(api.Methods) > 0 {
-				log().Tracef("    + Adding %s", name)
+		// If not grouping by tag, then build the API at the path level
+		for _, path := range names {
+			sources = append(sources, groupSource{tag: tag, paths: []string{path}})
+		}
+	}
 
-				sort.Sort(SortMethods(api.Methods))
-				c.APIs = append(c.APIs, *api) // All APIs (versioned within)
-			}
+	return sources
+}
+
+// buildGroup builds the API group of the operations of a source, or returns nil when it has none.
+func (c *APISpecification) buildGroup(src groupSource, proto APIGroup, paths map[string]spec.PathItem, basePath string) *APIGroup {
+	// Will only populate if Tagging used in spec. processMethod overrides if needed.
+	name := src.tag.Description
+	if name == "" {
+		name = src.tag.Name
+	}
+
+	log().Tracef("    - %s", name)
+
+	api := &proto
+	api.ID = titleToKebab(name)
+	api.Name = name
+
+	for _, path := range src.paths {
+		pathItem := paths[path]
+
+		if isPrivate(pathItem.Extensions) {
+			log().Debugf("%s all operations private", basePath+path)
+
+			continue
 		}
 
-		if groupingByTag && len(api.Methods) > 0 {
-			log().Tracef("    + Adding %s", name)
+		ver, ok := pathItem.Extensions[versionExt].(string)
+		if !ok {
+			ver = "latest"
+		}
 
-			sort.Sort(SortMethods(api.Methods))
-			c.APIs = append(c.APIs, *api) // All APIs (versioned within)
+		api.CurrentVersion = ver
+
+		c.getMethods(src.tag, api, &api.Methods, &pathItem, basePath+path, ver) // Current version
+	}
+
+	// If API was populated (will not be if tags do not match), add to set
+	if len(api.Methods) == 0 {
+		return nil
+	}
+
+	log().Tracef("    + Adding %s", name)
+
+	sort.Sort(SortMethods(api.Methods))
+
+	return api
+}
+
+// indexMethods indexes the methods of every API by version, so each is found without a copy of it
+// being kept for its page.
+func (c *APISpecification) indexMethods() {
+	c.methods = make(map[string]map[string]*Method)
+
+	add := func(api *APIGroup, version string, methods []*Method) {
+		for _, method := range methods {
+			key := api.ID + "/" + method.ID
+
+			if _, ok := c.methods[key]; !ok {
+				c.methods[key] = make(map[string]*Method)
+			}
+
+			c.methods[key][version] = method
 		}
 	}
 
-	// Build a API map, grouping by version
 	for _, api := range c.APIs {
-		for v := range api.Versions {
-			if c.APIVersions == nil {
-				c.APIVersions = make(map[string]APISet)
+		add(api, api.CurrentVersion, api.Methods)
+
+		for version, methods := range api.Versions {
+			add(api, version, methods)
+		}
+	}
+}
+
+// MethodVersions returns the versions of a method of an API, keyed by version.
+func (c *APISpecification) MethodVersions(apiID, methodID string) map[string]*Method {
+	return c.methods[apiID+"/"+methodID]
+}
+
+// inParallel calls fn with each index up to n, on as many goroutines as there are processors. A
+// panic, with which a malformed specification is reported, is raised again once all calls return.
+func inParallel(n int, fn func(i int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		failure  interface{}
+		indexes  = make(chan int)
+		recovers = func() {
+			if r := recover(); r != nil {
+				once.Do(func() { failure = r })
 			}
-			// Create copy of API and set Methods array to be correct for the version we are building
-			napi := api
-			napi.Methods = napi.Versions[v]
-			napi.Versions = nil
-			c.APIVersions[v] = append(c.APIVersions[v], napi) // Group APIs by version
 		}
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				func() {
+					defer recovers()
+					fn(i)
+				}()
+			}
+		}()
 	}
 
-	return nil
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	if failure != nil {
+		panic(failure)
+	}
 }
 
-func (c *APISpecification) getMethods(tag spec.Tag, api *APIGroup, methods *[]Method, pi *spec.PathItem, path, version string) {
+// pathOperations returns the operations of a path.
+func pathOperations(pi *spec.PathItem) []*spec.Operation {
+	var ops []*spec.Operation
+
+	for _, o := range []*spec.Operation{pi.Get, pi.Post, pi.Put, pi.Delete, pi.Head, pi.Options, pi.Patch} {
+		if o != nil {
+			ops = append(ops, o)
+		}
+	}
+
+	return ops
+}
+
+func (c *APISpecification) getMethods(tag spec.Tag, api *APIGroup, methods *[]*Method, pi *spec.PathItem, path, version string) {
 	c.getMethod(tag, api, methods, version, pi, pi.Get, path, "get")
 	c.getMethod(tag, api, methods, version, pi, pi.Post, path, "post")
 	c.getMethod(tag, api, methods, version, pi, pi.Put, path, "put")
@@ -472,7 +661,7 @@ func (c *APISpecification) getMethods(tag spec.Tag, api *APIGroup, methods *[]Me
 	c.getMethod(tag, api, methods, version, pi, pi.Patch, path, "patch")
 }
 
-func (c *APISpecification) getMethod(tag spec.Tag, api *APIGroup, methods *[]Method, version string, pathitem *spec.PathItem, operation *spec.Operation, path, methodname string) {
+func (c *APISpecification) getMethod(tag spec.Tag, api *APIGroup, methods *[]*Method, version string, pathitem *spec.PathItem, operation *spec.Operation, path, methodname string) {
 	if operation == nil {
 		log().Tracef("Skipping %s %s - Operation is nil.", path, methodname)
 
@@ -497,14 +686,14 @@ func (c *APISpecification) getMethod(tag spec.Tag, api *APIGroup, methods *[]Met
 		}
 
 		method := c.processMethod(api, pathitem, operation, path, methodname, version)
-		*methods = append(*methods, *method)
+		*methods = append(*methods, method)
 	} else {
 		log().Trace("    > Check tags")
 		for _, t := range operation.Tags {
 			log().Tracef("      - Compare tag %q with %q", tag.Name, t)
 			if tag.Name == "" || t == tag.Name {
 				method := c.processMethod(api, pathitem, operation, path, methodname, version)
-				*methods = append(*methods, *method)
+				*methods = append(*methods, method)
 			}
 		}
 	}
@@ -631,10 +820,6 @@ func (c *APISpecification) processMethod(api *APIGroup, pathItem *spec.PathItem,
 		api.ID = titleToKebab(name)
 	}
 
-	if c.ResourceList == nil {
-		c.ResourceList = make(map[string]map[string]*Resource)
-	}
-
 	c.processParameters(pathItem.Parameters, method, version)
 
 	c.processParameters(o.Parameters, method, version)
@@ -647,14 +832,6 @@ func (c *APISpecification) processMethod(api *APIGroup, pathItem *spec.PathItem,
 	for status, response := range o.Responses.StatusCodeResponses {
 		log().Tracef("Response for status %d", status)
 
-		// Discover if the resource is already declared, and pick it up
-		// if it is (keyed on version number)
-		if response.Schema != nil {
-			if _, ok := c.ResourceList[version]; !ok {
-				c.ResourceList[version] = make(map[string]*Resource)
-			}
-		}
-
 		r := response
 		rsp := c.buildResponse(&r, method, version)
 		rsp.StatusDescription = httpStatusDescription(status)
@@ -696,12 +873,8 @@ func (c *APISpecification) processParameters(params []spec.Parameter, method *Me
 				log().Panicf("Error: 'in body' parameter %s is missing a schema declaration.", param.Name)
 			}
 
-			var body map[string]interface{}
-			p.Resource, body, p.IsArray = c.resourceFromSchema(param.Schema, method, nil, true)
-			p.Resource.Schema = jsonResourceToString(body, p.IsArray)
-			p.Resource.origin = RequestBody
+			p.Resource, _, p.IsArray = c.buildResource(param.Schema, method, version, RequestBody)
 			method.BodyParam = &p
-			c.crossLinkMethodAndResource(p.Resource, method, version)
 		case "header":
 			method.HeaderParams = append(method.HeaderParams, p)
 		case "query":
@@ -715,20 +888,12 @@ func (c *APISpecification) buildResponse(resp *spec.Response, method *Method, ve
 
 	if resp != nil {
 		var (
-			vres        *Resource
-			r           *Resource
-			isArray     bool
-			exampleJSON map[string]interface{}
+			vres    *Resource
+			isArray bool
 		)
 
 		if resp.Schema != nil {
-			r, exampleJSON, isArray = c.resourceFromSchema(resp.Schema, method, nil, false)
-
-			if r != nil {
-				r.Schema = jsonResourceToString(exampleJSON, false)
-				r.origin = MethodResponse
-				vres = c.crossLinkMethodAndResource(r, method, version)
-			}
+			_, vres, isArray = c.buildResource(resp.Schema, method, version, MethodResponse)
 		}
 
 		response = &Response{
@@ -739,11 +904,34 @@ func (c *APISpecification) buildResponse(resp *spec.Response, method *Method, ve
 		method.Resources = append(method.Resources, response.Resource) // Add the resource to the method which uses it
 
 		response.compileHeaders(resp)
+		response.compileExamples(resp)
 	}
 
 	return response
 }
 
+// buildResource builds the resource of a request body or response schema of a method, returning it
+// and the resource listed for the specification it is linked with. Building a resource amends the
+// schemas of the document, so resources are built one at a time.
+func (c *APISpecification) buildResource(s *spec.Schema, method *Method, version string, origin ResourceOrigin) (*Resource, *Resource, bool) {
+	c.resources.Lock()
+	defer c.resources.Unlock()
+
+	r, rep, isArray := c.resourceFromSchema(s, method, nil, origin == RequestBody)
+	if r == nil {
+		return nil, nil, false
+	}
+
+	r.schema = &schemaExample{rep: rep}
+	if origin == RequestBody {
+		r.schema.isArray = isArray
+	}
+
+	r.origin = origin
+
+	return r, c.crossLinkMethodAndResource(r, method, version), isArray
+}
+
 func (c *APISpecification) crossLinkMethodAndResource(resource *Resource, method *Method, version string) *Resource {
 	log().Tracef("++ Resource version %s  ID %s", version, resource.ID)
 
@@ -1030,7 +1218,7 @@ func (c *APISpecification) compileproperties(s *spec.Schema, r *Resource, method
 	// Special case to deal with AdditionalProperties (which really just boils down to declaring a
 	// map of 'type' (string, int, object etc).
 	if s.AdditionalProperties != nil && s.AdditionalProperties.Allows {
-		name := "<key>"
+		name := MapKey
 		ap := s.AdditionalProperties.Schema
 
 		if len(ap.Type) == 0 {
@@ -1230,6 +1418,23 @@ func (r *Response) compileHeaders(sr *spec.Response) {
 	}
 }
 
+func (r *Response) compileExamples(sr *spec.Response) {
+	for mime, ex := range sr.Examples {
+		example, err := jsonMarshalIndent(ex)
+		if err != nil {
+			log().Errorf("Error encoding %s response example: %s", mime, err)
+
+			continue
+		}
+
+		if r.Examples == nil {
+			r.Examples = make(map[string]string)
+		}
+
+		r.Examples[mime] = string(example)
+	}
+}
+
 func (api *APIGroup) getMethodSortKey(path, method, operation, navigation, summary string) string {
 	// Handle a list of sort-by values, so that ordering can be fixed.
 	// Sorting by path alone does not work because ordering changes around GET/POST/PUT Etc
@@ -1285,6 +1490,20 @@ func jsonResourceToString(jsonres map[string]interface{}, isArray bool) string {
 	return string(example)
 }
 
+// Schema returns the JSON representation of the resource, serialising it when first asked for.
+func (r *Resource) Schema() string {
+	if r.schema == nil {
+		return ""
+	}
+
+	r.schema.once.Do(func() {
+		r.schema.text = jsonResourceToString(r.schema.rep, r.schema.isArray)
+		r.schema.rep = nil
+	})
+
+	return r.schema.text
+}
+
 func checkPropertyType(s *spec.Schema) string {
 	/*
 	   (string) (len=12) "string_array": (spec.Schema) {
@@ -1360,29 +1579,59 @@ func camelToKebab(s string) string {
 	return strings.ReplaceAll(snaker.CamelToSnake(s), "_", "-")
 }
 
-func loadSpec(location string) (*loads.Document, error) {
+// loadSpec loads and expands the specification at the location. The specification is parsed once,
+// as the documentation is built from the expanded specification alone.
+func loadSpec(fsys fs.FS, location string) (*spec.Swagger, error) {
 	log().Infof("Importing OpenAPI specifications from %s", location)
 
-	raw, err := swag.LoadFromFileOrHTTP(location)
+	raw, err := readSpec(fsys, location)
 	if err != nil {
 		log().Errorf("Error: go-openapi/swag failed to load spec [%s]: %s", location, err)
 
 		return nil, err
 	}
 
-	document, err := loads.Analyzed(json.RawMessage(replace(raw)), "")
+	raw, err = toJSON(replace(raw))
 	if err != nil {
-		log().Errorf("Error: go-openapi/loads failed to analyze spec: %s", err)
+		log().Errorf("Error: failed to convert spec [%s] to JSON: %s", location, err)
 
 		return nil, err
 	}
 
-	document, err = document.Expanded()
+	apispec := new(spec.Swagger)
+	if err = json.Unmarshal(raw, apispec); err != nil {
+		log().Errorf("Error: go-openapi/spec failed to parse spec: %s", err)
+
+		return nil, err
+	}
+
+	opts := &spec.ExpandOptions{RelativeBase: location, PathLoader: refLoader(fsys, location)}
+	if isLocalSpecURL(location) {
+		opts.RelativeBase = path.Clean("/" + location)
+	}
+
+	if err = spec.ExpandSpec(apispec, opts); err != nil {
+		log().Errorf("Error: go-openapi/spec failed to expand spec: %s", err)
+
+		return nil, err
+	}
+
+	return apispec, nil
+}
+
+// toJSON returns a specification written in YAML as JSON.
+func toJSON(raw []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] == '{' || trimmed[0] == '[' {
+		return trimmed, nil
+	}
+
+	doc, err := swag.BytesToYAMLDoc(trimmed)
 	if err != nil {
-		log().Errorf("Error: go-openapi/loads failed to expand spec: %s", err)
+		return nil, err
 	}
 
-	return document, err
+	return swag.YAMLToJSON(doc)
 }
 
 // jsonMarshalIndent Wrapper around MarshalIndent to prevent < > & from being escaped.
@@ -1405,22 +1654,39 @@ func isLocalSpecURL(specURL string) bool {
 	return !match
 }
 
-func normalizeSpecLocation(specLocation string) string {
-	if isLocalSpecURL(specLocation) {
-		log().Debugf("SpecDir = %s", viper.GetString(config.SpecDir))
+// readSpec reads a specification from its URL, or from the file system given when it is local.
+func readSpec(fsys fs.FS, location string) ([]byte, error) {
+	if !isLocalSpecURL(location) {
+		return swag.LoadFromFileOrHTTP(location)
+	}
+
+	return fs.ReadFile(fsys, strings.TrimPrefix(path.Clean("/"+location), "/"))
+}
+
+// refLoader returns the loader of the documents the external $refs of the specification at the
+// location point to. The refs of a local specification are read from the file system it was read from,
+// relative to it, while a remote specification may only refer to remote documents.
+func refLoader(fsys fs.FS, location string) func(string) (json.RawMessage, error) {
+	return func(ref string) (json.RawMessage, error) {
+		if !isLocalSpecURL(ref) {
+			raw, err := swag.LoadFromFileOrHTTP(ref)
 
-		base, err := filepath.Abs(viper.GetString(config.SpecDir))
+			return raw, err
+		}
+
+		if fsys == nil || !isLocalSpecURL(location) {
+			return nil, fmt.Errorf("external $ref %s of remote specification %s is not remote", ref, location)
+		}
+
+		raw, err := readSpec(fsys, filepath.ToSlash(ref))
 		if err != nil {
-			log().Errorf("Error forming specification path: %s", err)
+			return nil, err
 		}
 
-		base = filepath.ToSlash(base)
-		log().Debugf("SpecDir (base) = %s", base)
+		raw, err = toJSON(replace(raw))
 
-		return filepath.Join(base, specLocation)
+		return raw, err
 	}
-
-	return specLocation
 }
 
 // OpenAPI/Swagger/go-openAPI define a Header object and an Items object. A
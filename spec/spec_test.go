@@ -1,11 +1,20 @@
 package spec
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/spf13/viper"
 
 	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/spec/spectest"
+	"github.com/kenjones-cisco/dapperdox/vfs"
 )
 
 const testSpecDir = "../fixtures/"
@@ -39,9 +48,222 @@ func TestLoadSpecifications(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			viper.Set(config.SpecFilename, tt.specLoc)
 
-			if err := LoadSpecifications(); (err != nil) != tt.wantErr {
+			if _, err := LoadSpecifications(nil); (err != nil) != tt.wantErr {
 				t.Errorf("LoadSpecifications() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestMatchMethod(t *testing.T) {
+	config.Restore()
+	viper.Set(config.SpecDir, testSpecDir)
+	viper.Set(config.SpecFilename, "common_api.json")
+
+	suite, err := LoadSpecifications(nil)
+	if err != nil {
+		t.Fatalf("LoadSpecifications() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		verb       string
+		path       string
+		wantID     string
+		wantParams map[string]string
+	}{
+		{
+			name:   "success - literal path",
+			verb:   "GET",
+			path:   "/v1/aws/accounts",
+			wantID: "list-accounts",
+		},
+		{
+			name:       "success - templated path",
+			verb:       "PATCH",
+			path:       "/v1/aws/accounts/1234",
+			wantID:     "update-account",
+			wantParams: map[string]string{"accountId": "1234"},
+		},
+		{
+			name: "failure - unknown verb",
+			verb: "PUT",
+			path: "/v1/aws/accounts",
+		},
+		{
+			name: "failure - unknown path",
+			verb: "GET",
+			path: "/v1/aws/accounts/1234/users",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, method, params := suite.MatchMethod(tt.verb, tt.path)
+
+			if tt.wantID == "" {
+				if method != nil {
+					t.Errorf("MatchMethod() = %v, want nil", method.ID)
+				}
+
+				return
+			}
+
+			if method == nil || method.ID != tt.wantID {
+				t.Fatalf("MatchMethod() = %v, want %v", method, tt.wantID)
+			}
+
+			for k, v := range tt.wantParams {
+				if params[k] != v {
+					t.Errorf("MatchMethod() param %s = %v, want %v", k, params[k], v)
+				}
+			}
+		})
+	}
+}
+
+// largeOperations is the number of operations of the large specification loaded.
+const largeOperations = 5000
+
+// loadBudget is the time and memory the large specification is to be loaded within.
+var loadBudget = spectest.Budget{Time: 15 * time.Second, Alloc: 2 << 30, Retained: 64 << 20}
+
+func loadLarge(tb testing.TB) {
+	tb.Helper()
+
+	config.Restore()
+
+	dir := tb.TempDir()
+
+	name, err := spectest.WriteLarge(dir, largeOperations)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	viper.Set(config.SpecDir, dir)
+	viper.Set(config.SpecFilename, name)
+}
+
+func TestLoadLargeSpecification(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping loading a large specification in short mode")
+	}
+
+	loadLarge(t)
+
+	suite, err := LoadSpecifications(nil)
+	if err != nil {
+		t.Fatalf("LoadSpecifications() error = %v", err)
+	}
+
+	for _, s := range suite.Specs {
+		if got, want := len(s.APIs), largeOperations/spectest.GroupSize; got != want {
+			t.Errorf("len(APIs) = %d, want %d", got, want)
+		}
+
+		n := 0
+
+		for _, api := range s.APIs {
+			for _, method := range api.Methods {
+				n++
+
+				if method.APIGroup != api {
+					t.Fatalf("method %s is not of its API %s", method.ID, api.ID)
+				}
+
+				if s.MethodVersions(api.ID, method.ID)[api.CurrentVersion] != method {
+					t.Fatalf("MethodVersions(%q, %q) does not hold the method", api.ID, method.ID)
+				}
+			}
+		}
+
+		if n != largeOperations {
+			t.Errorf("operations = %d, want %d", n, largeOperations)
+		}
+	}
+}
+
+func BenchmarkLoadSpecifications(b *testing.B) {
+	loadLarge(b)
+
+	loadBudget.Run(b, func() interface{} {
+		suite, err := LoadSpecifications(nil)
+		if err != nil {
+			b.Fatalf("LoadSpecifications() error = %v", err)
+		}
+
+		return suite
+	})
+}
+
+func TestLoadSpecificationsFromSource(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join(testSpecDir, "common_api.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vfs.Mount("specs", fstest.MapFS{"apis/common.json": &fstest.MapFile{Data: b}})
+	defer vfs.Unmount("specs")
+
+	config.Restore()
+	viper.Set(config.SpecDir, "specs")
+	viper.Set(config.SpecFilename, "apis/common.json")
+
+	suite, err := LoadSpecifications(nil)
+	if err != nil {
+		t.Fatalf("LoadSpecifications() error = %v", err)
+	}
+
+	if len(suite.Specs) != 1 {
+		t.Errorf("LoadSpecifications() loaded %d specifications, want 1", len(suite.Specs))
+	}
+}
+
+func TestLoadSpecExternalRefs(t *testing.T) {
+	const pets = `{
+  "swagger": "2.0",
+  "info": {"title": "Pets", "version": "1"},
+  "paths": {"/pets": {"get": {"responses": {"200": {"description": "pets", "schema": {"$ref": "%s"}}}}}}
+}`
+
+	fsys := fstest.MapFS{
+		"apis/pets.json":          &fstest.MapFile{Data: []byte(fmt.Sprintf(pets, "defs/pet.yaml#/definitions/Pet"))},
+		"apis/escape.json":        &fstest.MapFile{Data: []byte(fmt.Sprintf(pets, "../../../etc/passwd#/definitions/Pet"))},
+		"apis/defs/pet.yaml":      &fstest.MapFile{Data: []byte("definitions:\n  Pet:\n    type: object\n    properties:\n      name: {type: string}\n")},
+		"apis/defs/unrelated.txt": &fstest.MapFile{Data: []byte("not a specification")},
+	}
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, pets, "/apis/defs/pet.yaml#/definitions/Pet")
+	}))
+	defer remote.Close()
+
+	config.Restore()
+	loadReplacer()
+
+	tests := []struct {
+		name     string
+		location string
+		wantErr  bool
+	}{
+		{name: "relative to the specification", location: "apis/pets.json"},
+		{name: "outside the source", location: "apis/escape.json", wantErr: true},
+		{name: "local to a remote specification", location: remote.URL + "/pets.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := loadSpec(fsys, tt.location)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadSpec() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			schema := s.Paths.Paths["/pets"].Get.Responses.StatusCodeResponses[200].Schema
+			if _, ok := schema.Properties["name"]; !ok {
+				t.Errorf("schema = %+v, want the Pet definition of the external document", schema)
+			}
+		})
+	}
+}
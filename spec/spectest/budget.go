@@ -0,0 +1,74 @@
+package spectest
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// raceFactor is how much slower code runs with the race detector enabled.
+const raceFactor = 10
+
+// Budget is the time and memory an operation on a large specification is to be done within. A zero
+// limit is not checked. Budgets are checked by benchmarks, so tests do not depend on the speed of the
+// machine they run on.
+type Budget struct {
+	Time     time.Duration // Time taken
+	Alloc    uint64        // Bytes allocated
+	Retained uint64        // Bytes still held by the result
+}
+
+// Run runs the operation b.N times, failing the benchmark when it takes more time or memory on average
+// than budgeted. The result of the operation is kept until it has been measured. The time budget is
+// relaxed when the race detector is enabled.
+func (bg Budget) Run(b *testing.B, op func() interface{}) {
+	b.Helper()
+	b.ReportAllocs()
+
+	var (
+		before, after runtime.MemStats
+		result        interface{}
+	)
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+
+	start := time.Now()
+
+	for i := 0; i < b.N; i++ {
+		result = nil
+		result = op()
+	}
+
+	elapsed := time.Since(start) / time.Duration(b.N)
+
+	b.StopTimer()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(result)
+
+	alloc := (after.TotalAlloc - before.TotalAlloc) / uint64(b.N)
+
+	var retained uint64
+	if after.HeapAlloc > before.HeapAlloc {
+		retained = after.HeapAlloc - before.HeapAlloc
+	}
+
+	limit := bg.Time
+	if raceEnabled {
+		limit *= raceFactor
+	}
+
+	if limit > 0 && elapsed > limit {
+		b.Errorf("took %v, over its budget of %v", elapsed, limit)
+	}
+
+	if bg.Alloc > 0 && alloc > bg.Alloc {
+		b.Errorf("allocated %d KB, over its budget of %d KB", alloc>>10, bg.Alloc>>10)
+	}
+
+	if bg.Retained > 0 && retained > bg.Retained {
+		b.Errorf("retained %d KB, over its budget of %d KB", retained>>10, bg.Retained>>10)
+	}
+}
@@ -0,0 +1,89 @@
+// Package spectest generates specifications for tests and benchmarks of documentation at scale.
+package spectest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// GroupSize is the number of operations tagged alike in a large specification.
+const GroupSize = 10
+
+// WriteLarge writes a specification of n operations, in groups of GroupSize, to the directory dir,
+// returning its file name. Every fifth operation creates a thing from a request body; the others
+// get one.
+func WriteLarge(dir string, n int) (string, error) {
+	paths := make(map[string]interface{}, n)
+	tags := make([]interface{}, 0, n/GroupSize+1)
+
+	for i := 0; i < n; i++ {
+		group := fmt.Sprintf("group%d", i/GroupSize)
+		if i%GroupSize == 0 {
+			tags = append(tags, map[string]interface{}{"name": group, "description": fmt.Sprintf("Group %d", i/GroupSize)})
+		}
+
+		op := map[string]interface{}{
+			"tags":        []string{group},
+			"operationId": fmt.Sprintf("getThing%d", i),
+			"summary":     fmt.Sprintf("Get thing %d", i),
+			"description": "Gets a thing, by its **identifier**.",
+			"parameters": []interface{}{
+				map[string]interface{}{"name": "id", "in": "path", "required": true, "type": "string"},
+				map[string]interface{}{"name": "verbose", "in": "query", "type": "boolean"},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{"description": "The thing", "schema": map[string]interface{}{"$ref": "#/definitions/Thing"}},
+				"404": map[string]interface{}{"description": "No such thing"},
+			},
+		}
+
+		verb, path := "get", fmt.Sprintf("/v1/%s/things%d/{id}", group, i)
+
+		if i%5 == 0 {
+			verb, path = "post", fmt.Sprintf("/v1/%s/things%d", group, i)
+			op["operationId"] = fmt.Sprintf("createThing%d", i)
+			op["summary"] = fmt.Sprintf("Create thing %d", i)
+			op["description"] = "Creates a thing."
+			op["parameters"] = []interface{}{
+				map[string]interface{}{"name": "thing", "in": "body", "required": true, "schema": map[string]interface{}{"$ref": "#/definitions/Thing"}},
+			}
+		}
+
+		paths[path] = map[string]interface{}{verb: op}
+	}
+
+	doc := map[string]interface{}{
+		"swagger":  "2.0",
+		"info":     map[string]interface{}{"title": "Large API", "version": "1.0.0", "description": "A large API."},
+		"host":     "api.example.com",
+		"basePath": "/",
+		"schemes":  []string{"https"},
+		"consumes": []string{"application/json"},
+		"produces": []string{"application/json"},
+		"tags":     tags,
+		"paths":    paths,
+		"definitions": map[string]interface{}{
+			"Thing": map[string]interface{}{
+				"title":    "Thing",
+				"type":     "object",
+				"required": []string{"name"},
+				"properties": map[string]interface{}{
+					"id":   map[string]interface{}{"type": "string", "description": "Identifier of the thing", "readOnly": true},
+					"name": map[string]interface{}{"type": "string", "description": "Name of the thing"},
+					"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+				},
+			},
+		},
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+
+	name := "large_api.json"
+
+	return name, ioutil.WriteFile(filepath.Join(dir, name), b, 0o600)
+}
@@ -21,14 +21,11 @@ package spec
 
 import (
 	"bufio"
-	"os"
-	"path/filepath"
+	"io/fs"
 	"regexp"
 	"strconv"
 
-	"github.com/spf13/viper"
-
-	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/assets"
 )
 
 var (
@@ -36,62 +33,18 @@ var (
 	statusCodes    map[int]string
 )
 
-// loadStatusCodes loads status code mappings.
-func loadStatusCodes() {
-	var statusfile string
-
-	if viper.GetString(config.AssetsDir) != "" {
-		statusfile = filepath.Join(viper.GetString(config.AssetsDir), "status_codes.csv")
-		log().Tracef("Looking in assets dir for %s", statusfile)
-
-		if _, err := os.Stat(statusfile); os.IsNotExist(err) {
-			statusfile = ""
-		}
-	}
-
-	if statusfile == "" && viper.GetString(config.ThemeDir) != "" {
-		statusfile = filepath.Join(viper.GetString(config.ThemeDir), viper.GetString(config.Theme), "status_codes.csv")
-		log().Tracef("Looking in theme dir for %s", statusfile)
-
-		if _, err := os.Stat(statusfile); os.IsNotExist(err) {
-			statusfile = ""
-		}
-	}
-
-	if statusfile == "" {
-		statusfile = filepath.Join(viper.GetString(config.DefaultAssetsDir), "themes", viper.GetString(config.Theme), "status_codes.csv")
-		log().Tracef("Looking in default theme dir for %s", statusfile)
-
-		if _, err := os.Stat(statusfile); os.IsNotExist(err) {
-			statusfile = ""
-		}
-	}
-
-	if statusfile == "" {
-		statusfile = filepath.Join(viper.GetString(config.DefaultAssetsDir), "themes", "default", "status_codes.csv")
-		log().Tracef("Looking in default theme %s", statusfile)
-
-		if _, err := os.Stat(statusfile); os.IsNotExist(err) {
-			statusfile = ""
-		}
-	}
-
-	if statusfile == "" {
+// loadStatusCodes loads status code mappings, from the sources opened with open.
+func loadStatusCodes(open func(location string) (fs.FS, error)) {
+	file, statusfile, err := assets.Open(open, "status_codes.csv")
+	if err != nil {
 		log().Trace("No status code map file found.")
 
 		return
 	}
+	defer file.Close()
 
 	log().Tracef("Processing HTTP status code file: %s", statusfile)
 
-	file, err := os.Open(statusfile)
-	if err != nil {
-		log().Errorf("Error: %s", err)
-
-		return
-	}
-	defer file.Close()
-
 	statusCodes = make(map[int]string)
 
 	scanner := bufio.NewScanner(file)
@@ -0,0 +1,117 @@
+// Package tracing traces requests with OpenTelemetry, through routing, rendering and proxying,
+// exporting spans over OTLP. Spans are only recorded when an OTLP endpoint is configured, but W3C
+// trace context is always propagated to proxied upstreams.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/handlers/capture"
+	"github.com/kenjones-cisco/dapperdox/version"
+)
+
+const instrumentation = "github.com/kenjones-cisco/dapperdox"
+
+// unmatched names the spans of requests matching no route.
+const unmatched = "unmatched"
+
+// Init sets up the exporter and the propagation of trace context, returning the function that
+// flushes the spans not yet exported. The configuration is only read at startup.
+func Init() (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	endpoint := viper.GetString(config.TracingEndpoint)
+	if endpoint == "" {
+		log().Debug("Tracing is not configured")
+
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if viper.GetBool(config.TracingInsecure) {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(viper.GetString(config.TracingServiceName)),
+		semconv.ServiceVersionKey.String(version.Version),
+	)
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(viper.GetFloat64(config.TracingSampleRatio)))),
+	)
+
+	otel.SetTracerProvider(tp)
+
+	log().Infof("Exporting traces to %s", endpoint)
+
+	return tp.Shutdown, nil
+}
+
+// Start starts a span, as a child of any in the context.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, opts...)
+}
+
+// Inject sets the trace context of the span in the context on the outgoing request headers.
+func Inject(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// Middleware traces each request in a server span named by the template of the route it matched,
+// continuing the trace of the client when it sent a traceparent header.
+func Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := unmatched
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if t, err := cr.GetPathTemplate(); err == nil {
+				route = t
+			}
+		}
+
+		ctx, span := Start(ctx, route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, r)...),
+		)
+		defer span.End()
+
+		sw := capture.Wrap(w)
+
+		h.ServeHTTP(sw, r.WithContext(ctx))
+
+		End(span, sw.Status())
+	})
+}
+
+// End records the HTTP status of the response on the span.
+func End(span trace.Span, status int) {
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+}
+
+// String returns a string attribute, for spans.
+func String(key, value string) attribute.KeyValue {
+	return attribute.String(key, value)
+}
@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+)
+
+const (
+	traceID     = "0af7651916cd43dd8448eb211c80319c"
+	parentSpan  = "b7ad6b7169203331"
+	traceparent = "00-" + traceID + "-" + parentSpan + "-01"
+)
+
+// record records the spans ended, with the propagation Init configures.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	config.Restore()
+
+	if _, err := Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	return sr
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		parent     string
+		wantName   string
+		wantStatus codes.Code
+	}{
+		{name: "continues the client trace", path: "/pets/reference/listPets", parent: traceparent, wantName: "/{specID}/reference/{operation}"},
+		{name: "new trace", path: "/pets/reference/listPets", wantName: "/{specID}/reference/{operation}"},
+		{name: "server error", path: "/fail", wantName: "/fail", wantStatus: codes.Error},
+		{name: "unmatched", path: "/missing", wantName: unmatched, wantStatus: codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := record(t)
+
+			rtr := mux.NewRouter()
+			rtr.Use(Middleware)
+			rtr.HandleFunc("/{specID}/reference/{operation}", func(w http.ResponseWriter, r *http.Request) {})
+			rtr.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			})
+			rtr.NotFoundHandler = Middleware(http.NotFoundHandler())
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.parent != "" {
+				req.Header.Set("traceparent", tt.parent)
+			}
+
+			rtr.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := sr.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("%d spans ended, want 1", len(spans))
+			}
+
+			s := spans[0]
+			if s.Name() != tt.wantName || s.Status().Code != tt.wantStatus {
+				t.Errorf("span %s, status %v, want %s, %v", s.Name(), s.Status().Code, tt.wantName, tt.wantStatus)
+			}
+
+			continued := s.SpanContext().TraceID().String() == traceID && s.Parent().SpanID().String() == parentSpan
+			if continued != (tt.parent != "") {
+				t.Errorf("span of trace %s, parent %s, continued %v, want %v", s.SpanContext().TraceID(), s.Parent().SpanID(), continued, tt.parent != "")
+			}
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	sr := record(t)
+
+	ctx, span := Start(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "proxy")
+	h := http.Header{}
+	Inject(ctx, h)
+	span.End()
+
+	sc := sr.Ended()[0].SpanContext()
+
+	want := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-"
+	if got := h.Get("traceparent"); !strings.HasPrefix(got, want) {
+		t.Errorf("traceparent = %q, want the span %s", got, want)
+	}
+}
+
+func TestInjectWithoutExporter(t *testing.T) {
+	config.Restore()
+
+	if _, err := Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	// Spans are not recorded without an exporter, but the trace of the client still reaches upstreams.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", traceparent)
+
+	var h http.Header
+
+	Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h = http.Header{}
+		Inject(r.Context(), h)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := h.Get("traceparent"); !strings.Contains(got, traceID) {
+		t.Errorf("traceparent = %q, want the trace %s propagated", got, traceID)
+	}
+}
@@ -0,0 +1,92 @@
+package validator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+// Response checks the status, headers and body of a response against those documented for the
+// method. The body is passed separately, having already been read from the response. Members of
+// the body that are not documented by the response resource are reported as violations.
+func Response(method *spec.Method, resp *http.Response, body []byte) []Violation {
+	documented, ok := method.Responses[resp.StatusCode]
+	if !ok {
+		if method.DefaultResponse == nil {
+			return []Violation{{In: "status", Name: strconv.Itoa(resp.StatusCode), Message: "is not documented"}}
+		}
+
+		documented = *method.DefaultResponse
+	}
+
+	var violations []Violation
+
+	for _, h := range documented.Headers {
+		violations = append(violations, header(h, resp.Header.Values(h.Name))...)
+	}
+
+	if documented.Resource == nil || len(bytes.TrimSpace(body)) == 0 {
+		return violations
+	}
+
+	if !IsJSON(resp.Header.Get("Content-Type")) {
+		log().Debugf("Not validating response body of content type %q", resp.Header.Get("Content-Type"))
+
+		return violations
+	}
+
+	body, err := decode(resp.Header.Get("Content-Encoding"), body)
+	if err != nil {
+		return append(violations, Violation{In: "body", Message: "could not be decoded: " + err.Error()})
+	}
+
+	data, err := DecodeJSON(body)
+	if err != nil {
+		return append(violations, Violation{In: "body", Message: "is not valid JSON: " + err.Error()})
+	}
+
+	return append(violations, Body(documented.Resource, data, documented.IsArray, true)...)
+}
+
+func header(h spec.Header, values []string) []Violation {
+	if len(values) == 0 {
+		if h.Required {
+			return []Violation{{In: "header", Name: h.Name, Message: "is required"}}
+		}
+
+		return nil
+	}
+
+	// Response headers share the type description of parameters, so are checked the same way.
+	p := spec.Parameter{
+		Name:             h.Name,
+		Type:             h.Type,
+		Enum:             h.Enum,
+		CollectionFormat: h.CollectionFormat,
+	}
+
+	return parameter(p, "header", values)
+}
+
+func decode(encoding string, body []byte) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		return ioutil.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
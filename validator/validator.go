@@ -0,0 +1,482 @@
+// Package validator checks HTTP traffic against the documented API methods of the loaded specifications.
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+// Violation describes one way in which a request or response departs from its documented method.
+type Violation struct {
+	In      string `json:"in"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Name == "" {
+		return fmt.Sprintf("%s: %s", v.In, v.Message)
+	}
+
+	return fmt.Sprintf("%s %s: %s", v.In, v.Name, v.Message)
+}
+
+const maxFormMemory = 32 << 20 // Multipart form data held in memory while parsing.
+
+var collectionSeparators = map[string]string{
+	"csv":   ",",
+	"ssv":   " ",
+	"tsv":   "\t",
+	"pipes": "|",
+}
+
+// Injected names the headers and query parameters a proxy sets on the requests it forwards, in place
+// of any the client sent.
+type Injected struct {
+	Headers []string
+	Query   []string
+}
+
+func (in Injected) header(name string) bool {
+	for _, h := range in.Headers {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (in Injected) query(name string) bool {
+	return contains(in.Query, name)
+}
+
+// Request checks the parameters and body of the request against those documented for the method.
+// pathParams holds the values of the templated path segments, as matched by Suite.MatchMethod.
+// The parameters injected are not checked, being set once the request is checked. The request body
+// is read and replaced, so the request can still be forwarded afterwards. A body larger than maxBody
+// is not read whole, and neither it nor form data is checked.
+func Request(method *spec.Method, req *http.Request, pathParams map[string]string, maxBody int64, injected Injected) []Violation {
+	var violations []Violation
+
+	body, read, err := readBody(req, maxBody)
+	if err != nil {
+		return append(violations, Violation{In: "body", Message: "could not be read: " + err.Error()})
+	}
+
+	for _, p := range method.PathParams {
+		v, ok := pathParams[p.Name]
+		violations = append(violations, parameter(p, "path", presence(v, ok))...)
+	}
+
+	query := req.URL.Query()
+
+	for _, p := range method.QueryParams {
+		if !injected.query(p.Name) {
+			violations = append(violations, parameter(p, "query", query[p.Name])...)
+		}
+	}
+
+	for _, p := range method.HeaderParams {
+		if !injected.header(p.Name) {
+			violations = append(violations, parameter(p, "header", req.Header.Values(p.Name))...)
+		}
+	}
+
+	if !read {
+		log().Debugf("Not validating body of %s %s, as it is larger than %d bytes", req.Method, req.URL.Path, maxBody)
+	}
+
+	if len(method.FormParams) > 0 && read {
+		violations = append(violations, form(method, req, body)...)
+	}
+
+	if method.BodyParam != nil && read {
+		violations = append(violations, requestBody(method.BodyParam, req.Header.Get("Content-Type"), body)...)
+	}
+
+	log().Tracef("%d violations for %s %s", len(violations), req.Method, req.URL.Path)
+
+	return violations
+}
+
+// Body checks a decoded JSON document against a resource schema. isArray says whether the document
+// is an array of the resource, as resources are shared between single and array bodies. When strict
+// is set, object members that are not documented by the resource are also reported.
+func Body(r *spec.Resource, data interface{}, isArray, strict bool) []Violation {
+	if r == nil {
+		return nil
+	}
+
+	if !isArray {
+		if len(r.Properties) > 0 {
+			return object(r, data, "body", strict)
+		}
+
+		return value(r, data, "body", strict)
+	}
+
+	items, ok := data.([]interface{})
+	if !ok {
+		return []Violation{{In: "body", Message: "must be an array"}}
+	}
+
+	var violations []Violation
+
+	for i, item := range items {
+		path := fmt.Sprintf("body[%d]", i)
+
+		if len(r.Properties) == 0 && len(r.Type) > 1 {
+			violations = append(violations, scalar(r, r.Type[1], item, path)...)
+		} else {
+			violations = append(violations, object(r, item, path, strict)...)
+		}
+	}
+
+	return violations
+}
+
+// DecodeJSON decodes a JSON document, keeping numbers as json.Number so integers can be told apart.
+func DecodeJSON(b []byte) (interface{}, error) {
+	var data interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// IsJSON reports whether the content type names a JSON document. A document of no type is not
+// assumed to be JSON, as it may be anything.
+func IsJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// readBody reads a request body of up to maxBody bytes, reporting whether it did. A larger body is
+// left to stream on when the request is forwarded, the bytes read being put back in front of it.
+func readBody(req *http.Request, maxBody int64) ([]byte, bool, error) {
+	if req.ContentLength > maxBody {
+		return nil, false, nil
+	}
+
+	body, rest, err := ReadLimited(req.Body, maxBody)
+	req.Body = rest
+
+	return body, body != nil, err
+}
+
+// ReadLimited reads a body of up to maxBody bytes, returning nil when it is larger, and the body to
+// pass on in its place. A larger body is not read whole, the bytes read being put back in front of
+// the rest.
+func ReadLimited(body io.ReadCloser, maxBody int64) ([]byte, io.ReadCloser, error) {
+	if body == nil || body == http.NoBody {
+		return []byte{}, body, nil
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(body, maxBody+1))
+	if err == nil && int64(len(b)) > maxBody {
+		return nil, &prefixedBody{Reader: io.MultiReader(bytes.NewReader(b), body), Closer: body}, nil
+	}
+
+	_ = body.Close()
+
+	return b, ioutil.NopCloser(bytes.NewReader(b)), err
+}
+
+// prefixedBody is a body partly read, which reads on from the bytes read.
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func presence(v string, ok bool) []string {
+	if !ok {
+		return nil
+	}
+
+	return []string{v}
+}
+
+func form(method *spec.Method, req *http.Request, body []byte) []Violation {
+	// Parse a copy of the request, so the original body is left intact for forwarding.
+	clone := req.Clone(req.Context())
+	clone.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := clone.ParseMultipartForm(maxFormMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return []Violation{{In: "formData", Message: "could not be parsed: " + err.Error()}}
+	}
+
+	var violations []Violation
+
+	for _, p := range method.FormParams {
+		if len(p.Type) > 0 && p.Type[len(p.Type)-1] == "file" {
+			if clone.MultipartForm == nil || len(clone.MultipartForm.File[p.Name]) == 0 {
+				violations = append(violations, parameter(p, "formData", nil)...)
+			}
+
+			continue
+		}
+
+		violations = append(violations, parameter(p, "formData", clone.PostForm[p.Name])...)
+	}
+
+	return violations
+}
+
+func parameter(p spec.Parameter, in string, values []string) []Violation {
+	if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+		if p.Required {
+			return []Violation{{In: in, Name: p.Name, Message: "is required"}}
+		}
+
+		return nil
+	}
+
+	ptype := ""
+	if len(p.Type) > 0 {
+		ptype = p.Type[len(p.Type)-1]
+	}
+
+	if len(p.Type) > 1 && p.Type[0] == "array" {
+		if sep, ok := collectionSeparators[p.CollectionFormat]; ok {
+			var items []string
+			for _, v := range values {
+				items = append(items, strings.Split(v, sep)...)
+			}
+
+			values = items
+		}
+	} else if len(values) > 1 {
+		return []Violation{{In: in, Name: p.Name, Message: "must not be given more than once"}}
+	}
+
+	var violations []Violation
+
+	for _, v := range values {
+		if msg := primitive(ptype, v); msg != "" {
+			violations = append(violations, Violation{In: in, Name: p.Name, Message: msg})
+
+			continue
+		}
+
+		if len(p.Enum) > 0 && !contains(p.Enum, v) {
+			violations = append(violations, Violation{In: in, Name: p.Name, Message: fmt.Sprintf("%q is not one of %s", v, strings.Join(p.Enum, ", "))})
+		}
+	}
+
+	return violations
+}
+
+func requestBody(p *spec.Parameter, contentType string, body []byte) []Violation {
+	if len(bytes.TrimSpace(body)) == 0 {
+		if p.Required {
+			return []Violation{{In: "body", Name: p.Name, Message: "is required"}}
+		}
+
+		return nil
+	}
+
+	if !IsJSON(contentType) {
+		log().Debugf("Not validating body of content type %q", contentType)
+
+		return nil
+	}
+
+	data, err := DecodeJSON(body)
+	if err != nil {
+		return []Violation{{In: "body", Name: p.Name, Message: "is not valid JSON: " + err.Error()}}
+	}
+
+	return Body(p.Resource, data, p.IsArray, false)
+}
+
+func value(r *spec.Resource, data interface{}, path string, strict bool) []Violation {
+	if r == nil || data == nil {
+		return nil
+	}
+
+	rtype := "object"
+	if len(r.Type) > 0 {
+		rtype = strings.ToLower(r.Type[0])
+	}
+
+	switch rtype {
+	case "array":
+		items, ok := data.([]interface{})
+		if !ok {
+			return []Violation{{In: "body", Name: path, Message: "must be an array"}}
+		}
+
+		var violations []Violation
+
+		for i, item := range items {
+			ipath := fmt.Sprintf("%s[%d]", path, i)
+
+			if len(r.Properties) == 0 && len(r.Type) > 1 {
+				violations = append(violations, scalar(r, r.Type[1], item, ipath)...)
+			} else {
+				violations = append(violations, object(r, item, ipath, strict)...)
+			}
+		}
+
+		return violations
+	case "map":
+		if len(r.Type) > 1 && !strings.EqualFold(r.Type[1], "object") {
+			return scalar(r, r.Type[1], data, path)
+		}
+
+		return object(r, data, path, strict)
+	case "object":
+		return object(r, data, path, strict)
+	default:
+		return scalar(r, rtype, data, path)
+	}
+}
+
+func object(r *spec.Resource, data interface{}, path string, strict bool) []Violation {
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return []Violation{{In: "body", Name: path, Message: "must be an object"}}
+	}
+
+	var violations []Violation
+
+	for name, p := range r.Properties {
+		if name == spec.MapKey {
+			continue
+		}
+
+		v, present := obj[name]
+		if !present {
+			if p.Required {
+				violations = append(violations, Violation{In: "body", Name: path + "." + name, Message: "is required"})
+			}
+
+			continue
+		}
+
+		violations = append(violations, value(p, v, path+"."+name, strict)...)
+	}
+
+	additional, hasAdditional := r.Properties[spec.MapKey]
+
+	for name, v := range obj {
+		if _, documented := r.Properties[name]; documented {
+			continue
+		}
+
+		if hasAdditional {
+			violations = append(violations, value(additional, v, path+"."+name, strict)...)
+		} else if strict {
+			violations = append(violations, Violation{In: "body", Name: path + "." + name, Message: "is not documented"})
+		}
+	}
+
+	return violations
+}
+
+func scalar(r *spec.Resource, stype string, data interface{}, path string) []Violation {
+	var s string
+
+	switch v := data.(type) {
+	case json.Number:
+		if !isNumeric(stype) {
+			return []Violation{{In: "body", Name: path, Message: "must be of type " + stype}}
+		}
+
+		s = v.String()
+	case bool:
+		if stype != "boolean" {
+			return []Violation{{In: "body", Name: path, Message: "must be of type " + stype}}
+		}
+
+		s = strconv.FormatBool(v)
+	case string:
+		if isNumeric(stype) || stype == "boolean" {
+			return []Violation{{In: "body", Name: path, Message: "must be of type " + stype}}
+		}
+
+		s = v
+	default:
+		return []Violation{{In: "body", Name: path, Message: "must be of type " + stype}}
+	}
+
+	if msg := primitive(stype, s); msg != "" {
+		return []Violation{{In: "body", Name: path, Message: msg}}
+	}
+
+	if len(r.Enum) > 0 && !contains(r.Enum, s) {
+		return []Violation{{In: "body", Name: path, Message: fmt.Sprintf("%q is not one of %s", s, strings.Join(r.Enum, ", "))}}
+	}
+
+	return nil
+}
+
+// primitive checks a value against a primitive type or format, returning a description of any problem.
+func primitive(ptype, v string) string {
+	var err error
+
+	switch strings.ToLower(ptype) {
+	case "integer", "int64":
+		_, err = strconv.ParseInt(v, 10, 64)
+	case "int32":
+		_, err = strconv.ParseInt(v, 10, 32)
+	case "number", "double":
+		_, err = strconv.ParseFloat(v, 64)
+	case "float":
+		_, err = strconv.ParseFloat(v, 32)
+	case "boolean":
+		if v != "true" && v != "false" {
+			return fmt.Sprintf("%q must be of type boolean", v)
+		}
+	case "date":
+		_, err = time.Parse("2006-01-02", v)
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, v)
+	}
+
+	if err != nil {
+		return fmt.Sprintf("%q must be of type %s", v, ptype)
+	}
+
+	return ""
+}
+
+func isNumeric(t string) bool {
+	switch strings.ToLower(t) {
+	case "integer", "int32", "int64", "number", "float", "double":
+		return true
+	}
+
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,214 @@
+package validator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/kenjones-cisco/dapperdox/config"
+	"github.com/kenjones-cisco/dapperdox/spec"
+)
+
+const testSpecDir = "../fixtures/"
+
+// maxBody is the largest request body validated in tests.
+const maxBody = 1 << 20
+
+func loadSpec(t *testing.T) *spec.Suite {
+	t.Helper()
+
+	config.Restore()
+	viper.Set(config.SpecDir, testSpecDir)
+	viper.Set(config.SpecFilename, "common_api.json")
+
+	suite, err := spec.LoadSpecifications(nil)
+	if err != nil {
+		t.Fatalf("LoadSpecifications() error = %v", err)
+	}
+
+	return suite
+}
+
+func TestRequest(t *testing.T) {
+	suite := loadSpec(t)
+
+	validAccount := `{"name": "dev", "email": "team@example.com", "estimated_cost": 10.5, "lifecycle": "PROD",
+		"user_attribution": {"business_application_name": "app", "business_contact": "biz@example.com", "technical_contact": "tech@example.com"}}`
+
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		body          string
+		noContentType bool
+		noTenant      bool
+		injected      Injected
+		wantNames     []string
+	}{
+		{
+			name:   "success - valid query",
+			method: http.MethodGet,
+			target: "/v1/aws/accounts?lifecycle=PROD&limit=10&fields=name,email",
+		},
+		{
+			name:      "failure - bad enum and integer",
+			method:    http.MethodGet,
+			target:    "/v1/aws/accounts?lifecycle=TEST&limit=ten",
+			wantNames: []string{"lifecycle", "limit"},
+		},
+		{
+			name:   "success - valid body",
+			method: http.MethodPost,
+			target: "/v1/aws/accounts",
+			body:   validAccount,
+		},
+		{
+			name:      "failure - missing body",
+			method:    http.MethodPost,
+			target:    "/v1/aws/accounts",
+			wantNames: []string{"Account"},
+		},
+		{
+			name:      "failure - invalid body members",
+			method:    http.MethodPost,
+			target:    "/v1/aws/accounts",
+			body:      `{"name": "dev", "email": "team@example.com", "estimated_cost": "lots", "lifecycle": "TEST"}`,
+			wantNames: []string{"body.estimated_cost", "body.lifecycle", "body.user_attribution"},
+		},
+		{
+			name:          "success - body of no content type not checked",
+			method:        http.MethodPost,
+			target:        "/v1/aws/accounts",
+			body:          `{"name": "dev", "email": "team@example.com", "estimated_cost": "lots", "lifecycle": "TEST"}`,
+			noContentType: true,
+		},
+		{
+			name:      "failure - missing header",
+			method:    http.MethodGet,
+			target:    "/v1/aws/accounts",
+			noTenant:  true,
+			wantNames: []string{"X-Tenant-Id"},
+		},
+		{
+			name:     "success - header injected by the proxy not checked",
+			method:   http.MethodGet,
+			target:   "/v1/aws/accounts",
+			noTenant: true,
+			injected: Injected{Headers: []string{"x-tenant-id"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if !tt.noTenant {
+				req.Header.Set("X-Tenant-Id", "tenant")
+			}
+
+			if !tt.noContentType {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			_, method, params := suite.MatchMethod(req.Method, req.URL.Path)
+			if method == nil {
+				t.Fatalf("no method documented for %s %s", tt.method, tt.target)
+			}
+
+			got := Request(method, req, params, maxBody, tt.injected)
+
+			if len(got) != len(tt.wantNames) {
+				t.Fatalf("Request() = %v, want violations of %v", got, tt.wantNames)
+			}
+
+			for _, name := range tt.wantNames {
+				found := false
+
+				for _, v := range got {
+					if v.Name == name {
+						found = true
+					}
+				}
+
+				if !found {
+					t.Errorf("Request() = %v, want violation of %s", got, name)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestLargeBody(t *testing.T) {
+	suite := loadSpec(t)
+
+	body := `{"name": "dev", "estimated_cost": "lots"}`
+
+	for _, length := range []int64{int64(len(body)), -1} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/aws/accounts", strings.NewReader(body))
+		req.ContentLength = length // -1 when the size is not known up front, as when chunked.
+		req.Header.Set("X-Tenant-Id", "tenant")
+
+		_, method, params := suite.MatchMethod(req.Method, req.URL.Path)
+
+		if got := Request(method, req, params, 16, Injected{}); len(got) != 0 {
+			t.Errorf("Request() of a body of length %d over the limit = %v, want it not validated", length, got)
+		}
+
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil || string(b) != body {
+			t.Errorf("body of length %d left to forward = %q, %v, want %q", length, b, err, body)
+		}
+	}
+}
+
+func TestResponse(t *testing.T) {
+	suite := loadSpec(t)
+
+	_, method, _ := suite.MatchMethod(http.MethodGet, "/v1/aws/accounts/1234")
+	if method == nil {
+		t.Fatal("no method documented for GET /v1/aws/accounts/{accountId}")
+	}
+
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantNames []string
+	}{
+		{
+			name:   "success - documented body",
+			status: http.StatusOK,
+			body:   `{"id": "1234", "name": "dev", "estimated_cost": 10.5}`,
+		},
+		{
+			name:      "failure - undocumented member",
+			status:    http.StatusOK,
+			body:      `{"id": "1234", "surprise": true}`,
+			wantNames: []string{"body.surprise"},
+		},
+		{
+			name:   "success - status covered by default response",
+			status: http.StatusTeapot,
+			body:   `{"code": "teapot", "message": "short and stout"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{"Content-Type": []string{"application/json"}}}
+
+			got := Response(method, resp, []byte(tt.body))
+
+			if len(got) != len(tt.wantNames) {
+				t.Fatalf("Response() = %v, want violations of %v", got, tt.wantNames)
+			}
+
+			for i, name := range tt.wantNames {
+				if got[i].Name != name {
+					t.Errorf("Response() = %v, want violation of %s", got, name)
+				}
+			}
+		})
+	}
+}
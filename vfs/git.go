@@ -0,0 +1,227 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/mod/semver"
+)
+
+var (
+	// trees are the git trees read, by repository, commit and directories read.
+	trees = map[string]*cachedTree{}
+	// generation counts the calls to ReleaseTrees, so the trees read since the last are known.
+	generation uint64
+)
+
+// cachedTree is the file system of a git tree read, and the generation it was last read in.
+type cachedTree struct {
+	fsys fs.FS
+	used uint64
+}
+
+// Git returns the file system of the tree of the commit a revision of a local git repository
+// resolves to, which may be a branch, a tag or a commit. Only the files under the directories given
+// are read, or all of them when none are. Trees are read once, as commits do not change, and kept
+// until ReleaseTrees is called without their having been read since.
+func Git(repository, revision string, dirs ...string) (fs.FS, error) {
+	repo, err := openRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s in git repository %s: %w", revision, repository, err)
+	}
+
+	clean := make([]string, len(dirs))
+	for i, dir := range dirs {
+		clean[i] = strings.Trim(path.Clean("/"+dir), "/")
+	}
+
+	dirs = clean
+
+	key := repository + "\x00" + hash.String() + "\x00" + strings.Join(dirs, "\x00")
+
+	mu.Lock()
+	t, ok := trees[key]
+	if ok {
+		t.used = generation
+	}
+	mu.Unlock()
+
+	if ok {
+		return t.fsys, nil
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys, err := readTree(commit, dirs)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s of git repository %s: %w", revision, repository, err)
+	}
+
+	mu.Lock()
+	trees[key] = &cachedTree{fsys: fsys, used: generation}
+	mu.Unlock()
+
+	return fsys, nil
+}
+
+// ReleaseTrees forgets the trees not read since it was last called, so those of revisions no longer
+// published are not kept in memory once the documentation is reloaded.
+func ReleaseTrees() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for key, t := range trees {
+		if t.used != generation {
+			delete(trees, key)
+		}
+	}
+
+	generation++
+}
+
+// LatestTag returns the newest tag of a local git repository: that of the highest semantic version,
+// or the last committed when no tag is a semantic version.
+func LatestTag(repository string) (string, error) {
+	repo, err := openRepository(repository)
+	if err != nil {
+		return "", err
+	}
+
+	iter, err := repo.Tags()
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		latest, latestVersion string
+		latestTime            time.Time
+	)
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+
+		if v := tagVersion(name); v != "" {
+			if latestVersion == "" || semver.Compare(v, latestVersion) > 0 {
+				latest, latestVersion = name, v
+			}
+
+			return nil
+		}
+
+		if latestVersion != "" {
+			return nil
+		}
+
+		hash, err := repo.ResolveRevision(plumbing.Revision(ref.Name()))
+		if err != nil {
+			return nil
+		}
+
+		if c, err := repo.CommitObject(*hash); err == nil && c.Committer.When.After(latestTime) {
+			latest, latestTime = name, c.Committer.When
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if latest == "" {
+		return "", fmt.Errorf("git repository %s has no tags", repository)
+	}
+
+	return latest, nil
+}
+
+// tagVersion returns the semantic version a tag names, or "" when it names none.
+func tagVersion(tag string) string {
+	v := tag
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+
+	if !semver.IsValid(v) {
+		return ""
+	}
+
+	return v
+}
+
+func openRepository(repository string) (*git.Repository, error) {
+	repo, err := git.PlainOpenWithOptions(repository, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening git repository %s: %w", repository, err)
+	}
+
+	return repo, nil
+}
+
+// readTree reads the regular files of the tree of a commit under the directories given into memory.
+func readTree(commit *object.Commit, dirs []string) (fs.FS, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := memFS{}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if !f.Mode.IsFile() || !under(f.Name, dirs) {
+			return nil
+		}
+
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+
+		if err != nil {
+			return err
+		}
+
+		fsys[f.Name] = &memFile{data: data, mode: 0o444, modTime: commit.Committer.When}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return fsys, nil
+}
+
+// under reports whether the file name is under one of the directories, or there are none.
+func under(name string, dirs []string) bool {
+	if len(dirs) == 0 {
+		return true
+	}
+
+	for _, dir := range dirs {
+		if dir == "" || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,136 @@
+package vfs
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitFiles writes files into the working tree of a repository, commits them and tags the commit.
+func commitFiles(t *testing.T, repo *git.Repository, dir, tag string, when time.Time, files map[string]string) {
+	t.Helper()
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(n))
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := wt.Add(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: when}
+
+	hash, err := wt.Commit(tag, &git.CommitOptions{Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.CreateTag(tag, hash, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGit(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	commitFiles(t, repo, dir, "v1.10.0", start, map[string]string{"specs/api.json": "10", "README.md": "readme"})
+	commitFiles(t, repo, dir, "v1.9.0", start.Add(time.Hour), map[string]string{"specs/api.json": "9"})
+	commitFiles(t, repo, dir, "nightly", start.Add(2*time.Hour), map[string]string{"specs/api.json": "nightly"})
+
+	latest, err := LatestTag(filepath.Join(dir, "specs"))
+	if err != nil || latest != "v1.10.0" {
+		t.Errorf("LatestTag() = %q, %v, want the highest semantic version v1.10.0", latest, err)
+	}
+
+	for revision, want := range map[string]string{"v1.10.0": "10", "v1.9.0": "9", "nightly": "nightly", "HEAD~1": "9"} {
+		fsys, err := Git(dir, revision, "specs/")
+		if err != nil {
+			t.Fatalf("Git(%q) error = %v", revision, err)
+		}
+
+		if b, err := fs.ReadFile(fsys, "specs/api.json"); err != nil || string(b) != want {
+			t.Errorf("Git(%q) specs/api.json = %q, %v, want %q", revision, b, err, want)
+		}
+
+		if _, err := fs.Stat(fsys, "README.md"); err == nil {
+			t.Errorf("Git(%q) read README.md, which is not under the directories given", revision)
+		}
+	}
+
+	if _, err := Git(dir, "missing"); err == nil {
+		t.Error("Git() of a missing revision error = nil, want an error")
+	}
+}
+
+func TestReleaseTrees(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	commitFiles(t, repo, dir, "v1", start, map[string]string{"api.json": "1"})
+	commitFiles(t, repo, dir, "v2", start.Add(time.Hour), map[string]string{"api.json": "2"})
+
+	cached := func(revision string) bool {
+		hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		_, ok := trees[dir+"\x00"+hash.String()+"\x00"]
+
+		return ok
+	}
+
+	for _, revision := range []string{"v1", "v2"} {
+		if _, err := Git(dir, revision); err != nil {
+			t.Fatalf("Git(%q) error = %v", revision, err)
+		}
+	}
+
+	// Only v2 is read again before the next release, as when v1 is no longer published.
+	ReleaseTrees()
+
+	if _, err := Git(dir, "v2"); err != nil {
+		t.Fatalf("Git(v2) error = %v", err)
+	}
+
+	ReleaseTrees()
+
+	if cached("v1") || !cached("v2") {
+		t.Errorf("trees kept v1 %v, v2 %v, want only v2, read since the last release", cached("v1"), cached("v2"))
+	}
+}
@@ -0,0 +1,138 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memFS is a read-only file system of the files read from an archive into memory, keyed by their
+// slash separated paths. Directories are those the paths of the files imply.
+type memFS map[string]*memFile
+
+// memFile is the content of a file held in memory.
+type memFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// Open opens the file or directory named.
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if f, ok := m[name]; ok {
+		return &openFile{info: fileInfo{name: path.Base(name), size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}, Reader: bytes.NewReader(f.data)}, nil
+	}
+
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+
+	children := map[string]fileInfo{}
+
+	for p, f := range m {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+
+		child := strings.TrimPrefix(p, prefix)
+		if i := strings.IndexByte(child, '/'); i >= 0 {
+			children[child[:i]] = fileInfo{name: child[:i], mode: fs.ModeDir | 0o555}
+		} else {
+			children[child] = fileInfo{name: child, size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}
+		}
+	}
+
+	if len(children) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, info := range children {
+		entries = append(entries, info)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return &openDir{info: fileInfo{name: path.Base(name), mode: fs.ModeDir | 0o555}, entries: entries}, nil
+}
+
+// ReadFile returns a copy of the content of the file named.
+func (m memFS) ReadFile(name string) ([]byte, error) {
+	f, ok := m[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return append([]byte(nil), f.data...), nil
+}
+
+// fileInfo describes a file or directory of a memFS, as both a FileInfo and a DirEntry.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i fileInfo) Name() string               { return i.name }
+func (i fileInfo) Size() int64                { return i.size }
+func (i fileInfo) Mode() fs.FileMode          { return i.mode }
+func (i fileInfo) ModTime() time.Time         { return i.modTime }
+func (i fileInfo) IsDir() bool                { return i.mode.IsDir() }
+func (i fileInfo) Sys() interface{}           { return nil }
+func (i fileInfo) Type() fs.FileMode          { return i.mode.Type() }
+func (i fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// openFile is a file of a memFS opened for reading.
+type openFile struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *openFile) Close() error               { return nil }
+
+// openDir is a directory of a memFS opened for listing.
+type openDir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *openDir) Close() error               { return nil }
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the next n entries of the directory, or all those left when n <= 0.
+func (d *openDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	left := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+
+		return left, nil
+	}
+
+	if len(left) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(left) {
+		n = len(left)
+	}
+
+	d.offset += n
+
+	return left[:n], nil
+}
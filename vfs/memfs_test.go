@@ -0,0 +1,27 @@
+package vfs
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemFS(t *testing.T) {
+	fsys := memFS{
+		"swagger.json":            &memFile{data: []byte("{}"), mode: 0o644},
+		"guides/intro.md":         &memFile{data: []byte("# Intro"), mode: 0o644},
+		"guides/advanced/auth.md": &memFile{data: []byte("# Auth"), mode: 0o600},
+	}
+
+	if err := fstest.TestFS(fsys, "swagger.json", "guides/intro.md", "guides/advanced/auth.md"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := fsys.Open("missing"); err == nil {
+		t.Error("Open() of a missing file error = nil, want fs.ErrNotExist")
+	}
+
+	if b, err := fs.ReadFile(memFS{}, "."); err == nil {
+		t.Errorf("ReadFile() of the root directory = %q, want an error", b)
+	}
+}
@@ -0,0 +1,199 @@
+// Package vfs opens the sources specifications, guides and themes are read from as file systems. A
+// source is a directory, a zip or tar archive, which may be gzipped, or a file system mounted under
+// a name, such as one compiled into the binary or held in memory by tests. Documentation can then
+// be shipped as a single versioned artifact.
+package vfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxArchiveSize limits the size of an archive, and of the files it holds once decompressed, since
+// archives are read into memory.
+var maxArchiveSize int64 = 512 << 20
+
+var (
+	mu      sync.Mutex
+	mounts  = map[string]fs.FS{}
+	opened  = map[string]*archive{}
+	formats = []struct {
+		ext  string
+		read func([]byte) (fs.FS, error)
+	}{
+		{".zip", readZip},
+		{".tar", readTar},
+		{".tar.gz", readTarGz},
+		{".tgz", readTarGz},
+	}
+)
+
+// archive is the content of an archive opened, kept until the archive changes.
+type archive struct {
+	modTime time.Time
+	size    int64
+	fsys    fs.FS
+}
+
+// Mount makes a file system the source named, in place of any directory or archive at that path.
+func Mount(name string, fsys fs.FS) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	mounts[name] = fsys
+}
+
+// Unmount forgets the file system mounted under a name.
+func Unmount(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	delete(mounts, name)
+}
+
+// Open returns the file system of the source at location: the file system mounted under it, the
+// contents of the archive, or the directory.
+func Open(location string) (fs.FS, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if fsys, ok := mounts[location]; ok {
+		return fsys, nil
+	}
+
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return os.DirFS(location), nil
+	}
+
+	// Archives are read once, and again only when they change.
+	if a, ok := opened[location]; ok && a.modTime.Equal(info.ModTime()) && a.size == info.Size() {
+		return a.fsys, nil
+	}
+
+	for _, f := range formats {
+		if !strings.HasSuffix(strings.ToLower(location), f.ext) {
+			continue
+		}
+
+		b, err := readArchive(location)
+		if err != nil {
+			return nil, err
+		}
+
+		fsys, err := f.read(b)
+		if err != nil {
+			return nil, fmt.Errorf("reading archive %s: %w", location, err)
+		}
+
+		opened[location] = &archive{modTime: info.ModTime(), size: info.Size(), fsys: fsys}
+
+		return fsys, nil
+	}
+
+	return nil, fmt.Errorf("%s is neither a directory nor a zip or tar archive", location)
+}
+
+// readArchive reads an archive, up to maxArchiveSize.
+func readArchive(location string) ([]byte, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(f, maxArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) > maxArchiveSize {
+		return nil, fmt.Errorf("archive %s is larger than %d bytes", location, maxArchiveSize)
+	}
+
+	return b, nil
+}
+
+// readZip opens a zip archive, whose files are decompressed as they are read. The zip reader fails
+// files decompressing to more than their headers give, so the headers bound the size.
+func readZip(b []byte) (fs.FS, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	var size uint64
+
+	for _, f := range zr.File {
+		size += f.UncompressedSize64
+		if size > uint64(maxArchiveSize) {
+			return nil, fmt.Errorf("files decompress to more than %d bytes", maxArchiveSize)
+		}
+	}
+
+	return zr, nil
+}
+
+func readTarGz(b []byte) (fs.FS, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	b, err = ioutil.ReadAll(io.LimitReader(zr, maxArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) > maxArchiveSize {
+		return nil, fmt.Errorf("archive decompresses to more than %d bytes", maxArchiveSize)
+	}
+
+	return readTar(b)
+}
+
+// readTar reads the regular files of a tar archive into memory.
+func readTar(b []byte) (fs.FS, error) {
+	fsys := memFS{}
+	tr := tar.NewReader(bytes.NewReader(b))
+
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return fsys, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+h.Name), "/")
+		if h.Typeflag != tar.TypeReg || name == "" {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		fsys[name] = &memFile{data: data, mode: fs.FileMode(h.Mode).Perm(), modTime: h.ModTime}
+	}
+}
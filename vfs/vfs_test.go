@@ -0,0 +1,244 @@
+package vfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// files are the contents of the sources tested.
+var files = map[string]string{
+	"specs/api.json":         `{"swagger": "2.0"}`,
+	"templates/guides/a.md":  "# Guide",
+	"themes/default/gfm.map": "a:b",
+	"static/js/app.js":       "x",
+}
+
+func writeZip(t *testing.T, name string) {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	zw := zip.NewWriter(&b)
+
+	for n, content := range files {
+		w, err := zw.Create(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(name, b.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, name string, gzipped bool) {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	tw := tar.NewWriter(&b)
+
+	for n, content := range files {
+		// Archives are often made of a directory, so names may start with ./
+		h := &tar.Header{Name: "./" + n, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := b.Bytes()
+
+	if gzipped {
+		var z bytes.Buffer
+
+		zw := gzip.NewWriter(&z)
+		if _, err := zw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data = z.Bytes()
+	}
+
+	if err := ioutil.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeDir(t *testing.T, dir string) {
+	t.Helper()
+
+	for n, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(n))
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	writeDir(t, filepath.Join(dir, "docs"))
+	writeZip(t, filepath.Join(dir, "docs.zip"))
+	writeTar(t, filepath.Join(dir, "docs.tar"), false)
+	writeTar(t, filepath.Join(dir, "docs.tar.gz"), true)
+	writeTar(t, filepath.Join(dir, "docs.tgz"), true)
+
+	mem := fstest.MapFS{}
+	for n, content := range files {
+		mem[n] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	Mount("memory", mem)
+	defer Unmount("memory")
+
+	for _, location := range []string{"docs", "docs.zip", "docs.tar", "docs.tar.gz", "docs.tgz", "memory"} {
+		t.Run(location, func(t *testing.T) {
+			if location != "memory" {
+				location = filepath.Join(dir, location)
+			}
+
+			fsys, err := Open(location)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+
+			for n, content := range files {
+				b, err := fs.ReadFile(fsys, n)
+				if err != nil {
+					t.Errorf("ReadFile(%q) error = %v", n, err)
+
+					continue
+				}
+
+				if string(b) != content {
+					t.Errorf("ReadFile(%q) = %q, want %q", n, b, content)
+				}
+			}
+
+			var walked int
+
+			err = fs.WalkDir(fsys, ".", func(_ string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					walked++
+				}
+
+				return err
+			})
+			if err != nil || walked != len(files) {
+				t.Errorf("WalkDir() walked %d files, error = %v, want %d", walked, err, len(files))
+			}
+		})
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	notArchive := filepath.Join(dir, "docs.txt")
+	if err := ioutil.WriteFile(notArchive, []byte("docs"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := filepath.Join(dir, "docs.zip")
+	if err := ioutil.WriteFile(corrupt, []byte("docs"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, location := range []string{filepath.Join(dir, "missing"), notArchive, corrupt} {
+		if _, err := Open(location); err == nil {
+			t.Errorf("Open(%q) error = nil, want an error", location)
+		}
+	}
+}
+
+func TestOpenArchiveChanged(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "docs.zip")
+
+	writeZip(t, name)
+
+	if _, err := Open(name); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	files["added.md"] = "# Added"
+	defer delete(files, "added.md")
+
+	writeZip(t, name)
+
+	fsys, err := Open(name)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if _, err := fs.Stat(fsys, "added.md"); err != nil {
+		t.Errorf("Stat() of a file added to the archive error = %v", err)
+	}
+}
+
+func TestOpenArchiveTooLarge(t *testing.T) {
+	// The file compresses to far less than the limit, and decompresses to more.
+	files["big.txt"] = strings.Repeat("a", 8192)
+	defer delete(files, "big.txt")
+
+	defer func(max int64) { maxArchiveSize = max }(maxArchiveSize)
+
+	maxArchiveSize = 4096
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		write   func(name string)
+		wantErr string
+	}{
+		{name: "docs.zip", write: func(name string) { writeZip(t, name) }, wantErr: "decompress to more than 4096 bytes"},
+		{name: "docs.tar.gz", write: func(name string) { writeTar(t, name, true) }, wantErr: "decompresses to more than 4096 bytes"},
+		{name: "docs.tar", write: func(name string) { writeTar(t, name, false) }, wantErr: "larger than 4096 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.name)
+			tt.write(name)
+
+			_, err := Open(name)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Open() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}